@@ -23,7 +23,7 @@ func initAPIClient() error {
 		return err
 	}
 
-	if b, err := os.ReadFile(filepath.Join(dir, "token")); err != nil {
+	if b, err := os.ReadFile(filepath.Join(dir, "token")); err == nil {
 		apiToken = strings.TrimSpace(string(b))
 	}
 
@@ -53,7 +53,7 @@ func daemonURL(path string) string {
 }
 
 func newRequest(method, path string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, daemonURL(path), nil)
+	req, err := http.NewRequest(method, daemonURL(path), body)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +87,19 @@ func apiPost(path, contentType string, body io.Reader) (*http.Response, error) {
 	return apiClient.Do(req)
 }
 
+func apiPatch(path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := newRequest(http.MethodPatch, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return apiClient.Do(req)
+}
+
 func apiDelete(path string) (*http.Response, error) {
 	req, err := newRequest(http.MethodDelete, path, nil)
 	if err != nil {
@@ -3,10 +3,14 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"synco/internal/bandwidth"
 	"synco/internal/daemon"
 	"synco/internal/logger"
+	"synco/internal/model"
 	"synco/internal/repository"
 	"syscall"
 	"time"
@@ -42,10 +46,7 @@ func runDaemonInProcess(extraSrc, extraDst string) error {
 		return err
 	}
 
-	manager, err := daemon.NewJobManager(cfg)
-	if err != nil {
-		return err
-	}
+	manager := daemon.NewJobManager(cfg, creds.Identity)
 
 	for _, job := range jobs {
 		if err := manager.StartJob(job); err != nil {
@@ -58,7 +59,37 @@ func runDaemonInProcess(extraSrc, extraDst string) error {
 	if extraSrc != "" && extraDst != "" {
 		srcType := endpointType(extraSrc)
 		dstType := endpointType(extraDst)
-		job, err := jobRepo.Add(extraSrc, srcType, extraDst, dstType)
+		schedule, err := parseSchedule(jobAddLimit, jobAddWindows)
+		if err != nil {
+			return err
+		}
+
+		symlinks, err := parseSymlinks(srcType, dstType)
+		if err != nil {
+			return err
+		}
+
+		watch, err := parseWatch(srcType)
+		if err != nil {
+			return err
+		}
+
+		if err := checkPreserveOwner(srcType, dstType); err != nil {
+			return err
+		}
+
+		job, err := jobRepo.Add(model.Job{
+			SrcType:       srcType,
+			SrcPath:       extraSrc,
+			DstType:       dstType,
+			DstPath:       extraDst,
+			Compress:      jobAddCompress,
+			RateLimit:     schedule.Rate,
+			RateWindows:   bandwidth.FormatWindows(schedule.Windows),
+			Symlinks:      symlinks,
+			Watch:         watch,
+			PreserveOwner: jobAddPreserveOwner,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to add job: %w", err)
 		}
@@ -70,12 +101,14 @@ func runDaemonInProcess(extraSrc, extraDst string) error {
 		fmt.Printf("watching %s → %s  (Ctrl+C to stop)\n", extraSrc, extraDst)
 	}
 
-	srv := daemon.NewServer(manager, cfg.DaemonPort, creds)
+	peerAddr := net.JoinHostPort(cfg.PeerAddr, strconv.Itoa(cfg.PeerPort))
+	srv := daemon.NewServer(manager, cfg.DaemonPort, peerAddr, creds)
 	srv.Start()
 
 	logger.Log.Info("synco daemon started",
 		zap.Int("jobs", len(jobs)),
-		zap.Int("port", cfg.DaemonPort))
+		zap.Int("port", cfg.DaemonPort),
+		zap.String("peer_addr", peerAddr))
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
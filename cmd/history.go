@@ -44,16 +44,20 @@ var historyCmd = &cobra.Command{
 
 		for _, h := range histories {
 			status := "✓"
-			if h.EventType == model.StatusFailed {
+			switch h.EventType {
+			case model.StatusFailed:
 				status = "✗"
+			case model.StatusRejected:
+				status = "⊘"
 			}
 
-			fmt.Printf("%s [%s] %-7s %s → %s\n",
+			fmt.Printf("%s [%s] %-7s %s → %s%s\n",
 				status,
 				h.SyncedAt.Format("2006-01-02 15:04:05"),
 				h.FileEvent,
 				h.SrcPath,
 				h.DstPath,
+				formatTransfer(h),
 			)
 		}
 
@@ -66,3 +70,27 @@ func init() {
 	historyCmd.Flags().UintVar(&historyJobID, "job", 0, "filter by job ID")
 	rootCmd.AddCommand(historyCmd)
 }
+
+// formatTransfer 내용을 보낸 기록이면 파일 크기와 실제로 전송한 크기를 표시
+func formatTransfer(h model.History) string {
+	if h.Size == 0 && h.WireBytes == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("  (%s, %s on wire)", formatBytes(h.Size), formatBytes(h.WireBytes))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
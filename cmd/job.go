@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"synco/internal/bandwidth"
+	"synco/internal/ignore"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/peer"
 	"synco/internal/repository"
 	"synco/internal/syncer"
 	"synco/internal/syncer/dropbox"
@@ -42,10 +46,11 @@ var jobListCmd = &cobra.Command{
 
 		var result struct {
 			Jobs []struct {
-				ID     uint   `json:"id"`
-				Src    string `json:"src_path"`
-				Dst    string `json:"dst_path"`
-				Status string `json:"status"`
+				ID            uint   `json:"id"`
+				Src           string `json:"SrcPath"`
+				Dst           string `json:"DstPath"`
+				Status        string `json:"status"`
+				Bidirectional bool   `json:"Bidirectional"`
 			} `json:"jobs"`
 			Running map[string]struct {
 				Synced int `json:"synced"`
@@ -60,14 +65,19 @@ var jobListCmd = &cobra.Command{
 			return nil
 		}
 
-		fmt.Printf("%-4s %-8s %-30s %-30s %s\n", "ID", "STATUS", "SRC", "DST", "SYNCED/FAILED")
+		fmt.Printf("%-4s %-8s %-30s %-2s %-30s %s\n", "ID", "STATUS", "SRC", "", "DST", "SYNCED/FAILED")
 		for _, j := range result.Jobs {
 			synced, failed := 0, 0
 			if r, ok := result.Running[fmt.Sprint(j.ID)]; ok {
 				synced = r.Synced
 				failed = r.Failed
 			}
-			fmt.Printf("%-4d %-8s %-30s %-30s %d/%d\n", j.ID, j.Status, j.Src, j.Dst, synced, failed)
+
+			arrow := "→"
+			if j.Bidirectional {
+				arrow = "⇄"
+			}
+			fmt.Printf("%-4d %-8s %-30s %-2s %-30s %d/%d\n", j.ID, j.Status, j.Src, arrow, j.Dst, synced, failed)
 		}
 
 		return nil
@@ -77,8 +87,16 @@ var jobListCmd = &cobra.Command{
 // ── job add ──────────────────────────────────────────────────────────────────
 
 var (
-	jobAddOnce       bool
-	jobAddForeground bool
+	jobAddOnce          bool
+	jobAddForeground    bool
+	jobAddBidirectional bool
+	jobAddMirror        bool
+	jobAddCompress      bool
+	jobAddLimit         string
+	jobAddWindows       []string
+	jobAddSymlinks      string
+	jobAddWatch         string
+	jobAddPreserveOwner bool
 )
 
 var jobAddCmd = &cobra.Command{
@@ -90,11 +108,27 @@ By default, the job is registered with the running daemon (which is started auto
 
 Flags:
 	--once			Perform a one-time sync immediately and exit (local→local only)
-	--foreground	Run the daemon in the foreground for this session`,
+	--foreground	Run the daemon in the foreground for this session
+	--bidirectional	Keep a local directory and a directory on a paired daemon in sync both ways
+	--mirror		Delete files at the remote TCP destination that do not exist at the source
+	--compress		Compress file content sent over remote TCP when the peer supports it
+	--limit			Limit the job's transfer rate, e.g. 1MB (bytes per second, shared by all transfers)
+	--window		Use a different rate during a time of day, e.g. 09:00-18:00=1MB (repeatable)
+	--symlinks		How to handle symlinks in the source: follow (default), copy-as-link or skip (local and remote TCP only)
+	--watch			How to detect changes in a local source: auto (default), fsnotify or poll
+	--preserve-owner	Also copy owner, group, setuid/setgid bits and user.* extended attributes (local and remote TCP only, applied when the receiver runs as root)`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		src, dst := args[0], args[1]
 
+		if jobAddBidirectional && (jobAddOnce || jobAddForeground) {
+			return fmt.Errorf("--bidirectional cannot be combined with --once or --foreground")
+		}
+
+		if jobAddMirror && (jobAddBidirectional || jobAddForeground) {
+			return fmt.Errorf("--mirror cannot be combined with --bidirectional or --foreground")
+		}
+
 		switch {
 		case jobAddOnce:
 			return runSyncOnce(src, dst)
@@ -128,6 +162,9 @@ func runSyncOnce(src, dst string) error {
 		zap.String("dst", dst))
 
 	results, err := s.FullSync()
+	if c, ok := s.(io.Closer); ok {
+		_ = c.Close()
+	}
 	if err != nil {
 		return err
 	}
@@ -161,43 +198,150 @@ func buildFullSyncer(src, dst string) (syncer.Syncer, error) {
 	srcType := endpointType(src)
 	dstType := endpointType(dst)
 
-	nodeID, err := model.LoadOrCreateNodeID()
+	id, err := peer.LoadOrCreateIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	if jobAddMirror && srcType != model.EndpointRemoteTCP && dstType != model.EndpointRemoteTCP {
+		return nil, fmt.Errorf("--mirror is only supported for remote TCP jobs")
+	}
+
+	if jobAddCompress && srcType != model.EndpointRemoteTCP && dstType != model.EndpointRemoteTCP {
+		return nil, fmt.Errorf("--compress is only supported for remote TCP jobs")
+	}
+
+	schedule, err := parseSchedule(jobAddLimit, jobAddWindows)
 	if err != nil {
 		return nil, err
 	}
 
+	symlinks, err := parseSymlinks(srcType, dstType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPreserveOwner(srcType, dstType); err != nil {
+		return nil, err
+	}
+
+	limiter := bandwidth.NewLimiter(schedule)
+
+	// 로컬 src는 그 아래의 무시 파일도 읽고, 클라우드 src는 상대 경로에 ignore_list만 적용
+	ig := ignore.New("", cfg.IgnoreList, cfg.Gitignore)
+	if srcType == model.EndpointLocal {
+		ig = ignore.New(src, cfg.IgnoreList, cfg.Gitignore)
+	}
+
+	opts := tcp.Options{Mirror: jobAddMirror, Compress: jobAddCompress, Limiter: limiter, Symlinks: symlinks, Ignore: ig, PreserveOwner: jobAddPreserveOwner}
+
 	switch {
 	case srcType == model.EndpointLocal && dstType == model.EndpointLocal:
-		return local.NewSyncer(src, dst, cfg.ConflictStrategy)
+		return local.NewSyncer(src, dst, cfg.ConflictStrategy, cfg.Workers, symlinks, jobAddPreserveOwner, nil, ig)
 
 	case srcType == model.EndpointLocal && dstType == model.EndpointRemoteTCP:
-		return tcp.NewSyncer(src, dst, nodeID, tcp.NewVclock())
+		return tcp.NewSyncer(src, dst, id, opts)
 
 	case srcType == model.EndpointRemoteTCP && dstType == model.EndpointLocal:
+		// 원격 데몬이 보내므로 이 노드의 속도 제한은 적용되지 않음
+		if schedule.Rate > 0 || len(schedule.Windows) > 0 {
+			return nil, fmt.Errorf("--limit and --window are not supported with --once from a remote TCP source")
+		}
+
 		ep := tcp.ParseEndpoint(src)
-		return tcp.NewPullSyncer(ep.Path, ep.Host, dst, nodeID, cfg.ConflictStrategy)
+		return tcp.NewPullSyncer(ep.Path, ep.Host, dst, id, cfg.ConflictStrategy, opts)
 
 	case srcType == model.EndpointLocal && dstType == model.EndpointGDrive:
 		path := strings.TrimPrefix(dst, "gdrive:")
-		return gdrive.NewUploader(src, path)
+		return gdrive.NewUploader(src, path, limiter, cfg.Workers, nil, ig)
 
 	case srcType == model.EndpointLocal && dstType == model.EndpointDropbox:
 		path := strings.TrimPrefix(dst, "dropbox:")
-		return dropbox.NewUploader(src, path)
+		return dropbox.NewUploader(src, path, limiter, cfg.Workers, nil, ig)
 
 	case srcType == model.EndpointGDrive && dstType == model.EndpointLocal:
 		path := strings.TrimPrefix(src, "gdrive:")
-		return gdrive.NewDownloader(path, dst)
+		return gdrive.NewDownloader(path, dst, cfg.Workers, ig)
 
 	case srcType == model.EndpointDropbox && dstType == model.EndpointLocal:
 		path := strings.TrimPrefix(src, "dropbox:")
-		return dropbox.NewDownloader(path, dst)
+		return dropbox.NewDownloader(path, dst, cfg.Workers, ig)
 
 	default:
 		return nil, fmt.Errorf("--once does not support %s → %s", srcType, dstType)
 	}
 }
 
+// ── job update ───────────────────────────────────────────────────────────────
+
+var (
+	jobUpdateLimit        string
+	jobUpdateWindows      []string
+	jobUpdateClearWindows bool
+)
+
+var jobUpdateCmd = &cobra.Command{
+	Use:   "update [id]",
+	Short: "Change the settings of a job",
+	Long: `Change the settings of a job. Only the given flags are changed, and a running job applies them immediately.
+
+Flags:
+	--limit			Transfer rate outside of any window, e.g. 1MB (0 for unlimited)
+	--window		Replace the time-of-day windows, e.g. 09:00-18:00=1MB (repeatable)
+	--clear-windows	Remove all time-of-day windows`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := map[string]any{}
+		if cmd.Flags().Changed("limit") {
+			req["rate_limit"] = jobUpdateLimit
+		}
+
+		switch {
+		case jobUpdateClearWindows && cmd.Flags().Changed("window"):
+			return fmt.Errorf("--window cannot be combined with --clear-windows")
+		case jobUpdateClearWindows:
+			req["rate_windows"] = []string{}
+		case cmd.Flags().Changed("window"):
+			req["rate_windows"] = jobUpdateWindows
+		}
+
+		if len(req) == 0 {
+			return fmt.Errorf("nothing to update")
+		}
+
+		body, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		resp, err := apiPatch("/jobs/"+args[0], "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("daemon not running: %w", err)
+		}
+
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		if resp.StatusCode != http.StatusOK {
+			var result map[string]string
+			_ = json.NewDecoder(resp.Body).Decode(&result)
+			return fmt.Errorf("failed to update job: %s", result["error"])
+		}
+
+		var job model.Job
+		_ = json.NewDecoder(resp.Body).Decode(&job)
+
+		fmt.Printf("job %s updated: limit=%s", args[0], bandwidth.FormatRate(job.RateLimit))
+		if job.RateWindows != "" {
+			fmt.Printf(" windows=%s", job.RateWindows)
+		}
+		fmt.Println()
+
+		return nil
+	},
+}
+
 // ── job remove / pause / resume ───────────────────────────────────────────────
 
 var jobRemoveCmd = &cobra.Command{
@@ -272,9 +416,25 @@ func postJob(src, dst string) error {
 	srcType := endpointType(src)
 	dstType := endpointType(dst)
 
-	body := fmt.Sprintf(`{"src":"%s","src_type":"%s","dst":"%s","dst_type":"%s"}`,
-		src, srcType, dst, dstType)
-	resp, err := apiPost("/jobs", "application/json", strings.NewReader(body))
+	body, err := json.Marshal(map[string]any{
+		"src":            src,
+		"src_type":       srcType,
+		"dst":            dst,
+		"dst_type":       dstType,
+		"bidirectional":  jobAddBidirectional,
+		"mirror":         jobAddMirror,
+		"compress":       jobAddCompress,
+		"rate_limit":     jobAddLimit,
+		"rate_windows":   jobAddWindows,
+		"symlinks":       jobAddSymlinks,
+		"watch":          jobAddWatch,
+		"preserve_owner": jobAddPreserveOwner,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := apiPost("/jobs", "application/json", bytes.NewReader(body))
 
 	if err != nil {
 		return fmt.Errorf("failed to reach daemon: %w", err)
@@ -286,10 +446,80 @@ func postJob(src, dst string) error {
 
 	var result map[string]any
 	_ = json.NewDecoder(resp.Body).Decode(&result)
-	fmt.Printf("job added: id=%v  %s → %s\n", result["id"], src, dst)
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to add job: %v", result["error"])
+	}
+
+	arrow := "→"
+	if jobAddBidirectional {
+		arrow = "⇄"
+	}
+
+	fmt.Printf("job added: id=%v  %s %s %s\n", result["ID"], src, arrow, dst)
 	return nil
 }
 
+func parseSchedule(rate string, windows []string) (bandwidth.Schedule, error) {
+	rateLimit, err := bandwidth.ParseRate(rate)
+	if err != nil {
+		return bandwidth.Schedule{}, err
+	}
+
+	schedule := bandwidth.Schedule{Rate: rateLimit}
+	for _, w := range windows {
+		window, err := bandwidth.ParseWindow(w)
+		if err != nil {
+			return bandwidth.Schedule{}, err
+		}
+
+		schedule.Windows = append(schedule.Windows, window)
+	}
+
+	return schedule, nil
+}
+
+// parseSymlinks 클라우드 저장소에는 링크가 없으므로 로컬과 TCP job에서만 정책을 지정할 수 있음
+func parseSymlinks(srcType, dstType model.EndpointType) (model.SymlinkPolicy, error) {
+	policy, err := model.ParseSymlinkPolicy(jobAddSymlinks)
+	if err != nil {
+		return "", err
+	}
+
+	if jobAddSymlinks != "" && (isCloud(srcType) || isCloud(dstType)) {
+		return "", fmt.Errorf("--symlinks is only supported for local and remote TCP jobs")
+	}
+
+	return policy, nil
+}
+
+// parseWatch 클라우드 src는 API로 변경을 받으므로 로컬이나 원격 데몬의 디렉터리를 감시하는 job에서만 지정할 수 있음
+func parseWatch(srcType model.EndpointType) (model.WatchMode, error) {
+	mode, err := model.ParseWatchMode(jobAddWatch)
+	if err != nil {
+		return "", err
+	}
+
+	if jobAddWatch != "" && isCloud(srcType) {
+		return "", fmt.Errorf("--watch is only supported for local and remote TCP sources")
+	}
+
+	return mode, nil
+}
+
+// checkPreserveOwner 클라우드 저장소는 소유자와 확장 속성을 저장하지 않음
+func checkPreserveOwner(srcType, dstType model.EndpointType) error {
+	if jobAddPreserveOwner && (isCloud(srcType) || isCloud(dstType)) {
+		return fmt.Errorf("--preserve-owner is only supported for local and remote TCP jobs")
+	}
+
+	return nil
+}
+
+func isCloud(t model.EndpointType) bool {
+	return t == model.EndpointGDrive || t == model.EndpointDropbox
+}
+
 func endpointType(raw string) model.EndpointType {
 	switch {
 	case strings.HasPrefix(raw, "gdrive:"):
@@ -306,7 +536,19 @@ func endpointType(raw string) model.EndpointType {
 func init() {
 	jobAddCmd.Flags().BoolVar(&jobAddOnce, "once", false, "sync once and exit (local→local only)")
 	jobAddCmd.Flags().BoolVar(&jobAddForeground, "foreground", false, "run daemon in foreground")
-
-	jobCmd.AddCommand(jobListCmd, jobAddCmd, jobRemoveCmd, jobPauseCmd, jobResumeCmd)
+	jobAddCmd.Flags().BoolVar(&jobAddBidirectional, "bidirectional", false, "sync both ways with a directory on a paired daemon")
+	jobAddCmd.Flags().BoolVar(&jobAddMirror, "mirror", false, "delete remote files that do not exist at the source (remote TCP only)")
+	jobAddCmd.Flags().BoolVar(&jobAddCompress, "compress", false, "compress file content on the wire (remote TCP only)")
+	jobAddCmd.Flags().StringVar(&jobAddLimit, "limit", "", "transfer rate limit in bytes per second, e.g. 1MB")
+	jobAddCmd.Flags().StringArrayVar(&jobAddWindows, "window", nil, "time-of-day rate, e.g. 09:00-18:00=1MB (repeatable)")
+	jobAddCmd.Flags().StringVar(&jobAddSymlinks, "symlinks", "", "symlink handling: follow, copy-as-link or skip (local and remote TCP only)")
+	jobAddCmd.Flags().StringVar(&jobAddWatch, "watch", "", "change detection for a local source: auto, fsnotify or poll")
+	jobAddCmd.Flags().BoolVar(&jobAddPreserveOwner, "preserve-owner", false, "copy owner, group, setuid/setgid bits and user.* xattrs (local and remote TCP only)")
+
+	jobUpdateCmd.Flags().StringVar(&jobUpdateLimit, "limit", "", "transfer rate limit in bytes per second, e.g. 1MB (0 for unlimited)")
+	jobUpdateCmd.Flags().StringArrayVar(&jobUpdateWindows, "window", nil, "time-of-day rate, e.g. 09:00-18:00=1MB (repeatable)")
+	jobUpdateCmd.Flags().BoolVar(&jobUpdateClearWindows, "clear-windows", false, "remove all time-of-day windows")
+
+	jobCmd.AddCommand(jobListCmd, jobAddCmd, jobUpdateCmd, jobRemoveCmd, jobPauseCmd, jobResumeCmd)
 	rootCmd.AddCommand(jobCmd)
 }
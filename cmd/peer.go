@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"synco/internal/model"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var peerCmd = &cobra.Command{
+	Use:   "peer",
+	Short: "Manage paired peers",
+}
+
+// ── peer list ────────────────────────────────────────────────────────────────
+
+var peerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List paired peers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := apiGet("/peers")
+		if err != nil {
+			return fmt.Errorf("daemon not running: %w", err)
+		}
+
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		var peers []model.Peer
+		if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		if len(peers) == 0 {
+			fmt.Println("no peers paired — use 'synco peer pair' and 'synco peer add'")
+			return nil
+		}
+
+		fmt.Printf("%-18s %-24s %-18s %s\n", "NODE ID", "ADDRESS", "FINGERPRINT", "PAIRED")
+		for _, p := range peers {
+			fmt.Printf("%-18s %-24s %-18s %s\n",
+				p.NodeID, truncate(p.Address, 24), truncate(p.Fingerprint, 16), formatAgo(p.UpdatedAt))
+		}
+
+		return nil
+	},
+}
+
+// ── peer pair ────────────────────────────────────────────────────────────────
+
+var peerPairCmd = &cobra.Command{
+	Use:   "pair",
+	Short: "Show a one-time code for pairing this node with another",
+	Long: `Show a one-time pairing code for this node.
+
+Run 'synco peer add <address> <code>' on the other machine with this code.
+The code expires after 5 minutes and can only be used once.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := apiPost("/peers/pair", "", nil)
+		if err != nil {
+			return fmt.Errorf("daemon not running: %w", err)
+		}
+
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		var result struct {
+			Code        string    `json:"code"`
+			ExpiresAt   time.Time `json:"expires_at"`
+			NodeID      string    `json:"node_id"`
+			Fingerprint string    `json:"fingerprint"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		fmt.Printf("pairing code: %s  (expires %s)\n\n", result.Code, result.ExpiresAt.Local().Format("15:04:05"))
+		fmt.Printf("  node         %s\n", result.NodeID)
+		fmt.Printf("  fingerprint  %s\n\n", result.Fingerprint)
+		fmt.Printf("on the other machine run:  synco peer add <this host>:%d %s\n", cfg.PeerPort, result.Code)
+		return nil
+	},
+}
+
+// ── peer add ─────────────────────────────────────────────────────────────────
+
+var peerAddCmd = &cobra.Command{
+	Use:   "add [address] [code]",
+	Short: "Pair with a remote node using its one-time code",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := json.Marshal(map[string]string{
+			"address": args[0],
+			"code":    args[1],
+		})
+		if err != nil {
+			return err
+		}
+
+		resp, err := apiPost("/peers", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			return fmt.Errorf("daemon not running: %w", err)
+		}
+
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		if resp.StatusCode != http.StatusCreated {
+			var errResp map[string]string
+			_ = json.NewDecoder(resp.Body).Decode(&errResp)
+			return fmt.Errorf("pairing failed: %s", errResp["error"])
+		}
+
+		var p model.Peer
+		if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		fmt.Printf("paired with %s (%s)\n", p.NodeID, p.Address)
+		fmt.Printf("  fingerprint  %s\n", p.Fingerprint)
+		return nil
+	},
+}
+
+// ── peer remove ──────────────────────────────────────────────────────────────
+
+var peerRemoveCmd = &cobra.Command{
+	Use:   "remove [node-id]",
+	Short: "Remove a paired peer",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := apiDelete("/peers/" + args[0])
+		if err != nil {
+			return fmt.Errorf("daemon not running: %w", err)
+		}
+
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("peer %s not found", args[0])
+		}
+
+		fmt.Printf("peer %s removed\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	peerCmd.AddCommand(peerListCmd, peerPairCmd, peerAddCmd, peerRemoveCmd)
+	rootCmd.AddCommand(peerCmd)
+}
@@ -24,6 +24,10 @@ var clientOnlyCmds = map[string]bool{
 	"synco job pause":    true,
 	"synco job resume":   true,
 	"synco job remove":   true,
+	"synco peer list":    true,
+	"synco peer pair":    true,
+	"synco peer add":     true,
+	"synco peer remove":  true,
 }
 
 var rootCmd = &cobra.Command{
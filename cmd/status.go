@@ -24,18 +24,22 @@ var statusCmd = &cobra.Command{
 
 		var result struct {
 			Daemon struct {
-				PID       int       `json:"pid"`
-				StartedAt time.Time `json:"started_at"`
+				PID         int       `json:"pid"`
+				StartedAt   time.Time `json:"started_at"`
+				NodeID      string    `json:"node_id"`
+				Fingerprint string    `json:"fingerprint"`
 			} `json:"daemon"`
 			Jobs []struct {
-				JobID     uint       `json:"job_id"`
-				Src       string     `json:"src"`
-				Dst       string     `json:"dst"`
-				Status    string     `json:"status"`
-				Synced    int        `json:"synced"`
-				Failed    int        `json:"failed"`
-				LastSync  *time.Time `json:"last_sync"`
-				StartedAt time.Time  `json:"started_at"`
+				JobID      uint       `json:"job_id"`
+				Src        string     `json:"src"`
+				Dst        string     `json:"dst"`
+				Status     string     `json:"status"`
+				Synced     int        `json:"synced"`
+				Failed     int        `json:"failed"`
+				LastSync   *time.Time `json:"last_sync"`
+				StartedAt  time.Time  `json:"started_at"`
+				LostEvents int64      `json:"lost_events"`
+				Rescans    int64      `json:"rescans"`
 			} `json:"jobs"`
 		}
 
@@ -44,8 +48,10 @@ var statusCmd = &cobra.Command{
 		}
 
 		uptime := time.Since(result.Daemon.StartedAt).Round(time.Second)
-		fmt.Printf("● synco daemon  running  (pid %d, uptime %s)\n\n",
+		fmt.Printf("● synco daemon  running  (pid %d, uptime %s)\n",
 			result.Daemon.PID, formatDuration(uptime))
+		fmt.Printf("  node %s  fingerprint %s\n\n",
+			result.Daemon.NodeID, result.Daemon.Fingerprint)
 
 		if len(result.Jobs) == 0 {
 			fmt.Println("  no active jobs — use 'synco job add <src> <dst>'")
@@ -64,6 +70,9 @@ var statusCmd = &cobra.Command{
 			fmt.Printf("%-4d %-8s %-28s %-28s %-8d %-8d %s\n",
 				j.JobID, j.Status, truncate(j.Src, 28), truncate(j.Dst, 28), j.Synced, j.Failed, lastSync)
 			fmt.Printf("       uptime: %s\n", uptime)
+			if j.LostEvents > 0 {
+				fmt.Printf("       lost events: %d (rescanned %d times)\n", j.LostEvents, j.Rescans)
+			}
 		}
 
 		return nil
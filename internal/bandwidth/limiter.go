@@ -0,0 +1,149 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// 한 번에 예약하는 최대 크기. 여러 전송이 한 limiter를 나눠 쓸 때 한쪽이 오래 독점하지 않도록 함
+const maxReserve = 32 * 1024
+
+// Limiter job의 모든 전송이 함께 쓰는 token bucket. 속도는 Schedule에 따라 시각마다 바뀜.
+// nil이면 제한하지 않음
+type Limiter struct {
+	mu       sync.Mutex
+	schedule Schedule
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter 제한이 없는 schedule이어도 만들어 두어 job 설정을 바꾸면 SetSchedule로 바로 적용
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{
+		schedule: schedule,
+		last:     time.Now(),
+	}
+}
+
+func (l *Limiter) SetSchedule(schedule Schedule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.schedule = schedule
+}
+
+// WaitN n 바이트를 보낼 수 있을 때까지 기다림
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	for n > 0 {
+		take, delay := l.reserve(n)
+		n -= take
+
+		if delay <= 0 {
+			continue
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return nil
+}
+
+// reserve 최대 1초 분량을 먼저 가져가고, 모자라는 만큼 기다릴 시간을 반환.
+// 토큰이 음수가 되면 뒤에 오는 전송이 그만큼 더 기다리게 되어 여러 전송의 합이 속도를 넘지 않음
+func (l *Limiter) reserve(n int) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := l.schedule.RateAt(now)
+	elapsed := now.Sub(l.last)
+	l.last = now
+
+	if rate <= 0 {
+		l.tokens = 0
+		return n, 0
+	}
+
+	burst := float64(rate)
+	l.tokens = min(burst, l.tokens+elapsed.Seconds()*float64(rate))
+
+	take := min(n, maxReserve, int(max(rate, 1)))
+	l.tokens -= float64(take)
+
+	if l.tokens >= 0 {
+		return take, 0
+	}
+
+	return take, time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+// Reader 읽은 만큼 속도를 맞추는 reader. l이 nil이면 r을 그대로 반환
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{r: r, l: l}
+}
+
+// Writer 쓰기 전에 속도를 맞추는 writer. l이 nil이면 w를 그대로 반환
+func (l *Limiter) Writer(w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+
+	return &writer{w: w, l: l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxReserve {
+		p = p[:maxReserve]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		_ = r.l.WaitN(context.Background(), n)
+	}
+
+	return n, err
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxReserve)]
+		_ = w.l.WaitN(context.Background(), len(chunk))
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
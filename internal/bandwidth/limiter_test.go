@@ -0,0 +1,134 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterSharesRateAcrossTransfers(t *testing.T) {
+	const (
+		rate      = 256 * 1024
+		transfers = 3
+		size      = 128 * 1024
+	)
+
+	l := NewLimiter(Schedule{Rate: rate})
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range transfers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Writer(io.Discard).Write(make([]byte, size)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 전송마다 따로 속도를 맞추면 0.5초면 끝남
+	want := time.Duration(float64(transfers*size) / rate * float64(time.Second))
+	if elapsed := time.Since(start); elapsed < want*8/10 || elapsed > want*3 {
+		t.Errorf("%d transfers of %d bytes at %d B/s took %s, want about %s", transfers, size, rate, elapsed, want)
+	}
+}
+
+func TestLimiterWithoutRateDoesNotWait(t *testing.T) {
+	var nilLimiter *Limiter
+	for _, l := range []*Limiter{nilLimiter, NewLimiter(Schedule{})} {
+		start := time.Now()
+		if _, err := l.Writer(io.Discard).Write(make([]byte, 64<<20)); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("unlimited write took %s", elapsed)
+		}
+	}
+}
+
+func TestLimiterWaitNHonorsContext(t *testing.T) {
+	l := NewLimiter(Schedule{Rate: 1024})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := l.WaitN(ctx, 1<<20); err == nil {
+		t.Error("WaitN returned without error after the context expired")
+	}
+}
+
+func TestScheduleRateAt(t *testing.T) {
+	windows, err := ParseWindows("09:00-18:00=1MB, 22:00-06:00=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Schedule{Rate: 5 << 20, Windows: windows}
+
+	tests := []struct {
+		hour, minute int
+		want         int64
+	}{
+		{3, 30, 0},
+		{8, 59, 5 << 20},
+		{9, 0, 1 << 20},
+		{17, 59, 1 << 20},
+		{18, 0, 5 << 20},
+		{22, 0, 0},
+		{23, 30, 0},
+		{6, 0, 5 << 20},
+	}
+
+	for _, tt := range tests {
+		at := time.Date(2026, 1, 1, tt.hour, tt.minute, 0, 0, time.Local)
+		if got := s.RateAt(at); got != tt.want {
+			t.Errorf("RateAt(%02d:%02d) = %d, want %d", tt.hour, tt.minute, got, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1.5MB", 3 << 19, false},
+		{"512k", 512 << 10, false},
+		{"512KB/s", 512 << 10, false},
+		{"100", 100, false},
+		{"2G", 2 << 30, false},
+		{"0", 0, false},
+		{"unlimited", 0, false},
+		{"x", 0, true},
+		{"-1MB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseWindowsRoundTrip(t *testing.T) {
+	in := "09:00-18:00=1MB,22:00-24:00=512KB"
+
+	windows, err := ParseWindows(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatWindows(windows); got != in {
+		t.Errorf("FormatWindows = %q, want %q", got, in)
+	}
+
+	for _, s := range []string{"09:00=1MB", "09:00-09:00=1MB", "25:00-26:00=1MB", "09:00-18:00", "09:00-18:00=fast"} {
+		if _, err := ParseWindows(s); err == nil {
+			t.Errorf("ParseWindows(%q) was accepted", s)
+		}
+	}
+}
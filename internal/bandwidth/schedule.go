@@ -0,0 +1,176 @@
+package bandwidth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window 하루 중 Start부터 End 전까지 적용하는 속도. End가 Start보다 이르면 자정을 넘김
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	// Rate 초당 바이트 수. 0이면 제한 없음
+	Rate int64
+}
+
+// Schedule 어느 창에도 속하지 않는 시각에는 Rate를 적용. 창이 겹치면 앞의 창이 우선
+type Schedule struct {
+	Rate    int64
+	Windows []Window
+}
+
+// RateAt t의 현지 시각에 적용되는 속도
+func (s Schedule) RateAt(t time.Time) int64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	for _, w := range s.Windows {
+		if w.contains(offset) {
+			return w.Rate
+		}
+	}
+
+	return s.Rate
+}
+
+func (w Window) contains(offset time.Duration) bool {
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	return offset >= w.Start || offset < w.End
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%s-%s=%s", formatClock(w.Start), formatClock(w.End), FormatRate(w.Rate))
+}
+
+var units = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseRate "512KB", "1.5MB", "0"처럼 초당 바이트 수를 읽음. 단위는 1024 배수이고 0이나 "unlimited"는 제한 없음
+func ParseRate(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "/S")
+
+	if s == "" || s == "UNLIMITED" {
+		return 0, nil
+	}
+
+	size := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, size = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate: %q", s)
+	}
+
+	return int64(v * float64(size)), nil
+}
+
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+
+	for _, u := range units[:3] {
+		if rate >= u.size && rate%u.size == 0 {
+			return fmt.Sprintf("%d%s", rate/u.size, u.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%dB", rate)
+}
+
+// ParseWindow "09:00-18:00=1MB" 형식
+func ParseWindow(s string) (Window, error) {
+	span, rate, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM=RATE", s)
+	}
+
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM=RATE", s)
+	}
+
+	var w Window
+	var err error
+	if w.Start, err = parseClock(from); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	if w.End, err = parseClock(to); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are the same", s)
+	}
+
+	if w.Rate, err = ParseRate(rate); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+
+	return w, nil
+}
+
+// ParseWindows 쉼표로 구분한 창 목록. FormatWindows의 결과를 다시 읽을 수 있음
+func ParseWindows(s string) ([]Window, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var windows []Window
+	for part := range strings.SplitSeq(s, ",") {
+		w, err := ParseWindow(part)
+		if err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+func FormatWindows(windows []Window) string {
+	parts := make([]string, len(windows))
+	for i, w := range windows {
+		parts[i] = w.String()
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		// 24:00은 자정으로 끝나는 창을 위해 허용
+		if strings.TrimSpace(s) == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -6,26 +6,41 @@ import (
 	"os"
 	"path/filepath"
 	"synco/internal/model"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port             int                    `mapstructure:"port"`
-	DaemonPort       int                    `mapstructure:"daemon_port"`
-	BufferSize       int                    `mapstructure:"buffer_size"`
-	IgnoreList       []string               `mapstructure:"ignore_list"`
+	PeerAddr   string `mapstructure:"peer_addr"`
+	PeerPort   int    `mapstructure:"peer_port"`
+	DaemonPort int    `mapstructure:"daemon_port"`
+	BufferSize int    `mapstructure:"buffer_size"`
+	// IgnoreList src 최상위의 .syncoignore처럼 적용하는 gitignore 형식의 패턴
+	IgnoreList []string `mapstructure:"ignore_list"`
+	// Gitignore .syncoignore와 함께 src의 .gitignore도 따름
+	Gitignore        bool                   `mapstructure:"gitignore"`
 	DBPath           string                 `mapstructure:"db_path"`
 	ConflictStrategy model.ConflictStrategy `mapstructure:"conflict_strategy"`
+	// Workers job마다 동시에 처리하는 이벤트 수. 같은 경로의 이벤트는 순서대로 처리
+	Workers int `mapstructure:"workers"`
+	// PollInterval polling으로 감시하는 job이 디렉터리를 다시 훑는 간격
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// DelegateRoots 다른 노드가 위임하는 job의 src로 허용하는 디렉터리. 비어 있으면 위임을 받지 않음
+	DelegateRoots []string `mapstructure:"delegate_roots"`
 }
 
 var Default = Config{
-	Port:             9000,
+	PeerAddr:         "0.0.0.0",
+	PeerPort:         9000,
 	DaemonPort:       9001,
 	BufferSize:       100,
 	IgnoreList:       []string{".git", ".DS_Store", "*.tmp", "*.swp"},
+	Gitignore:        false,
 	DBPath:           "synco.db",
 	ConflictStrategy: model.StrategyNewerWins,
+	Workers:          4,
+	PollInterval:     30 * time.Second,
 }
 
 func Load() (*Config, error) {
@@ -43,12 +58,17 @@ func Load() (*Config, error) {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(configDir)
 
-	viper.SetDefault("port", Default.Port)
+	viper.SetDefault("peer_addr", Default.PeerAddr)
+	viper.SetDefault("peer_port", Default.PeerPort)
 	viper.SetDefault("daemon_port", Default.DaemonPort)
 	viper.SetDefault("buffer_size", Default.BufferSize)
 	viper.SetDefault("ignore_list", Default.IgnoreList)
+	viper.SetDefault("gitignore", Default.Gitignore)
 	viper.SetDefault("db_path", Default.DBPath)
 	viper.SetDefault("conflict_strategy", Default.ConflictStrategy)
+	viper.SetDefault("workers", Default.Workers)
+	viper.SetDefault("poll_interval", Default.PollInterval)
+	viper.SetDefault("delegate_roots", Default.DelegateRoots)
 
 	viper.SetEnvPrefix("SYNCO")
 	viper.AutomaticEnv()
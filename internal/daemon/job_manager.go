@@ -7,11 +7,16 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
+	"synco/internal/bandwidth"
 	"synco/internal/config"
+	"synco/internal/ignore"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/peer"
 	"synco/internal/pipeline"
 	"synco/internal/repository"
 	"synco/internal/retry"
@@ -31,48 +36,58 @@ type JobManager struct {
 	cfg     *config.Config
 	repo    *repository.HistoryRepository
 	jobRepo *repository.JobRepository
-	nodeID  string
+	id      *peer.Identity
 }
 
-func NewJobManager(cfg *config.Config) (*JobManager, error) {
-	nodeID, err := model.LoadOrCreateNodeID()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load node ID: %w", err)
-	}
-
+func NewJobManager(cfg *config.Config, id *peer.Identity) *JobManager {
 	return &JobManager{
 		jobs:    make(map[uint]*JobState),
 		cfg:     cfg,
 		repo:    repository.NewHistoryRepository(),
 		jobRepo: repository.NewJobRepository(),
-		nodeID:  nodeID,
-	}, nil
+		id:      id,
+	}
 }
 
 func (m *JobManager) RunInitialSync(job model.Job) {
-	s, err := m.newSyncer(job)
+	// 원격 src job은 delegation을 받은 상대 데몬이 전체 동기화를 보냄
+	if job.SrcType == model.EndpointRemoteTCP {
+		return
+	}
+
+	s, err := m.newSyncer(job, m.limiterFor(job), m.newMatcher(job))
 	if err != nil {
 		logger.Log.Warn("initial sync: failed to create syncer",
 			zap.Error(err))
+		return
+	}
+
+	m.fullSync(job.ID, s)
+
+	// 이 syncer는 전체 동기화에만 쓰므로 유지하던 연결을 닫음
+	if c, ok := s.(io.Closer); ok {
+		_ = c.Close()
 	}
+}
 
+func (m *JobManager) fullSync(jobID uint, s syncer.Syncer) {
 	logger.Log.Info("initial full sync started",
-		zap.Uint("job", job.ID))
+		zap.Uint("job", jobID))
 
 	results, err := s.FullSync()
 	if err != nil {
 		logger.Log.Warn("initial full sync failed",
-			zap.Uint("job", job.ID),
+			zap.Uint("job", jobID),
 			zap.Error(err))
 		return
 	}
 
 	for _, r := range results {
-		_ = m.repo.Save(r, job.ID)
+		_ = m.repo.Save(r, jobID)
 	}
 
 	logger.Log.Info("initial full sync done",
-		zap.Uint("job", job.ID),
+		zap.Uint("job", jobID),
 		zap.Int("results", len(results)))
 }
 
@@ -95,22 +110,34 @@ func (m *JobManager) StartJob(job model.Job) error {
 		return nil
 	}
 
-	src, err := m.newSource(job)
+	// 무시 파일이 바뀐 것을 파이프라인이 알려 주므로 전체 동기화와 같은 규칙을 씀
+	ig := m.newMatcher(job)
+	src, err := m.newSource(job, ig)
 	if err != nil {
 		return err
 	}
 
-	s, err := m.newSyncer(job)
+	s, err := m.newSyncer(job, state.Limiter, ig)
 	if err != nil {
 		return err
 	}
 
+	// 양방향 job이면 상대가 보내는 변경을 받을 서버도 실행
+	if job.Bidirectional {
+		if err := m.startRecvServer(job, job.SrcPath, state); err != nil {
+			return err
+		}
+	}
+
 	if err := src.Start(); err != nil {
+		if state.RecvServer != nil {
+			state.RecvServer.Stop()
+		}
 		return fmt.Errorf("failed to start source: %w", err)
 	}
 
 	m.jobs[job.ID] = state
-	go m.runPipeline(state, src, s)
+	go m.runPipeline(state, src, s, index.New(job.ID, job.SrcPath), ig)
 
 	logger.Log.Info("job started",
 		zap.Uint("id", job.ID),
@@ -120,19 +147,60 @@ func (m *JobManager) StartJob(job model.Job) error {
 	return nil
 }
 
-func (m *JobManager) PushOnce(src, pushTo, nodeID string) ([]model.SyncResult, error) {
-	s, err := tcp.NewSyncer(src, pushTo, nodeID, tcp.NewVclock())
+// Delegatable 다른 노드가 요청한 src가 delegate_roots 아래에 있으면 true. 링크를 따라간 실제 경로로 비교
+func (m *JobManager) Delegatable(src string) bool {
+	if !filepath.IsAbs(src) {
+		return false
+	}
+
+	src = realPath(src)
+	for _, root := range m.cfg.DelegateRoots {
+		if root == "" {
+			continue
+		}
+
+		rel, err := filepath.Rel(realPath(root), src)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// realPath 아직 없는 경로는 있는 상위 디렉터리까지만 링크를 따라감
+func realPath(path string) string {
+	path = filepath.Clean(path)
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+
+	return filepath.Join(realPath(parent), filepath.Base(path))
+}
+
+func (m *JobManager) PushOnce(src, pushTo string, opts tcp.Options) ([]model.SyncResult, error) {
+	opts.Ignore = ignore.New(src, m.cfg.IgnoreList, m.cfg.Gitignore)
+	s, err := tcp.NewSyncer(src, pushTo, m.id, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to created syncer: %w", err)
 	}
 
+	defer func(s *tcp.Syncer) {
+		_ = s.Close()
+	}(s)
+
 	return s.FullSync()
 }
 
-func (m *JobManager) newSource(job model.Job) (syncer.EventSource, error) {
+func (m *JobManager) newSource(job model.Job, ig *ignore.Matcher) (syncer.EventSource, error) {
 	switch job.SrcType {
 	case model.EndpointLocal:
-		return local.NewSource(job.SrcPath, m.cfg.BufferSize)
+		return local.NewWatchSource(job.SrcPath, job.Watch, m.cfg.BufferSize, m.cfg.PollInterval, job.Symlinks, index.New(job.ID, job.SrcPath), ig)
 	case model.EndpointGDrive:
 		path := strings.TrimPrefix(job.SrcPath, "gdrive:")
 		return gdrive.NewSource(job.ID, path, 30*time.Second)
@@ -144,36 +212,102 @@ func (m *JobManager) newSource(job model.Job) (syncer.EventSource, error) {
 	}
 }
 
-func (m *JobManager) newSyncer(job model.Job) (syncer.Syncer, error) {
+// limiterFor 실행 중인 job이면 그 job의 전송과 속도 제한을 함께 씀
+func (m *JobManager) limiterFor(job model.Job) *bandwidth.Limiter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if state, exists := m.jobs[job.ID]; exists {
+		return state.Limiter
+	}
+
+	return bandwidth.NewLimiter(scheduleOf(job))
+}
+
+// SetBandwidth 실행 중인 job이면 바뀐 속도 설정을 진행 중인 전송에도 바로 적용
+func (m *JobManager) SetBandwidth(job model.Job) {
+	m.mu.RLock()
+	state, exists := m.jobs[job.ID]
+	m.mu.RUnlock()
+
+	if exists {
+		state.Limiter.SetSchedule(scheduleOf(job))
+	}
+}
+
+// newMatcher 로컬 src는 그 아래의 무시 파일도 읽고, 클라우드 src는 상대 경로에 ignore_list만 적용
+func (m *JobManager) newMatcher(job model.Job) *ignore.Matcher {
+	if job.SrcType == model.EndpointLocal {
+		return ignore.New(job.SrcPath, m.cfg.IgnoreList, m.cfg.Gitignore)
+	}
+
+	return ignore.New("", m.cfg.IgnoreList, m.cfg.Gitignore)
+}
+
+func (m *JobManager) newSyncer(job model.Job, limiter *bandwidth.Limiter, ig *ignore.Matcher) (syncer.Syncer, error) {
+	ix := index.New(job.ID, job.SrcPath)
+
 	switch {
 	case job.DstType == model.EndpointLocal && job.SrcType == model.EndpointLocal:
-		return local.NewSyncer(job.SrcPath, job.DstPath, m.cfg.ConflictStrategy)
+		return local.NewSyncer(job.SrcPath, job.DstPath, m.cfg.ConflictStrategy, m.cfg.Workers, job.Symlinks, job.PreserveOwner, ix, ig)
 
 	case job.DstType == model.EndpointLocal && job.SrcType == model.EndpointGDrive:
 		path := strings.TrimPrefix(job.SrcPath, "gdrive:")
-		return gdrive.NewDownloader(path, job.DstPath)
+		return gdrive.NewDownloader(path, job.DstPath, m.cfg.Workers, ig)
 
 	case job.DstType == model.EndpointLocal && job.SrcType == model.EndpointDropbox:
 		path := strings.TrimPrefix(job.SrcPath, "dropbox:")
-		return dropbox.NewDownloader(path, job.DstPath)
+		return dropbox.NewDownloader(path, job.DstPath, m.cfg.Workers, ig)
 
 	case job.DstType == model.EndpointRemoteTCP:
-		return tcp.NewSyncer(job.SrcPath, job.DstPath, m.nodeID, tcp.NewVclock())
+		return tcp.NewSyncer(job.SrcPath, job.DstPath, m.id, tcp.Options{
+			Mirror:        job.Mirror,
+			Compress:      job.Compress,
+			Limiter:       limiter,
+			Workers:       m.cfg.Workers,
+			Symlinks:      job.Symlinks,
+			Index:         ix,
+			Ignore:        ig,
+			PreserveOwner: job.PreserveOwner,
+		})
 
 	case job.DstType == model.EndpointGDrive:
 		path := strings.TrimPrefix(job.DstPath, "gdrive:")
-		return gdrive.NewUploader(job.SrcPath, path)
+		return gdrive.NewUploader(job.SrcPath, path, limiter, m.cfg.Workers, ix, ig)
 
 	case job.DstType == model.EndpointDropbox:
 		path := strings.TrimPrefix(job.DstPath, "dropbox:")
-		return dropbox.NewUploader(job.SrcPath, path)
+		return dropbox.NewUploader(job.SrcPath, path, limiter, m.cfg.Workers, ix, ig)
 
 	default:
 		return nil, fmt.Errorf("unsupported job type: %s → %s", job.SrcType, job.DstType)
 	}
 }
 
-func (m *JobManager) startDelegatedJob(job model.Job, state *JobState) error {
+// RecvAddr 상대 노드가 이 job으로 변경을 보낼 주소
+func (m *JobManager) RecvAddr(id uint) (string, error) {
+	m.mu.RLock()
+	state, exists := m.jobs[id]
+	m.mu.RUnlock()
+
+	if !exists || state.RecvServer == nil {
+		return "", fmt.Errorf("job %d has no receive server", id)
+	}
+
+	return recvAddr(state)
+}
+
+func recvAddr(state *JobState) (string, error) {
+	myIP, err := tcp.GetOutboundIP()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine local IP: %w", err)
+	}
+
+	return fmt.Sprintf("%s:%d", myIP, state.RecvServer.Port()), nil
+}
+
+// startRecvServer 재시작 후에도 상대가 같은 주소로 보낼 수 있도록 포트를 job에 저장
+func (m *JobManager) startRecvServer(job model.Job, dir string, state *JobState) error {
 	recvPort := job.RecvPort
 	if recvPort == 0 {
 		port, err := findAvailablePort()
@@ -187,24 +321,38 @@ func (m *JobManager) startDelegatedJob(job model.Job, state *JobState) error {
 		}
 	}
 
-	srv, err := tcp.NewServer(job.DstPath, fmt.Sprintf(":%d", recvPort), m.nodeID, m.cfg.ConflictStrategy)
+	srv, err := tcp.NewServer(dir, fmt.Sprintf(":%d", recvPort), m.id, m.cfg.ConflictStrategy)
 	if err != nil {
 		return fmt.Errorf("failed to create receive server: %w", err)
 	}
+	srv.PreserveOwner(job.PreserveOwner)
+
+	// 받은 파일의 감시 이벤트를 상대에게 다시 보내지 않도록 파이프라인에서 걸러냄
+	if job.Bidirectional {
+		state.Echo = pipeline.NewEchoFilter()
+		srv.OnApplied(state.Echo.Received)
+	}
+
 	if err := srv.Start(); err != nil {
 		return fmt.Errorf("failed to start receive server: %w", err)
 	}
 
 	state.RecvServer = srv
+	return nil
+}
 
-	myIP, err := tcp.GetOutboundIP()
+func (m *JobManager) startDelegatedJob(job model.Job, state *JobState) error {
+	if err := m.startRecvServer(job, job.DstPath, state); err != nil {
+		return err
+	}
+
+	pushTo, err := recvAddr(state)
 	if err != nil {
-		srv.Stop()
-		return fmt.Errorf("failed to determine local IP: %w", err)
+		state.RecvServer.Stop()
+		return err
 	}
-	pushTo := fmt.Sprintf("%s:%d", myIP, recvPort)
 
-	if err := m.requestDelegationWithRetry(job, pushTo, state.StopCh); err != nil {
+	if err := m.requestDelegationWithRetry(job, pushTo, state); err != nil {
 		logger.Log.Warn("delegation not yet established, retrying in background",
 			zap.Uint("job", job.ID),
 			zap.Error(err))
@@ -214,19 +362,20 @@ func (m *JobManager) startDelegatedJob(job model.Job, state *JobState) error {
 		zap.Uint("id", job.ID),
 		zap.String("src", job.SrcPath),
 		zap.String("dst", job.DstPath),
-		zap.Int("receive_port", recvPort),
-		zap.String("push_to", pushTo))
+		zap.Int("receive_port", state.RecvServer.Port()),
+		zap.String("push_to", pushTo),
+		zap.Bool("bidirectional", job.Bidirectional))
 
 	return nil
 }
 
-func (m *JobManager) requestDelegationWithRetry(job model.Job, pushTo string, stopCh <-chan struct{}) error {
+func (m *JobManager) requestDelegationWithRetry(job model.Job, pushTo string, state *JobState) error {
 	err := retry.Do(context.Background(), retry.Config{
 		MaxAttempts: 3,
 		BaseDelay:   2 * time.Second,
 		MaxDelay:    30 * time.Second,
 	}, func(attempt int) error {
-		return m.requestDelegation(job, m.nodeID, pushTo)
+		return m.establish(job, pushTo, state)
 	})
 
 	if err == nil {
@@ -234,17 +383,17 @@ func (m *JobManager) requestDelegationWithRetry(job model.Job, pushTo string, st
 	}
 
 	// 재시도 3회 모두 실패시 백그라운드에서 계속 재시도
-	go m.keepRequestDelegation(job, pushTo, stopCh)
+	go m.keepRequestDelegation(job, pushTo, state)
 	return err
 }
 
-func (m *JobManager) keepRequestDelegation(job model.Job, pushTo string, stopCh <-chan struct{}) {
+func (m *JobManager) keepRequestDelegation(job model.Job, pushTo string, state *JobState) {
 	cfg := retry.Infinite
 	attempt := 0
 
 	for {
 		attempt++
-		err := m.requestDelegation(job, m.nodeID, pushTo)
+		err := m.establish(job, pushTo, state)
 		if err == nil {
 			logger.Log.Info("delegation established",
 				zap.Uint("job", job.ID),
@@ -260,7 +409,7 @@ func (m *JobManager) keepRequestDelegation(job model.Job, pushTo string, stopCh
 
 		delay := retry.Backoff(cfg.BaseDelay, cfg.MaxDelay, attempt)
 		select {
-		case <-stopCh:
+		case <-state.StopCh:
 			logger.Log.Info("delegation retry cancelled (job stopped)",
 				zap.Uint("job", job.ID))
 			return
@@ -269,16 +418,58 @@ func (m *JobManager) keepRequestDelegation(job model.Job, pushTo string, stopCh
 	}
 }
 
-func (m *JobManager) requestDelegation(job model.Job, nodeID, pushTo string) error {
+// establish delegation을 요청하고, 양방향 job이면 상대가 알려준 주소로 보내는 쪽도 시작
+func (m *JobManager) establish(job model.Job, pushTo string, state *JobState) error {
+	remoteAddr, err := m.requestDelegation(job, pushTo)
+	if err != nil {
+		return err
+	}
+
+	if !job.Bidirectional {
+		return nil
+	}
+
+	return m.startReturnPath(job, state, remoteAddr)
+}
+
+// RefreshDelegation 원격 src job의 설정이 바뀌면 보내는 쪽 데몬에 delegation을 다시 요청하여 전달
+func (m *JobManager) RefreshDelegation(job model.Job) error {
+	pushTo, err := m.RecvAddr(job.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.requestDelegation(job, pushTo)
+	return err
+}
+
+// requestDelegation 양방향 job이면 상대 데몬이 변경을 받을 주소를 반환
+func (m *JobManager) requestDelegation(job model.Job, pushTo string) (string, error) {
 	ep := tcp.ParseEndpoint(job.SrcPath)
 	if !ep.IsRemote() {
-		return fmt.Errorf("src is not a remote endpoint")
+		return "", fmt.Errorf("src is not a remote endpoint")
+	}
+
+	body, err := json.Marshal(delegateRequest{
+		Src:           ep.Path,
+		PushTo:        pushTo,
+		NodeID:        m.id.NodeID,
+		Bidirectional: job.Bidirectional,
+		Mirror:        job.Mirror,
+		Compress:      job.Compress,
+		RateLimit:     job.RateLimit,
+		RateWindows:   job.RateWindows,
+		Symlinks:      string(job.Symlinks),
+		Watch:         string(job.Watch),
+		PreserveOwner: job.PreserveOwner,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode delegation request: %w", err)
 	}
 
-	body := fmt.Sprintf(`{"src":"%s","push_to":"%s","node_id":"%s"}`, ep.Path, pushTo, nodeID)
-	resp, err := tcp.PostRemoteDaemon(ep.Host, "/jobs/delegate", nodeID, body)
+	resp, err := tcp.PostRemoteDaemon(ep.Host, "/jobs/delegate", m.id, string(body))
 	if err != nil {
-		return fmt.Errorf("failed to reach remote daemon at %s: %w", ep.Host, err)
+		return "", fmt.Errorf("failed to reach remote daemon at %s: %w", ep.Host, err)
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -288,18 +479,65 @@ func (m *JobManager) requestDelegation(job model.Job, nodeID, pushTo string) err
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		var result map[string]string
 		_ = json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("remote delegation rejected delegation: %s", result["error"])
+		return "", fmt.Errorf("remote delegation rejected delegation: %s", result["error"])
 	}
 
+	var result struct {
+		PushTo string `json:"push_to"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+
 	logger.Log.Info("delegation accepted",
 		zap.String("remote", ep.Host),
 		zap.String("src", ep.Path),
 		zap.String("push_to", pushTo))
 
+	return result.PushTo, nil
+}
+
+// startReturnPath 양방향 job에서 로컬 디렉터리의 변경을 상대 데몬의 수신 서버로 보냄
+func (m *JobManager) startReturnPath(job model.Job, state *JobState, remoteAddr string) error {
+	if remoteAddr == "" {
+		return fmt.Errorf("remote daemon did not return a receive address")
+	}
+
+	// 연결할 때마다 전체 동기화를 보내므로 멈춰 있던 동안의 변경을 따로 비교하지 않음
+	ig := ignore.New(job.DstPath, m.cfg.IgnoreList, m.cfg.Gitignore)
+	src, err := local.NewWatchSource(job.DstPath, job.Watch, m.cfg.BufferSize, m.cfg.PollInterval, job.Symlinks, nil, ig)
+	if err != nil {
+		return err
+	}
+
+	ix := index.New(job.ID, job.DstPath)
+	s, err := tcp.NewSyncer(job.DstPath, remoteAddr, m.id, tcp.Options{
+		Compress:      job.Compress,
+		Limiter:       state.Limiter,
+		Workers:       m.cfg.Workers,
+		Symlinks:      job.Symlinks,
+		Index:         ix,
+		Ignore:        ig,
+		PreserveOwner: job.PreserveOwner,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := src.Start(); err != nil {
+		return fmt.Errorf("failed to start source: %w", err)
+	}
+
+	go m.runPipeline(state, src, s, ix, ig)
+	go m.fullSync(job.ID, s)
+
+	logger.Log.Info("bidirectional sync started",
+		zap.Uint("id", job.ID),
+		zap.String("local", job.DstPath),
+		zap.String("remote", remoteAddr))
+
 	return nil
 }
 
-func (m *JobManager) runPipeline(state *JobState, src syncer.EventSource, s syncer.Syncer) {
+func (m *JobManager) runPipeline(state *JobState, src syncer.EventSource, s syncer.Syncer, ix *index.Index, ig *ignore.Matcher) {
 	defer func() {
 		src.Stop()
 
@@ -313,13 +551,23 @@ func (m *JobManager) runPipeline(state *JobState, src syncer.EventSource, s sync
 
 	eventCh := src.Events()
 
+	if ls, ok := src.(*local.Source); ok {
+		state.SetWatcher(ls)
+	}
+
 	var processedCh <-chan model.FileEvent
-	if _, ok := src.(*local.Source); ok {
+	switch src.(type) {
+	case *local.Source, *local.Poller:
 		debouncedCh := pipeline.Debounce(eventCh, 100*time.Millisecond)
-		filteredCh := pipeline.Filter(debouncedCh, m.cfg.IgnoreList)
-		processedCh = pipeline.NewChecksumFilter().Run(filteredCh)
-	} else {
-		processedCh = pipeline.Filter(eventCh, m.cfg.IgnoreList)
+		filteredCh := pipeline.Filter(debouncedCh, ig)
+		processedCh = pipeline.NewChecksumFilter(ix).Run(filteredCh)
+
+		// checksum 캐시가 받은 내용으로 갱신된 뒤에 걸러야 이후 로컬 변경을 놓치지 않음
+		if state.Echo != nil {
+			processedCh = state.Echo.Run(processedCh)
+		}
+	default:
+		processedCh = pipeline.Filter(eventCh, ig)
 	}
 
 	resultCh := s.Run(processedCh)
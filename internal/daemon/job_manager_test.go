@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"synco/internal/config"
+	"synco/internal/logger"
+	"synco/internal/peer"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestDelegatable(t *testing.T) {
+	root, other := t.TempDir(), t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// root 안에 있지만 밖을 가리키는 링크
+	if err := os.Symlink(other, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &JobManager{cfg: &config.Config{DelegateRoots: []string{root}}}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{root, true},
+		{filepath.Join(root, "a"), true},
+		{filepath.Join(root, "not-yet-created", "b"), true},
+		{filepath.Join(root, "link"), false},
+		{filepath.Join(root, "link", "x"), false},
+		{filepath.Join(root, "..", filepath.Base(other)), false},
+		{root + "-sibling", false},
+		{other, false},
+		{"relative/path", false},
+		{"/", false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Delegatable(tt.src); got != tt.want {
+			t.Errorf("Delegatable(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDelegatableWithoutRoots(t *testing.T) {
+	m := &JobManager{cfg: &config.Config{}}
+	if m.Delegatable(t.TempDir()) {
+		t.Error("src was delegatable with no delegate_roots configured")
+	}
+}
+
+func TestDelegatableThroughLinkedRoot(t *testing.T) {
+	real := t.TempDir()
+	link := filepath.Join(t.TempDir(), "root")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &JobManager{cfg: &config.Config{DelegateRoots: []string{link}}}
+	for _, src := range []string{filepath.Join(link, "new"), filepath.Join(real, "new")} {
+		if !m.Delegatable(src) {
+			t.Errorf("Delegatable(%q) = false under a linked root", src)
+		}
+	}
+}
+
+func TestDelegationOutsideRootsIsForbidden(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	s := &Server{manager: &JobManager{cfg: &config.Config{DelegateRoots: []string{t.TempDir()}}}}
+
+	// 따옴표가 든 경로도 그대로 src로 전달되어야 함
+	src := filepath.Join(t.TempDir(), `a","node_id":"x`)
+	body, err := json.Marshal(delegateRequest{Src: src, PushTo: "127.0.0.1:1", NodeID: "peer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, handle := range map[string]echo.HandlerFunc{
+		"delegate":  s.handleDelegate,
+		"push-once": s.handlePushOnce,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(peer.HeaderNodeID, "peer")
+		rec := httptest.NewRecorder()
+
+		err := handle(echo.New().NewContext(req, rec))
+
+		code := rec.Code
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			code = httpErr.Code
+		} else if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", name, code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"synco/internal/peer"
+)
+
+type pairRequest struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Proof   string `json:"proof"`
+}
+
+// Secret 이후 데몬 간 요청 서명에 사용. 인증서가 proof로 확인된 연결 안에서만 전달됨
+type pairResponse struct {
+	NodeID string `json:"node_id"`
+	Proof  string `json:"proof"`
+	Secret string `json:"secret"`
+}
+
+type pairedPeer struct {
+	NodeID      string
+	Fingerprint string
+	Secret      []byte
+}
+
+// requestPairing 원격 데몬에 페어링 코드로 만든 proof를 보내고, 응답의 proof로 상대를 확인
+func requestPairing(id *peer.Identity, address, code, advertise string) (pairedPeer, error) {
+	nodeID, fp, err := id.Probe(address)
+	if err != nil {
+		return pairedPeer{}, fmt.Errorf("failed to reach remote daemon at %s: %w", address, err)
+	}
+
+	body, err := json.Marshal(pairRequest{
+		NodeID:  id.NodeID,
+		Address: advertise,
+		Proof:   hex.EncodeToString(peer.Proof(code, "initiator", id.Fingerprint, fp)),
+	})
+	if err != nil {
+		return pairedPeer{}, err
+	}
+
+	// Probe와 같은 인증서일 때만 요청을 보냄
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: id.PinnedTLSConfig(fp),
+		},
+	}
+
+	url := fmt.Sprintf("https://%s/peers/pair/complete", address)
+	resp, err := client.Post(url, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return pairedPeer{}, fmt.Errorf("failed to reach remote daemon at %s: %w", address, err)
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return pairedPeer{}, fmt.Errorf("remote rejected pairing: %s", errResp["error"])
+	}
+
+	var result pairResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return pairedPeer{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	proof, err := hex.DecodeString(result.Proof)
+	if err != nil || !hmac.Equal(proof, peer.Proof(code, "responder", id.Fingerprint, fp)) {
+		return pairedPeer{}, fmt.Errorf("remote daemon could not prove the pairing code")
+	}
+
+	if result.NodeID != nodeID {
+		return pairedPeer{}, fmt.Errorf("remote node id %s does not match certificate %s", result.NodeID, nodeID)
+	}
+
+	secret, err := hex.DecodeString(result.Secret)
+	if err != nil || len(secret) != peer.SecretSize {
+		return pairedPeer{}, fmt.Errorf("remote daemon sent an invalid secret")
+	}
+
+	return pairedPeer{NodeID: nodeID, Fingerprint: fp, Secret: secret}, nil
+}
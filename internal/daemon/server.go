@@ -1,16 +1,24 @@
 package daemon
 
 import (
+	"bytes"
 	"context"
 	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"synco/internal/bandwidth"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/peer"
 	"synco/internal/repository"
+	"synco/internal/syncer/tcp"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,28 +26,44 @@ import (
 	"go.uber.org/zap"
 )
 
+// delegation 요청 본문은 작은 JSON이므로 서명 검증을 위해 읽을 크기를 제한
+const maxDelegateBody = 64 * 1024
+
+// errNotDelegatable delegate_roots 밖의 src를 위임하거나 한 번 보내 달라는 요청에 대한 응답
+const errNotDelegatable = "src is not under delegate_roots on the remote daemon"
+
 type Server struct {
 	echo      *echo.Echo
+	peerEcho  *echo.Echo
+	servers   []*http.Server
 	manager   *JobManager
 	jobRepo   *repository.JobRepository
 	histRepo  *repository.HistoryRepository
+	peerRepo  *repository.PeerRepository
+	fileRepo  *repository.FileStateRepository
+	pairing   *peer.Pairing
+	verifier  *peer.Verifier
 	port      int
+	peerAddr  string
 	creds     *Credentials
 	stopCh    chan struct{}
 	startedAt time.Time
 }
 
-func NewServer(manager *JobManager, port int, creds *Credentials) *Server {
-	e := echo.New()
-	e.HideBanner = true
-	e.Use(middleware.Recover())
-
+// NewServer 관리 API는 loopback의 port에서, 원격 데몬용 엔드포인트는 peerAddr에서 제공
+func NewServer(manager *JobManager, port int, peerAddr string, creds *Credentials) *Server {
 	s := &Server{
-		echo:      e,
+		echo:      newEcho(),
+		peerEcho:  newEcho(),
 		manager:   manager,
 		jobRepo:   repository.NewJobRepository(),
 		histRepo:  repository.NewHistoryRepository(),
+		peerRepo:  repository.NewPeerRepository(),
+		fileRepo:  repository.NewFileStateRepository(),
+		pairing:   peer.NewPairing(),
+		verifier:  peer.NewVerifier(),
 		port:      port,
+		peerAddr:  peerAddr,
 		creds:     creds,
 		stopCh:    make(chan struct{}, 1),
 		startedAt: time.Now(),
@@ -48,6 +72,14 @@ func NewServer(manager *JobManager, port int, creds *Credentials) *Server {
 	return s
 }
 
+func newEcho() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Use(middleware.Recover())
+	return e
+}
+
 func (s *Server) registerRoutes() {
 	authed := s.echo.Group("", s.authMiddleware())
 	// For the entire daemon
@@ -59,30 +91,51 @@ func (s *Server) registerRoutes() {
 	jobs := authed.Group("/jobs")
 	jobs.GET("", s.handleListJobs)
 	jobs.POST("", s.handleAddJob)
+	jobs.PATCH("/:id", s.handleUpdateJob)
 	jobs.DELETE("/:id", s.handleRemoveJob)
 	jobs.POST("/:id/pause", s.handlePauseJob)
 	jobs.POST("/:id/resume", s.handleResumeJob)
 
-	// Delegation은 원격에서 호출하므로 별도 로직 추가 적용
-	jobs.POST("/delegate", s.handleDelegate, s.delegateMiddleware())
-	jobs.POST("/push-once", s.handlePushOnce, s.delegateMiddleware())
+	// For paired peers
+	peers := authed.Group("/peers")
+	peers.GET("", s.handleListPeers)
+	peers.POST("", s.handleAddPeer)
+	peers.DELETE("/:node_id", s.handleRemovePeer)
+	peers.POST("/pair", s.handleStartPairing)
+
+	// 원격 데몬용 엔드포인트는 별도 리스너에서만 제공하고, 관리 API는 노출하지 않음
+	// 페어링 전이므로 인증서 검증 없이 받고, 페어링 코드로 만든 proof로 확인
+	s.peerEcho.POST("/peers/pair/complete", s.handleCompletePairing)
+
+	// Delegation은 토큰 대신 페어링된 노드의 인증서와 서명으로 인증
+	delegated := s.peerEcho.Group("/jobs", s.peerMiddleware(), s.delegateMiddleware())
+	delegated.POST("/delegate", s.handleDelegate)
+	delegated.POST("/push-once", s.handlePushOnce)
 }
 
 func (s *Server) Start() {
+	s.serve("daemon server", fmt.Sprintf("127.0.0.1:%d", s.port), s.echo, s.creds.TLSConfig)
+
+	if s.peerAddr != "" {
+		s.serve("peer server", s.peerAddr, s.peerEcho, s.creds.PeerTLSConfig)
+	}
+}
+
+func (s *Server) serve(name, addr string, handler http.Handler, tlsConfig *tls.Config) {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	s.servers = append(s.servers, srv)
+
 	go func() {
-		addr := fmt.Sprintf("127.0.0.1:%d", s.port)
-		logger.Log.Info("daemon server started",
+		logger.Log.Info(name+" started",
 			zap.String("addr", addr))
 
-		srv := &http.Server{
-			Addr:      addr,
-			Handler:   s.echo,
-			TLSConfig: s.creds.TLSConfig,
-		}
-
 		if err := srv.ListenAndServeTLS("", ""); err != nil &&
 			!errors.Is(err, http.ErrServerClosed) {
-			logger.Log.Error("daemon server error",
+			logger.Log.Error(name+" error",
 				zap.Error(err))
 		}
 	}()
@@ -90,7 +143,13 @@ func (s *Server) Start() {
 
 func (s *Server) Stop(ctx context.Context) error {
 	s.manager.StopAll()
-	return s.echo.Shutdown(ctx)
+
+	var errs []error
+	for _, srv := range s.servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+
+	return errors.Join(errs...)
 }
 
 func (s *Server) StopCh() <-chan struct{} {
@@ -117,23 +176,53 @@ func (s *Server) authMiddleware() echo.MiddlewareFunc {
 	}
 }
 
+// peerMiddleware 페어링된 노드의 인증서로 연결되었는지 확인
+func (s *Server) peerMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state := c.Request().TLS
+			if state == nil || len(state.PeerCertificates) == 0 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "client certificate required")
+			}
+
+			cert := state.PeerCertificates[0]
+			nodeID := cert.Subject.CommonName
+			if !s.creds.Identity.Trust.IsTrusted(nodeID, peer.Fingerprint(cert)) {
+				return echo.NewHTTPError(http.StatusForbidden, "unknown peer")
+			}
+
+			if header := c.Request().Header.Get(peer.HeaderNodeID); header != nodeID {
+				return echo.NewHTTPError(http.StatusForbidden, "node id does not match certificate")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// delegateMiddleware 페어링 때 교환한 secret으로 서명되었는지, 이미 처리한 요청은 아닌지 확인
 func (s *Server) delegateMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			tsStr := c.Request().Header.Get("X-Synco-Timestamp")
-			if tsStr == "" {
-				return echo.NewHTTPError(http.StatusBadRequest, "missing timestamp")
+			req := c.Request()
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, maxDelegateBody))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "failed to read body")
 			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
 
-			ts, err := strconv.ParseInt(tsStr, 10, 64)
+			secret, err := s.peerRepo.Secret(req.Header.Get(peer.HeaderNodeID))
 			if err != nil {
-				return echo.NewHTTPError(http.StatusBadRequest, "invalid timestamp")
+				return echo.NewHTTPError(http.StatusForbidden, err.Error())
 			}
 
-			// 5분 이상 지난 요청은 거부
-			age := time.Since(time.Unix(ts, 0))
-			if age > 5*time.Minute || age < -1*time.Minute {
-				return echo.NewHTTPError(http.StatusUnauthorized, "request expired")
+			if err := s.verifier.Verify(req, secret, body); err != nil {
+				logger.Log.Warn("rejected peer request",
+					zap.String("path", req.URL.Path),
+					zap.String("node_id", req.Header.Get(peer.HeaderNodeID)),
+					zap.Error(err))
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
 			}
 
 			return next(c)
@@ -144,8 +233,11 @@ func (s *Server) delegateMiddleware() echo.MiddlewareFunc {
 func (s *Server) handleStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]any{
 		"daemon": map[string]any{
-			"pid":        os.Getpid(),
-			"started_at": s.startedAt,
+			"pid":         os.Getpid(),
+			"started_at":  s.startedAt,
+			"node_id":     s.creds.Identity.NodeID,
+			"fingerprint": s.creds.Identity.Fingerprint,
+			"peer_addr":   s.peerAddr,
 		},
 		"jobs": s.manager.Snapshots(),
 	})
@@ -197,10 +289,18 @@ func (s *Server) handleListJobs(c echo.Context) error {
 }
 
 type addJobRequest struct {
-	Src     string             `json:"src"`
-	SrcType model.EndpointType `json:"src_type"`
-	Dst     string             `json:"dst"`
-	DstType model.EndpointType `json:"dst_type"`
+	Src           string             `json:"src"`
+	SrcType       model.EndpointType `json:"src_type"`
+	Dst           string             `json:"dst"`
+	DstType       model.EndpointType `json:"dst_type"`
+	Bidirectional bool               `json:"bidirectional"`
+	Mirror        bool               `json:"mirror"`
+	Compress      bool               `json:"compress"`
+	RateLimit     string             `json:"rate_limit"`
+	RateWindows   []string           `json:"rate_windows"`
+	Symlinks      string             `json:"symlinks"`
+	Watch         string             `json:"watch"`
+	PreserveOwner bool               `json:"preserve_owner"`
 }
 
 func (s *Server) handleAddJob(c echo.Context) error {
@@ -209,7 +309,83 @@ func (s *Server) handleAddJob(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "src and dst required"})
 	}
 
-	job, err := s.jobRepo.Add(req.Src, req.SrcType, req.Dst, req.DstType)
+	if req.Bidirectional {
+		// 양방향 job은 원격 쪽을 src로 두어 delegation으로 상대 데몬에도 job을 만듦
+		if req.SrcType == model.EndpointLocal && req.DstType == model.EndpointRemoteTCP {
+			req.Src, req.SrcType, req.Dst, req.DstType = req.Dst, req.DstType, req.Src, req.SrcType
+		}
+
+		if req.SrcType != model.EndpointRemoteTCP || req.DstType != model.EndpointLocal {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "bidirectional jobs need one local directory and one remote TCP endpoint",
+			})
+		}
+	}
+
+	if req.Mirror {
+		tcpJob := req.SrcType == model.EndpointRemoteTCP || req.DstType == model.EndpointRemoteTCP
+		if !tcpJob || req.Bidirectional {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "mirror is only supported for one-way remote TCP jobs",
+			})
+		}
+	}
+
+	if req.Compress && req.SrcType != model.EndpointRemoteTCP && req.DstType != model.EndpointRemoteTCP {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "compress is only supported for remote TCP jobs",
+		})
+	}
+
+	rateLimit, rateWindows, err := parseBandwidth(req.RateLimit, req.RateWindows)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	symlinks, err := model.ParseSymlinkPolicy(req.Symlinks)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	cloudJob := req.SrcType == model.EndpointGDrive || req.SrcType == model.EndpointDropbox ||
+		req.DstType == model.EndpointGDrive || req.DstType == model.EndpointDropbox
+	if req.Symlinks != "" && cloudJob {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "symlinks is only supported for local and remote TCP jobs",
+		})
+	}
+
+	if req.PreserveOwner && cloudJob {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "preserve_owner is only supported for local and remote TCP jobs",
+		})
+	}
+
+	watch, err := model.ParseWatchMode(req.Watch)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if req.Watch != "" && (req.SrcType == model.EndpointGDrive || req.SrcType == model.EndpointDropbox) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "watch is only supported for local and remote TCP sources",
+		})
+	}
+
+	job, err := s.jobRepo.Add(model.Job{
+		SrcType:       req.SrcType,
+		SrcPath:       req.Src,
+		DstType:       req.DstType,
+		DstPath:       req.Dst,
+		Bidirectional: req.Bidirectional,
+		Mirror:        req.Mirror,
+		Compress:      req.Compress,
+		RateLimit:     rateLimit,
+		RateWindows:   rateWindows,
+		Symlinks:      symlinks,
+		Watch:         watch,
+		PreserveOwner: req.PreserveOwner,
+	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -224,9 +400,17 @@ func (s *Server) handleAddJob(c echo.Context) error {
 }
 
 type delegateRequest struct {
-	Src    string `json:"src"`
-	PushTo string `json:"push_to"`
-	NodeID string `json:"node_id"`
+	Src           string `json:"src"`
+	PushTo        string `json:"push_to"`
+	NodeID        string `json:"node_id"`
+	Bidirectional bool   `json:"bidirectional"`
+	Mirror        bool   `json:"mirror"`
+	Compress      bool   `json:"compress"`
+	RateLimit     int64  `json:"rate_limit"`
+	RateWindows   string `json:"rate_windows"`
+	Symlinks      string `json:"symlinks"`
+	Watch         string `json:"watch"`
+	PreserveOwner bool   `json:"preserve_owner"`
 }
 
 func (s *Server) handleDelegate(c echo.Context) error {
@@ -235,6 +419,32 @@ func (s *Server) handleDelegate(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "src and push_to required"})
 	}
 
+	if _, err := bandwidth.ParseWindows(req.RateWindows); err != nil || req.RateLimit < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid bandwidth settings"})
+	}
+
+	symlinks, err := model.ParseSymlinkPolicy(req.Symlinks)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	watch, err := model.ParseWatchMode(req.Watch)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if req.NodeID != c.Request().Header.Get(peer.HeaderNodeID) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "node id does not match certificate"})
+	}
+
+	// 이 노드에서 허용하지 않은 디렉터리를 상대가 읽거나 쓰게 하지 않음
+	if !s.manager.Delegatable(req.Src) {
+		logger.Log.Warn("rejected delegation outside delegate_roots",
+			zap.String("src", req.Src),
+			zap.String("requested_by", req.NodeID))
+		return c.JSON(http.StatusForbidden, map[string]string{"error": errNotDelegatable})
+	}
+
 	jobs, err := s.jobRepo.GetAll()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -242,11 +452,39 @@ func (s *Server) handleDelegate(c echo.Context) error {
 
 	for _, j := range jobs {
 		if j.SrcPath == req.Src && j.DstPath == req.PushTo {
-			return c.JSON(http.StatusOK, map[string]string{"status": "already exists"})
+			// 받는 쪽에서 바꾼 속도 설정은 다시 연결할 때 전달됨
+			if j.RateLimit != req.RateLimit || j.RateWindows != req.RateWindows {
+				if err := s.updateBandwidth(j, req.RateLimit, req.RateWindows); err != nil {
+					logger.Log.Warn("failed to update delegated job bandwidth",
+						zap.Uint("job", j.ID),
+						zap.Error(err))
+				}
+			}
+
+			// 상대 데몬이 다시 연결되면 그동안의 변경을 보냄
+			if !j.Bidirectional {
+				go s.manager.RunInitialSync(j)
+				return c.JSON(http.StatusOK, map[string]string{"status": "already exists"})
+			}
+
+			return s.replyBidirectional(c, http.StatusOK, j, "already exists")
 		}
 	}
 
-	job, err := s.jobRepo.Add(req.Src, model.EndpointLocal, req.PushTo, model.EndpointRemoteTCP)
+	job, err := s.jobRepo.Add(model.Job{
+		SrcType:       model.EndpointLocal,
+		SrcPath:       req.Src,
+		DstType:       model.EndpointRemoteTCP,
+		DstPath:       req.PushTo,
+		Bidirectional: req.Bidirectional,
+		Mirror:        req.Mirror && !req.Bidirectional,
+		Compress:      req.Compress,
+		RateLimit:     req.RateLimit,
+		RateWindows:   req.RateWindows,
+		Symlinks:      symlinks,
+		Watch:         watch,
+		PreserveOwner: req.PreserveOwner,
+	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -258,11 +496,123 @@ func (s *Server) handleDelegate(c echo.Context) error {
 	logger.Log.Info("delegated job started",
 		zap.String("src", req.Src),
 		zap.String("push_to", req.PushTo),
-		zap.String("requested_by", req.NodeID))
+		zap.String("requested_by", req.NodeID),
+		zap.Bool("bidirectional", req.Bidirectional))
+
+	if job.Bidirectional {
+		return s.replyBidirectional(c, http.StatusCreated, job, "created")
+	}
+
+	go s.manager.RunInitialSync(job)
 
 	return c.JSON(http.StatusCreated, job)
 }
 
+func (s *Server) replyBidirectional(c echo.Context, code int, job model.Job, status string) error {
+	addr, err := s.manager.RecvAddr(job.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	go s.manager.RunInitialSync(job)
+
+	return c.JSON(code, map[string]string{
+		"status":  status,
+		"push_to": addr,
+	})
+}
+
+type updateJobRequest struct {
+	RateLimit   *string   `json:"rate_limit"`
+	RateWindows *[]string `json:"rate_windows"`
+}
+
+// handleUpdateJob 보낸 항목만 바꿈. 실행 중인 job에도 바로 적용
+func (s *Server) handleUpdateJob(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	var req updateJobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	job, err := s.jobRepo.GetByID(uint(id))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+
+	rateLimit, rateWindows := job.RateLimit, job.RateWindows
+	if req.RateLimit != nil {
+		if rateLimit, err = bandwidth.ParseRate(*req.RateLimit); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if req.RateWindows != nil {
+		if _, rateWindows, err = parseBandwidth("", *req.RateWindows); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := s.updateBandwidth(job, rateLimit, rateWindows); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	job.RateLimit, job.RateWindows = rateLimit, rateWindows
+
+	// 원격 src job은 상대 데몬이 보내므로 delegation을 다시 요청하여 설정을 전달
+	if job.SrcType == model.EndpointRemoteTCP {
+		go func(job model.Job) {
+			if err := s.manager.RefreshDelegation(job); err != nil {
+				logger.Log.Warn("failed to send bandwidth settings to remote daemon",
+					zap.Uint("job", job.ID),
+					zap.Error(err))
+			}
+		}(job)
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+func (s *Server) updateBandwidth(job model.Job, rateLimit int64, rateWindows string) error {
+	if err := s.jobRepo.UpdateBandwidth(job.ID, rateLimit, rateWindows); err != nil {
+		return err
+	}
+
+	job.RateLimit, job.RateWindows = rateLimit, rateWindows
+	s.manager.SetBandwidth(job)
+
+	logger.Log.Info("job bandwidth updated",
+		zap.Uint("id", job.ID),
+		zap.String("rate_limit", bandwidth.FormatRate(rateLimit)),
+		zap.String("rate_windows", rateWindows))
+
+	return nil
+}
+
+// parseBandwidth API로 받은 속도와 창을 검증하고 job에 저장할 형식으로 바꿈
+func parseBandwidth(rate string, windows []string) (int64, string, error) {
+	rateLimit, err := bandwidth.ParseRate(rate)
+	if err != nil {
+		return 0, "", err
+	}
+
+	parsed := make([]bandwidth.Window, 0, len(windows))
+	for _, w := range windows {
+		window, err := bandwidth.ParseWindow(w)
+		if err != nil {
+			return 0, "", err
+		}
+
+		parsed = append(parsed, window)
+	}
+
+	return rateLimit, bandwidth.FormatWindows(parsed), nil
+}
+
 func (s *Server) handleRemoveJob(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -275,6 +625,13 @@ func (s *Server) handleRemoveJob(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
+	// 남은 기록은 다시 쓰이지 않으므로 지우지 못해도 삭제는 성공으로 봄
+	if err := s.fileRepo.DeleteJob(uint(id)); err != nil {
+		logger.Log.Warn("failed to delete file index",
+			zap.Uint64("job", id),
+			zap.Error(err))
+	}
+
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -306,19 +663,170 @@ func (s *Server) handleResumeJob(c echo.Context) error {
 
 func (s *Server) handlePushOnce(c echo.Context) error {
 	var req struct {
-		Src    string `json:"src"`
-		PushTo string `json:"push_to"`
-		NodeID string `json:"node_id"`
+		Src           string `json:"src"`
+		PushTo        string `json:"push_to"`
+		NodeID        string `json:"node_id"`
+		Mirror        bool   `json:"mirror"`
+		Compress      bool   `json:"compress"`
+		Symlinks      string `json:"symlinks"`
+		PreserveOwner bool   `json:"preserve_owner"`
 	}
 
 	if err := c.Bind(&req); err != nil || req.Src == "" || req.PushTo == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "src and push_to required")
 	}
 
-	results, err := s.manager.PushOnce(req.Src, req.PushTo, req.NodeID)
+	symlinks, err := model.ParseSymlinkPolicy(req.Symlinks)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.NodeID != c.Request().Header.Get(peer.HeaderNodeID) {
+		return echo.NewHTTPError(http.StatusForbidden, "node id does not match certificate")
+	}
+
+	if !s.manager.Delegatable(req.Src) {
+		logger.Log.Warn("rejected push-once outside delegate_roots",
+			zap.String("src", req.Src),
+			zap.String("requested_by", req.NodeID))
+		return echo.NewHTTPError(http.StatusForbidden, errNotDelegatable)
+	}
+
+	results, err := s.manager.PushOnce(req.Src, req.PushTo, tcp.Options{Mirror: req.Mirror, Compress: req.Compress, Symlinks: symlinks, PreserveOwner: req.PreserveOwner})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.JSON(http.StatusOK, map[string]any{"results": results})
 }
+
+func (s *Server) handleListPeers(c echo.Context) error {
+	peers, err := s.peerRepo.GetAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, peers)
+}
+
+func (s *Server) handleStartPairing(c echo.Context) error {
+	code, expiresAt, err := s.pairing.NewCode()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"code":        code,
+		"expires_at":  expiresAt,
+		"node_id":     s.creds.Identity.NodeID,
+		"fingerprint": s.creds.Identity.Fingerprint,
+	})
+}
+
+type addPeerRequest struct {
+	Address string `json:"address"`
+	Code    string `json:"code"`
+}
+
+func (s *Server) handleAddPeer(c echo.Context) error {
+	var req addPeerRequest
+	if err := c.Bind(&req); err != nil || req.Address == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "address and code required"})
+	}
+
+	// 상대가 이 노드에 delegation을 요청할 때 사용할 peer 리스너 주소
+	advertise := ""
+	if _, port, err := net.SplitHostPort(s.peerAddr); err == nil {
+		if ip, err := tcp.GetOutboundIP(); err == nil {
+			advertise = net.JoinHostPort(ip, port)
+		}
+	}
+
+	paired, err := requestPairing(s.creds.Identity, req.Address, req.Code, advertise)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	p, err := s.peerRepo.Save(paired.NodeID, req.Address, paired.Fingerprint, paired.Secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	logger.Log.Info("peer paired",
+		zap.String("node_id", p.NodeID),
+		zap.String("address", p.Address))
+
+	return c.JSON(http.StatusCreated, p)
+}
+
+func (s *Server) handleCompletePairing(c echo.Context) error {
+	state := c.Request().TLS
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "client certificate required"})
+	}
+
+	cert := state.PeerCertificates[0]
+	fp := peer.Fingerprint(cert)
+
+	var req pairRequest
+	if err := c.Bind(&req); err != nil || req.NodeID == "" || req.Proof == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "node_id and proof required"})
+	}
+
+	if req.NodeID != cert.Subject.CommonName {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "node id does not match certificate"})
+	}
+
+	proof, err := hex.DecodeString(req.Proof)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid proof"})
+	}
+
+	code, err := s.pairing.Verify(proof, fp, s.creds.Identity.Fingerprint)
+	if err != nil {
+		logger.Log.Warn("pairing rejected",
+			zap.String("node_id", req.NodeID),
+			zap.String("remote", c.RealIP()),
+			zap.Error(err))
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	address := req.Address
+	if address == "" {
+		address = c.RealIP()
+	}
+
+	secret, err := peer.NewSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := s.peerRepo.Save(req.NodeID, address, fp, secret); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	logger.Log.Info("peer paired",
+		zap.String("node_id", req.NodeID),
+		zap.String("address", address))
+
+	return c.JSON(http.StatusOK, pairResponse{
+		NodeID: s.creds.Identity.NodeID,
+		Proof:  hex.EncodeToString(peer.Proof(code, "responder", fp, s.creds.Identity.Fingerprint)),
+		Secret: hex.EncodeToString(secret),
+	})
+}
+
+func (s *Server) handleRemovePeer(c echo.Context) error {
+	nodeID := c.Param("node_id")
+
+	removed, err := s.peerRepo.Delete(nodeID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if removed == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "peer not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,7 +2,10 @@ package daemon
 
 import (
 	"sync"
+	"synco/internal/bandwidth"
 	"synco/internal/model"
+	"synco/internal/pipeline"
+	"synco/internal/syncer/local"
 	"synco/internal/syncer/tcp"
 	"time"
 )
@@ -21,6 +24,11 @@ type JobState struct {
 	ResumeCh   chan struct{}
 	StopCh     chan struct{}
 	RecvServer *tcp.Server
+	Echo       *pipeline.EchoFilter
+	// Limiter job의 모든 전송이 함께 쓰는 속도 제한
+	Limiter *bandwidth.Limiter
+	// Watcher local src의 감시. 놓친 이벤트 수를 보여 주기 위해 가짐
+	Watcher *local.Source
 }
 
 func NewJobState(job model.Job) *JobState {
@@ -33,6 +41,17 @@ func NewJobState(job model.Job) *JobState {
 		PauseCh:   make(chan struct{}, 1),
 		ResumeCh:  make(chan struct{}, 1),
 		StopCh:    make(chan struct{}, 1),
+		Limiter:   bandwidth.NewLimiter(scheduleOf(job)),
+	}
+}
+
+// scheduleOf job에 저장된 속도 설정. 저장할 때 검증하므로 읽지 못한 창은 무시
+func scheduleOf(job model.Job) bandwidth.Schedule {
+	windows, _ := bandwidth.ParseWindows(job.RateWindows)
+
+	return bandwidth.Schedule{
+		Rate:    job.RateLimit,
+		Windows: windows,
 	}
 }
 
@@ -48,6 +67,12 @@ func (s *JobState) RecordSync(result model.SyncResult) {
 	}
 }
 
+func (s *JobState) SetWatcher(src *local.Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Watcher = src
+}
+
 func (s *JobState) SetStatus(status model.JobStatus) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -58,7 +83,7 @@ func (s *JobState) Snapshot() model.JobSnapshot {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return model.JobSnapshot{
+	snap := model.JobSnapshot{
 		JobID:     s.JobID,
 		Src:       s.Src,
 		Dst:       s.Dst,
@@ -68,4 +93,11 @@ func (s *JobState) Snapshot() model.JobSnapshot {
 		Failed:    s.Failed,
 		LastSync:  s.LastSync,
 	}
+
+	if s.Watcher != nil {
+		snap.LostEvents = s.Watcher.Lost()
+		snap.Rescans = s.Watcher.Rescans()
+	}
+
+	return snap
 }
@@ -20,7 +20,7 @@ func Init(dbPath string) error {
 		return fmt.Errorf("failed to open db: %w", err)
 	}
 
-	if err := DB.AutoMigrate(&model.History{}, &model.Job{}); err != nil {
+	if err := DB.AutoMigrate(&model.History{}, &model.Job{}, &model.Peer{}, &model.FileVersion{}, &model.FileState{}); err != nil {
 		return fmt.Errorf("failed to migrate: %w", err)
 	}
 
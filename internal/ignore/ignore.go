@@ -0,0 +1,280 @@
+package ignore
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"synco/internal/logger"
+	"synco/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// FileName 이 파일이 있는 디렉터리 아래에서 무시할 경로를 gitignore 형식으로 적음
+	FileName      = ".syncoignore"
+	gitignoreName = ".gitignore"
+)
+
+// Matcher job 하나의 src 아래에서 무시할 경로를 gitignore 규칙으로 정함.
+// 전역 ignore_list는 src 최상위의 무시 파일처럼 다루고, 디렉터리마다 있는 무시 파일이 그 아래에서 앞의 규칙보다 우선함.
+// root가 비어 있으면 원격 src의 상대 경로를 받으며 무시 파일은 읽지 않음. nil이면 아무것도 무시하지 않음
+type Matcher struct {
+	root      string
+	patterns  []string
+	global    []rule
+	gitignore bool
+	// read 무시 파일을 root 아래에서 읽는지. 상대에게 받은 규칙으로 만들었으면 false
+	read bool
+
+	mu sync.Mutex
+	// dirs 디렉터리별로 읽은 무시 파일의 규칙. root 기준 상대 경로이고 root는 ""
+	dirs map[string][]rule
+	// lines 디렉터리별로 읽은 무시 파일의 줄. 상대에게 보낼 때 씀
+	lines map[string][]string
+}
+
+// Rules 다른 노드에 보내는 규칙. Files는 디렉터리별 무시 파일의 줄로, 키는 root 기준 상대 경로이고 root는 ""
+type Rules struct {
+	Patterns []string
+	Files    map[string][]string
+}
+
+// New gitignore이면 .syncoignore와 함께 .gitignore도 읽음. 같은 디렉터리에서는 .syncoignore가 우선
+func New(root string, patterns []string, gitignore bool) *Matcher {
+	if root != "" {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			root = absRoot
+		}
+	}
+
+	m := &Matcher{
+		root:      root,
+		patterns:  patterns,
+		gitignore: gitignore,
+		read:      root != "",
+		dirs:      make(map[string][]rule),
+		lines:     make(map[string][]string),
+	}
+
+	for _, p := range patterns {
+		if r, ok := parseRule(p, ""); ok {
+			m.global = append(m.global, r)
+		}
+	}
+
+	return m
+}
+
+// FromRules 상대에게 받은 규칙을 root 아래의 경로에 적용. root의 무시 파일은 읽지 않음
+func FromRules(root string, rules Rules) *Matcher {
+	m := New(root, rules.Patterns, false)
+	m.read = false
+
+	for dir, lines := range rules.Files {
+		m.dirs[dir] = parseLines(lines, dir)
+		m.lines[dir] = lines
+	}
+
+	return m
+}
+
+// Rules 지금까지 읽은 무시 파일의 규칙. 전체 동기화에서 src를 훑은 뒤에 부르면 훑은 모든 디렉터리의 규칙이 담김
+func (m *Matcher) Rules() Rules {
+	if m == nil {
+		return Rules{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := Rules{
+		Patterns: m.patterns,
+		Files:    make(map[string][]string, len(m.lines)),
+	}
+
+	for dir, lines := range m.lines {
+		if len(lines) > 0 {
+			rules.Files[dir] = lines
+		}
+	}
+
+	return rules
+}
+
+// Ignored 상위 디렉터리가 무시되면 그 아래는 다시 포함하는 규칙이 있어도 무시함
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	rel, ok := m.rel(path)
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(parts[:i], true) {
+			return true
+		}
+	}
+
+	return m.match(parts, isDir)
+}
+
+// WalkFunc 무시하는 항목은 fn에 넘기지 않고, 무시하는 디렉터리는 그 아래로 들어가지 않음
+func (m *Matcher) WalkFunc(fn fs.WalkDirFunc) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d != nil && m.Ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return fn(path, d, err)
+	}
+}
+
+// Invalidate 무시 파일이 바뀌었거나 디렉터리가 지워지거나 옮겨졌으면 다음에 다시 읽도록 기억한 규칙을 지움
+func (m *Matcher) Invalidate(event model.FileEvent) {
+	if m == nil || !m.read {
+		return
+	}
+
+	for _, p := range []string{event.Path, event.OldPath} {
+		if p == "" {
+			continue
+		}
+
+		if name := filepath.Base(p); name == FileName || name == gitignoreName {
+			if rel, ok := m.rel(filepath.Dir(p)); ok {
+				m.forget(rel, false)
+			}
+		}
+
+		if event.IsDir && event.Type != model.EventCreate && event.Type != model.EventWrite {
+			if rel, ok := m.rel(p); ok {
+				m.forget(rel, true)
+			}
+		}
+	}
+}
+
+// match 마지막으로 맞은 규칙을 따름. 전역 규칙 다음에 위쪽 디렉터리부터 무시 파일의 규칙을 봄
+func (m *Matcher) match(parts []string, isDir bool) bool {
+	ignored := false
+	apply := func(rules []rule) {
+		for _, r := range rules {
+			if r.matches(parts, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+
+	apply(m.global)
+	if m.root == "" {
+		return ignored
+	}
+
+	for i := 0; i < len(parts); i++ {
+		apply(m.rulesOf(strings.Join(parts[:i], "/")))
+	}
+
+	return ignored
+}
+
+func (m *Matcher) rulesOf(dir string) []rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.dirs[dir]; ok || !m.read {
+		return rules
+	}
+
+	var lines []string
+	if m.gitignore {
+		lines = append(lines, m.load(dir, gitignoreName)...)
+	}
+	lines = append(lines, m.load(dir, FileName)...)
+
+	rules := parseLines(lines, dir)
+	m.dirs[dir] = rules
+	m.lines[dir] = lines
+	return rules
+}
+
+func parseLines(lines []string, dir string) []rule {
+	var rules []rule
+	for _, line := range lines {
+		if r, ok := parseRule(line, dir); ok {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules
+}
+
+func (m *Matcher) load(dir, name string) []string {
+	f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(dir), name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Log.Warn("failed to read ignore file",
+				zap.String("dir", dir),
+				zap.String("name", name),
+				zap.Error(err))
+		}
+		return nil
+	}
+
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
+
+// forget tree이면 dir 아래 디렉터리의 규칙도 지움
+func (m *Matcher) forget(dir string, tree bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.dirs, dir)
+	delete(m.lines, dir)
+	if !tree {
+		return
+	}
+
+	for d := range m.dirs {
+		if strings.HasPrefix(d, dir+"/") {
+			delete(m.dirs, d)
+			delete(m.lines, d)
+		}
+	}
+}
+
+// rel root 기준의 /로 구분한 상대 경로. root 자신이거나 root 밖이면 false
+func (m *Matcher) rel(p string) (string, bool) {
+	if m.root == "" {
+		rel := strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+		return rel, rel != "" && rel != "." && rel != ".." && !strings.HasPrefix(rel, "../")
+	}
+
+	rel, err := filepath.Rel(m.root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,159 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatcherIgnored(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	root := t.TempDir()
+	writeFile(t, root, FileName, "/build/\n**/*.log\n!keep.log\n# comment\ndocs/*.md\nfoo/**\n")
+	writeFile(t, root, "sub/"+FileName, "!a.log\nlocal\n")
+	writeFile(t, root, gitignoreName, "secret\n")
+
+	m := New(root, []string{"*.tmp", ".git"}, false)
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"build", true, true},
+		{"build/x.o", false, true},
+		{"a/build", true, false},
+		{"build", false, false},
+		{"x.log", false, true},
+		{"a/b/x.log", false, true},
+		{"keep.log", false, false},
+		{"a/keep.log", false, false},
+		{"sub/a.log", false, false},
+		{"sub/b.log", false, true},
+		{"sub/local", false, true},
+		{"local", false, false},
+		{"docs/a.md", false, true},
+		{"docs/x/a.md", false, false},
+		{"foo", true, false},
+		{"foo/x", false, true},
+		{"a.tmp", false, true},
+		{".git/config", false, true},
+		// gitignore가 꺼져 있으면 .gitignore는 읽지 않음
+		{"secret", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Ignored(filepath.Join(root, filepath.FromSlash(tt.rel)), tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherReadsGitignore(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	root := t.TempDir()
+	writeFile(t, root, gitignoreName, "secret\n")
+
+	if !New(root, nil, true).Ignored(filepath.Join(root, "secret"), false) {
+		t.Error("path in .gitignore was not ignored")
+	}
+}
+
+func TestMatcherInvalidate(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	root := t.TempDir()
+	writeFile(t, root, "sub/"+FileName, "local\n")
+
+	m := New(root, nil, false)
+	path := filepath.Join(root, "sub", "x", "keep")
+	if m.Ignored(path, false) {
+		t.Fatalf("%s ignored before the rule was added", path)
+	}
+
+	// 무시한 디렉터리 아래는 다시 포함할 수 없음
+	writeFile(t, root, "sub/"+FileName, "local\nx/\n!x/keep\n")
+	m.Invalidate(model.FileEvent{Type: model.EventWrite, Path: filepath.Join(root, "sub", FileName)})
+
+	if !m.Ignored(path, false) {
+		t.Errorf("%s not ignored after the ignore file changed", path)
+	}
+}
+
+func TestMatcherFromRules(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	src := t.TempDir()
+	writeFile(t, src, "sub/"+FileName, "*.bak\n")
+	writeFile(t, src, "sub/a.bak", "")
+
+	m := New(src, []string{"/build/"}, false)
+	if !m.Ignored(filepath.Join(src, "sub", "a.bak"), false) {
+		t.Fatal("sub/a.bak was not ignored at src")
+	}
+
+	// 받는 쪽에서는 자기 무시 파일이 아니라 받은 규칙을 따름
+	dst := t.TempDir()
+	writeFile(t, dst, FileName, "*\n")
+	r := FromRules(dst, m.Rules())
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"sub/a.bak", true},
+		{"a.bak", false},
+		{"build/x", true},
+		{"a/build/x", false},
+		{"other.txt", false},
+	}
+
+	for _, tt := range tests {
+		if got := r.Ignored(filepath.Join(dst, filepath.FromSlash(tt.rel)), false); got != tt.want {
+			t.Errorf("Ignored(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherRelativePaths(t *testing.T) {
+	m := New("", []string{"/build/", "*.log"}, false)
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"build/a", true},
+		{"a/build/a", false},
+		{"a/b.log", true},
+		{"a/b.txt", false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Ignored(tt.rel, false); got != tt.want {
+			t.Errorf("Ignored(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+
+	var nilMatcher *Matcher
+	if nilMatcher.Ignored("a.log", false) {
+		t.Error("nil matcher ignored a path")
+	}
+}
@@ -0,0 +1,118 @@
+package ignore
+
+import (
+	"path"
+	"strings"
+)
+
+// rule 무시 파일의 한 줄. base는 무시 파일이 있는 디렉터리로, 규칙은 그 아래 경로에만 적용됨
+type rule struct {
+	base     []string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// parseRule 빈 줄과 #으로 시작하는 주석은 false
+func parseRule(line, base string) (rule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// 뒤쪽 공백은 \로 이스케이프한 것만 남김
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	var r rule
+	if base != "" {
+		r.base = strings.Split(base, "/")
+	}
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return rule{}, false
+	}
+
+	// 앞이나 가운데에 /가 있으면 base 기준으로 고정하고, 없으면 어느 깊이의 이름과도 맞춤
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if !anchored {
+		line = "**/" + line
+	}
+
+	// gitignore의 [!...]는 path.Match에서 [^...]
+	line = strings.ReplaceAll(line, "[!", "[^")
+
+	for _, seg := range strings.Split(line, "/") {
+		if seg != "" {
+			r.segments = append(r.segments, seg)
+		}
+	}
+
+	return r, len(r.segments) > 0
+}
+
+// matches parts는 root 기준 경로를 /로 나눈 것
+func (r rule) matches(parts []string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if len(parts) <= len(r.base) {
+		return false
+	}
+
+	for i, seg := range r.base {
+		if parts[i] != seg {
+			return false
+		}
+	}
+
+	return matchSegments(r.segments, parts[len(r.base):])
+}
+
+// matchSegments **는 0개 이상의 디렉터리와 맞음. 끝의 **는 그 아래의 모든 것과 맞지만 디렉터리 자신과는 맞지 않음
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(name) > 0
+			}
+
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
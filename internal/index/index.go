@@ -0,0 +1,185 @@
+package index
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"synco/internal/repository"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Index job 하나의 파일 상태 기록. 데몬을 다시 시작해도 남아 있어, 마지막으로 동기화한 뒤
+// 크기와 수정 시각이 그대로인 파일은 다시 해시하거나 보내지 않음.
+// 메서드는 root 아래의 로컬 경로를 받음. nil이면 기록하지 않고 모든 파일을 바뀐 것으로 봄
+type Index struct {
+	jobID uint
+	root  string
+	repo  *repository.FileStateRepository
+}
+
+func New(jobID uint, root string) *Index {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		absRoot = root
+	}
+
+	return &Index{
+		jobID: jobID,
+		root:  absRoot,
+		repo:  repository.NewFileStateRepository(),
+	}
+}
+
+// Lookup 기록이 없으면 false
+func (ix *Index) Lookup(path string) (model.FileState, bool) {
+	if ix == nil {
+		return model.FileState{}, false
+	}
+
+	rel, ok := ix.rel(path)
+	if !ok {
+		return model.FileState{}, false
+	}
+
+	state, err := ix.repo.Get(ix.jobID, rel)
+	if err != nil {
+		logger.Log.Warn("failed to load file state",
+			zap.String("path", path),
+			zap.Error(err))
+		return model.FileState{}, false
+	}
+
+	return state, state.ID != 0
+}
+
+// States dir 아래의 기록을 로컬 경로별로 반환. dir이 root이면 모든 기록
+func (ix *Index) States(dir string) (map[string]model.FileState, error) {
+	if ix == nil {
+		return nil, nil
+	}
+
+	var states []model.FileState
+	var err error
+	if rel, ok := ix.rel(dir); ok {
+		states, err = ix.repo.GetTree(ix.jobID, rel)
+	} else {
+		states, err = ix.repo.GetAll(ix.jobID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]model.FileState, len(states))
+	for _, state := range states {
+		byPath[filepath.Join(ix.root, filepath.FromSlash(state.Path))] = state
+	}
+
+	return byPath, nil
+}
+
+// Unchanged 마지막으로 동기화한 뒤 크기와 수정 시각이 그대로이면 그때의 기록을 반환
+func (ix *Index) Unchanged(path string, info os.FileInfo) (model.FileState, bool) {
+	state, ok := ix.Lookup(path)
+	if !ok || state.Size != info.Size() || !state.ModTime.Equal(info.ModTime()) {
+		return state, false
+	}
+
+	return state, true
+}
+
+// Hash 바뀌지 않은 파일이면 기록된 내용의 해시
+func (ix *Index) Hash(path string, info os.FileInfo) ([]byte, bool) {
+	state, ok := ix.Unchanged(path, info)
+	if !ok || state.Hash == "" {
+		return nil, false
+	}
+
+	sum, err := hex.DecodeString(state.Hash)
+	return sum, err == nil
+}
+
+// Record 동기화한 파일의 상태를 기록. 기록하지 못해도 다음 전체 동기화에서 다시 보낼 뿐이므로 경고만 남김
+func (ix *Index) Record(path string, info os.FileInfo, hash []byte, remoteID, remoteRev string) {
+	if ix == nil {
+		return
+	}
+
+	rel, ok := ix.rel(path)
+	if !ok {
+		return
+	}
+
+	state := model.FileState{
+		JobID:     ix.jobID,
+		Path:      rel,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Hash:      hex.EncodeToString(hash),
+		RemoteID:  remoteID,
+		RemoteRev: remoteRev,
+		SyncedAt:  time.Now(),
+	}
+
+	if err := ix.repo.Save(&state); err != nil {
+		logger.Log.Warn("failed to save file state",
+			zap.String("path", path),
+			zap.Error(err))
+	}
+}
+
+// Forget path와 그 아래 경로의 기록을 지움
+func (ix *Index) Forget(path string) {
+	if ix == nil {
+		return
+	}
+
+	rel, ok := ix.rel(path)
+	if !ok {
+		return
+	}
+
+	if err := ix.repo.DeleteTree(ix.jobID, rel); err != nil {
+		logger.Log.Warn("failed to delete file state",
+			zap.String("path", path),
+			zap.Error(err))
+	}
+}
+
+// Move oldPath와 그 아래 경로의 기록을 newPath 아래로 옮김
+func (ix *Index) Move(oldPath, newPath string) {
+	if ix == nil {
+		return
+	}
+
+	oldRel, ok := ix.rel(oldPath)
+	if !ok {
+		return
+	}
+
+	newRel, ok := ix.rel(newPath)
+	if !ok {
+		return
+	}
+
+	if err := ix.repo.MoveTree(ix.jobID, oldRel, newRel); err != nil {
+		logger.Log.Warn("failed to move file state",
+			zap.String("from", oldPath),
+			zap.String("to", newPath),
+			zap.Error(err))
+	}
+}
+
+// rel root 밖이거나 root 자신이면 false
+func (ix *Index) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(ix.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
@@ -11,16 +11,24 @@ const (
 	EventRename EventType = "RENAME"
 )
 
+// FileEvent EventRename이면 Path는 이동한 뒤의 경로이고 OldPath는 이동하기 전의 경로.
+// IsDir이면 디렉터리 자체에 대한 이벤트로, 삭제는 그 아래의 모든 항목을 함께 지움
 type FileEvent struct {
 	Type      EventType
 	Path      string
+	OldPath   string
+	IsDir     bool
 	Timestamp time.Time
 }
 
+// SyncResult Size는 전송한 파일의 크기, WireBytes는 압축이나 delta 후 실제로 연결에 쓴 내용의 크기.
+// 내용을 보내지 않았으면 둘 다 0
 type SyncResult struct {
-	Event    FileEvent
-	SrcPath  string
-	DstPath  string
-	Err      error
-	Conflict *ConflictInfo
+	Event     FileEvent
+	SrcPath   string
+	DstPath   string
+	Err       error
+	Conflict  *ConflictInfo
+	Size      int64
+	WireBytes int64
 }
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FileState job이 마지막으로 동기화한 파일의 상태. Path는 job의 로컬 디렉터리 기준 상대 경로(/ 구분),
+// Hash는 내용의 SHA-256(hex)이고 모르면 비어 있음. RemoteID와 RemoteRev는 클라우드 저장소의 파일 ID와 revision
+type FileState struct {
+	gorm.Model
+	JobID     uint   `gorm:"not null;uniqueIndex:idx_file_state_path"`
+	Path      string `gorm:"not null;uniqueIndex:idx_file_state_path"`
+	Size      int64
+	ModTime   time.Time
+	Hash      string
+	RemoteID  string
+	RemoteRev string
+	SyncedAt  time.Time
+}
@@ -11,6 +11,8 @@ type SyncStatus string
 const (
 	StatusSuccess SyncStatus = "SUCCESS"
 	StatusFailed  SyncStatus = "FAILED"
+	// 원격에서 받은 경로가 안전하지 않아 처리하지 않음
+	StatusRejected SyncStatus = "REJECTED"
 )
 
 type History struct {
@@ -22,4 +24,6 @@ type History struct {
 	FileEvent string     `gorm:"not null"`
 	ErrMsg    string
 	SyncedAt  time.Time `gorm:"not null"`
+	Size      int64
+	WireBytes int64
 }
@@ -1,6 +1,10 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
 
 type EndpointType string
 
@@ -11,6 +15,50 @@ const (
 	EndpointDropbox   EndpointType = "DROPBOX"
 )
 
+// SymlinkPolicy 원본의 심볼릭 링크를 다루는 방식. 비어 있으면 SymlinkFollow
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow 링크가 가리키는 파일이나 디렉터리의 내용을 복사
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkCopyAsLink 대상에도 같은 경로를 가리키는 링크를 만듦
+	SymlinkCopyAsLink SymlinkPolicy = "copy-as-link"
+	SymlinkSkip       SymlinkPolicy = "skip"
+)
+
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return SymlinkFollow, nil
+	case SymlinkFollow, SymlinkCopyAsLink, SymlinkSkip:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid symlink policy %q: expected follow, copy-as-link or skip", s)
+	}
+}
+
+// WatchMode 로컬 src의 변경을 알아내는 방식. 비어 있으면 WatchAuto
+type WatchMode string
+
+const (
+	// WatchAuto fsnotify를 쓰되 네트워크 파일 시스템이거나 inotify 한도에 걸리면 polling으로 바꿈
+	WatchAuto     WatchMode = "auto"
+	WatchFsnotify WatchMode = "fsnotify"
+	// WatchPoll 주기마다 디렉터리 전체를 stat하여 비교
+	WatchPoll WatchMode = "poll"
+)
+
+func ParseWatchMode(s string) (WatchMode, error) {
+	switch m := WatchMode(s); m {
+	case "":
+		return WatchAuto, nil
+	case WatchAuto, WatchFsnotify, WatchPoll:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid watch mode %q: expected auto, fsnotify or poll", s)
+	}
+}
+
 type JobStatus string
 
 const (
@@ -19,12 +67,27 @@ const (
 	JobStatusStopped JobStatus = "STOPPED"
 )
 
+// Job Bidirectional이면 두 데몬이 각자의 디렉터리를 감시하며 서로에게 변경을 보냄.
+// Mirror이면 TCP 전체 동기화 시 src에 없는 파일을 dst에서 삭제하고,
+// Compress이면 TCP로 보내는 파일 내용을 압축.
+// RateLimit은 초당 바이트 수이고 RateWindows의 시간대에는 그 창의 속도를 적용 (0이면 제한 없음).
+// Symlinks는 로컬과 TCP job에서 원본의 심볼릭 링크를 다루는 방식이고,
+// Watch는 로컬 디렉터리의 변경을 감시로 알아낼지 주기적으로 훑어 알아낼지 정함.
+// PreserveOwner이면 소유자, setuid/setgid 비트와 user 확장 속성도 옮김
 type Job struct {
 	gorm.Model
-	SrcType  EndpointType `gorm:"not null"`
-	SrcPath  string       `gorm:"not null"`
-	DstType  EndpointType `gorm:"not null"`
-	DstPath  string       `gorm:"not null"`
-	Status   JobStatus    `gorm:"not null;default:'ACTIVE'"`
-	RecvPort int
+	SrcType       EndpointType `gorm:"not null"`
+	SrcPath       string       `gorm:"not null"`
+	DstType       EndpointType `gorm:"not null"`
+	DstPath       string       `gorm:"not null"`
+	Status        JobStatus    `gorm:"not null;default:'ACTIVE'"`
+	RecvPort      int
+	Bidirectional bool
+	Mirror        bool
+	Compress      bool
+	RateLimit     int64
+	RateWindows   string
+	Symlinks      SymlinkPolicy
+	Watch         WatchMode
+	PreserveOwner bool
 }
@@ -0,0 +1,13 @@
+package model
+
+import "gorm.io/gorm"
+
+// Peer 페어링을 마친 원격 노드. Fingerprint는 노드 인증서 공개키의 SHA-256,
+// Secret은 페어링 때 교환한 데몬 간 요청 서명용 키(hex)
+type Peer struct {
+	gorm.Model
+	NodeID      string `gorm:"not null;uniqueIndex"`
+	Address     string
+	Fingerprint string `gorm:"not null"`
+	Secret      string `json:"-"`
+}
@@ -11,4 +11,7 @@ type JobSnapshot struct {
 	Synced    int        `json:"synced"`
 	Failed    int        `json:"failed"`
 	LastSync  *time.Time `json:"last_sync"`
+	// LostEvents local 감시가 놓친 이벤트 수. 놓친 디렉터리는 다시 훑어 맞춤
+	LostEvents int64 `json:"lost_events"`
+	Rescans    int64 `json:"rescans"`
 }
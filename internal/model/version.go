@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+// FileVersion 로컬 디렉터리(Root) 안의 경로별 version vector.
+// Checksum은 이 벡터가 가리키는 내용의 SHA-256(hex), 삭제된 경우 Deleted로 표시하고 벡터는 유지
+type FileVersion struct {
+	gorm.Model
+	Root     string            `gorm:"not null;uniqueIndex:idx_file_version_path"`
+	Path     string            `gorm:"not null;uniqueIndex:idx_file_version_path"`
+	Vector   map[string]uint64 `gorm:"serializer:json"`
+	Checksum string
+	Deleted  bool
+}
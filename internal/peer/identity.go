@@ -0,0 +1,180 @@
+package peer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"synco/internal/model"
+	"synco/internal/repository"
+	"synco/internal/util"
+	"time"
+)
+
+const (
+	certFile = "daemon.crt"
+	keyFile  = "daemon.key"
+)
+
+// TrustStore 연결을 허용할 원격 노드의 ID와 공개키 fingerprint, 요청 서명용 secret 목록
+type TrustStore interface {
+	IsTrusted(nodeID, fingerprint string) bool
+	Secret(nodeID string) ([]byte, error)
+}
+
+// Identity 노드의 키 쌍. 로컬 API의 TLS 인증서이자 데몬 간 mTLS의 클라이언트/서버 인증서로 사용
+type Identity struct {
+	NodeID      string
+	Certificate tls.Certificate
+	CertPEM     []byte
+	Fingerprint string
+	Trust       TrustStore
+}
+
+func LoadOrCreateIdentity() (*Identity, error) {
+	nodeID, err := model.LoadOrCreateNodeID()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := util.SyncoDir()
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := filepath.Join(dir, certFile)
+	keyPath := filepath.Join(dir, keyFile)
+
+	if !isCertValid(certPath, nodeID) {
+		if err := generateCert(certPath, keyPath, nodeID); err != nil {
+			return nil, fmt.Errorf("failed to generate node certificate: %w", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node certificate: %w", err)
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse node certificate: %w", err)
+	}
+
+	return &Identity{
+		NodeID:      nodeID,
+		Certificate: cert,
+		CertPEM:     certPEM,
+		Fingerprint: Fingerprint(leaf),
+		Trust:       repository.NewPeerRepository(),
+	}, nil
+}
+
+// Fingerprint 공개키의 SHA-256. 인증서를 갱신해도 키가 같으면 유지됨
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+func isCertValid(certPath, nodeID string) bool {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return false
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	// 이전 버전에서 만든 인증서는 노드 ID와 클라이언트 인증 용도가 없으므로 다시 발급
+	if cert.Subject.CommonName != nodeID || !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth) {
+		return false
+	}
+
+	// 30일 이상 남아있어야 유효로 판단
+	return time.Until(cert.NotAfter) > 30*24*time.Hour
+}
+
+func generateCert(certPath, keyPath, nodeID string) error {
+	priv, err := loadOrCreateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"synco"},
+			CommonName:   nodeID,
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:    []string{"localhost"},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return os.WriteFile(certPath, certPEM, 0600)
+}
+
+// 갱신 시에도 기존 키를 재사용해야 다른 노드에 등록된 fingerprint가 유지됨
+func loadOrCreateKey(keyPath string) (*ecdsa.PrivateKey, error) {
+	if data, err := os.ReadFile(keyPath); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if priv, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				return priv, nil
+			}
+		}
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	privDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
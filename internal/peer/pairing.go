@@ -0,0 +1,154 @@
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PairCodeTTL     = 5 * time.Minute
+	maxPairAttempts = 5
+
+	// 혼동하기 쉬운 문자(0/O, 1/I/L)는 제외
+	pairCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	pairCodeLen      = 8
+)
+
+var (
+	ErrNoPairing    = errors.New("no pairing in progress")
+	ErrInvalidProof = errors.New("invalid pairing code")
+)
+
+// Pairing 페어링 대기 중인 일회용 코드. 한 번에 하나의 코드만 유효
+type Pairing struct {
+	mu        sync.Mutex
+	code      string
+	expiresAt time.Time
+	attempts  int
+}
+
+func NewPairing() *Pairing {
+	return &Pairing{}
+}
+
+// NewCode 새 코드를 발급하고 이전 코드는 무효화
+func (p *Pairing) NewCode() (string, time.Time, error) {
+	b := make([]byte, pairCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+
+	var sb strings.Builder
+	for i, v := range b {
+		if i == pairCodeLen/2 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(pairCodeAlphabet[int(v)%len(pairCodeAlphabet)])
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.code = sb.String()
+	p.expiresAt = time.Now().Add(PairCodeTTL)
+	p.attempts = 0
+
+	return p.code, p.expiresAt, nil
+}
+
+// Verify 상대가 보낸 proof가 현재 코드와 두 인증서로 만든 값인지 확인.
+// 성공하거나 시도 횟수를 넘기면 코드를 폐기하여 재사용과 무차별 대입을 막음
+func (p *Pairing) Verify(proof []byte, initiatorFP, responderFP string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.code == "" || time.Now().After(p.expiresAt) {
+		p.code = ""
+		return "", ErrNoPairing
+	}
+
+	expected := Proof(p.code, "initiator", initiatorFP, responderFP)
+	if !hmac.Equal(proof, expected) {
+		p.attempts++
+		if p.attempts >= maxPairAttempts {
+			p.code = ""
+		}
+		return "", ErrInvalidProof
+	}
+
+	code := p.code
+	p.code = ""
+	return code, nil
+}
+
+// Proof 코드를 키로 두 노드의 fingerprint에 서명. 코드를 아는 쪽끼리만 같은 값을 만들 수 있고,
+// 중간에서 다른 인증서로 연결을 가로채면 fingerprint가 달라져 검증에 실패함
+func Proof(code, role, initiatorFP, responderFP string) []byte {
+	mac := hmac.New(sha256.New, []byte(normalizeCode(code)))
+	mac.Write([]byte("synco-pair\x00" + role + "\x00"))
+	mac.Write([]byte(strings.ToLower(initiatorFP) + "\x00" + strings.ToLower(responderFP)))
+	return mac.Sum(nil)
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// Probe 아직 trust store에 없는 상대의 인증서를 가져옴. 이 결과는 신뢰할 수 없으며,
+// 페어링 코드로 만든 proof로 같은 인증서임을 확인해야 함
+func (id *Identity) Probe(addr string) (nodeID, fingerprint string, err error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		Certificates:       []tls.Certificate{id.Certificate},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func(conn *tls.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", "", fmt.Errorf("%w: no certificate", ErrUntrustedPeer)
+	}
+
+	return certs[0].Subject.CommonName, Fingerprint(certs[0]), nil
+}
+
+// PinnedTLSConfig Probe로 확인한 인증서와 같은 경우에만 연결
+func (id *Identity) PinnedTLSConfig(fingerprint string) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{id.Certificate},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("%w: no certificate", ErrUntrustedPeer)
+			}
+
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrUntrustedPeer, err)
+			}
+
+			if !strings.EqualFold(Fingerprint(cert), fingerprint) {
+				return fmt.Errorf("%w: certificate changed during pairing", ErrUntrustedPeer)
+			}
+
+			return nil
+		},
+	}
+}
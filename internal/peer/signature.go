@@ -0,0 +1,129 @@
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderNodeID    = "X-Synco-Node-Id"
+	HeaderTimestamp = "X-Synco-Timestamp"
+	HeaderNonce     = "X-Synco-Nonce"
+	HeaderSignature = "X-Synco-Signature"
+
+	// 이 범위를 벗어난 요청은 nonce 기록 없이도 거부되므로, nonce는 이 기간만 보관
+	MaxRequestAge = 5 * time.Minute
+	MaxClockSkew  = 1 * time.Minute
+	SecretSize    = 32
+)
+
+var (
+	ErrMissingSignature = errors.New("missing signature headers")
+	ErrExpiredRequest   = errors.New("request expired")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrReplayedRequest  = errors.New("nonce already used")
+)
+
+func NewSecret() ([]byte, error) {
+	b := make([]byte, SecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Sign 메서드, 경로, 본문, 타임스탬프, nonce, 노드 ID를 페어링 때 교환한 secret으로 서명
+func Sign(secret []byte, method, path, nodeID, timestamp, nonce string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{
+		method,
+		path,
+		nodeID,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodySum[:]),
+	}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func SignRequest(req *http.Request, secret []byte, nodeID string, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+
+	req.Header.Set(HeaderNodeID, nodeID)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderNonce, n)
+	req.Header.Set(HeaderSignature, Sign(secret, req.Method, req.URL.Path, nodeID, ts, n, body))
+	return nil
+}
+
+// Verifier 서명 검증과 함께 사용된 nonce를 기억하여 같은 요청의 재전송을 거부
+type Verifier struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{nonces: make(map[string]time.Time)}
+}
+
+func (v *Verifier) Verify(req *http.Request, secret []byte, body []byte) error {
+	nodeID := req.Header.Get(HeaderNodeID)
+	tsStr := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	sig := req.Header.Get(HeaderSignature)
+	if nodeID == "" || tsStr == "" || nonce == "" || sig == "" {
+		return ErrMissingSignature
+	}
+
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age > MaxRequestAge || age < -MaxClockSkew {
+		return ErrExpiredRequest
+	}
+
+	expected := Sign(secret, req.Method, req.URL.Path, nodeID, tsStr, nonce, body)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	for n, expiresAt := range v.nonces {
+		if now.After(expiresAt) {
+			delete(v.nonces, n)
+		}
+	}
+
+	key := nodeID + "/" + nonce
+	if _, used := v.nonces[key]; used {
+		return ErrReplayedRequest
+	}
+
+	// 타임스탬프 검사를 통과할 수 있는 동안만 보관하면 충분
+	v.nonces[key] = time.Unix(ts, 0).Add(MaxRequestAge + MaxClockSkew)
+	return nil
+}
@@ -0,0 +1,67 @@
+package peer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var ErrUntrustedPeer = errors.New("untrusted peer")
+
+// ServerTLSConfig 클라이언트 인증서를 요구하고 trust store에 등록된 노드만 허용
+func (id *Identity) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{id.Certificate},
+		MinVersion:   tls.VersionTLS13,
+		// 자체 서명 인증서이므로 CA 검증 대신 fingerprint로 확인
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: id.verifyPeer(""),
+	}
+}
+
+// ClientTLSConfig 서버 인증서의 노드가 trust store에 등록되어 있어야 연결.
+// expectedNodeID가 비어있지 않으면 해당 노드인지도 확인
+func (id *Identity) ClientTLSConfig(expectedNodeID string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{id.Certificate},
+		MinVersion:   tls.VersionTLS13,
+		// 체인 검증은 VerifyPeerCertificate에서 pinning으로 대체
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: id.verifyPeer(expectedNodeID),
+	}
+}
+
+func (id *Identity) verifyPeer(expectedNodeID string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%w: no certificate", ErrUntrustedPeer)
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUntrustedPeer, err)
+		}
+
+		nodeID := cert.Subject.CommonName
+		if expectedNodeID != "" && nodeID != expectedNodeID {
+			return fmt.Errorf("%w: expected node %s, got %s", ErrUntrustedPeer, expectedNodeID, nodeID)
+		}
+
+		fp := Fingerprint(cert)
+		if !id.Trust.IsTrusted(nodeID, fp) {
+			return fmt.Errorf("%w: node %s (%s)", ErrUntrustedPeer, nodeID, fp)
+		}
+
+		return nil
+	}
+}
+
+// NodeIDFromState 핸드셰이크가 끝난 연결에서 상대 노드 ID를 꺼냄
+func NodeIDFromState(state tls.ConnectionState) (string, bool) {
+	if len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+
+	return state.PeerCertificates[0].Subject.CommonName, true
+}
@@ -2,23 +2,32 @@ package pipeline
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/util"
 
 	"go.uber.org/zap"
 )
 
+// ChecksumFilter 내용이 바뀌지 않은 쓰기 이벤트를 거름. index가 있으면 다시 시작하기 전에 동기화한
+// 파일도 그때의 크기, 수정 시각과 해시로 비교
 type ChecksumFilter struct {
 	mu    sync.Mutex
 	cache map[string][]byte
+	index *index.Index
 }
 
-func NewChecksumFilter() *ChecksumFilter {
+func NewChecksumFilter(ix *index.Index) *ChecksumFilter {
 	return &ChecksumFilter{
 		cache: make(map[string][]byte),
+		index: ix,
 	}
 }
 
@@ -29,14 +38,33 @@ func (cf *ChecksumFilter) Run(inCh <-chan model.FileEvent) <-chan model.FileEven
 		defer close(outCh)
 
 		for event := range inCh {
-			if event.Type == model.EventRemove || event.Type == model.EventRename {
-				cf.mu.Lock()
-				delete(cf.cache, event.Path)
-				cf.mu.Unlock()
+			if event.Type == model.EventRemove {
+				cf.forget(event.Path)
 				outCh <- event
 				continue
 			}
 
+			// 이동한 내용은 그대로이므로 캐시만 새 경로로 옮김
+			if event.Type == model.EventRename {
+				cf.move(event.OldPath, event.Path)
+				outCh <- event
+				continue
+			}
+
+			// 디렉터리는 내용이 없으므로 만든 것만 전달
+			if event.IsDir {
+				outCh <- event
+				continue
+			}
+
+			if info, err := os.Lstat(event.Path); err == nil && info.Mode().IsRegular() {
+				if _, ok := cf.index.Unchanged(event.Path, info); ok {
+					logger.Log.Debug("unchanged since last sync, skipping",
+						zap.String("path", event.Path))
+					continue
+				}
+			}
+
 			sum, err := checksum(event.Path)
 			if err != nil {
 				logger.Log.Debug("checksum failed, skipping",
@@ -45,8 +73,9 @@ func (cf *ChecksumFilter) Run(inCh <-chan model.FileEvent) <-chan model.FileEven
 				continue
 			}
 
+			prev, exists := cf.previous(event.Path)
+
 			cf.mu.Lock()
-			prev, exists := cf.cache[event.Path]
 			changed := !exists || !equal(prev, sum)
 			if changed {
 				cf.cache[event.Path] = sum
@@ -65,7 +94,64 @@ func (cf *ChecksumFilter) Run(inCh <-chan model.FileEvent) <-chan model.FileEven
 	return outCh
 }
 
+// previous 이번 실행에서 본 체크섬이 없으면 마지막으로 동기화한 내용의 해시
+func (cf *ChecksumFilter) previous(path string) ([]byte, bool) {
+	cf.mu.Lock()
+	sum, ok := cf.cache[path]
+	cf.mu.Unlock()
+
+	if ok {
+		return sum, true
+	}
+
+	state, ok := cf.index.Lookup(path)
+	if !ok || state.Hash == "" {
+		return nil, false
+	}
+
+	sum, err := hex.DecodeString(state.Hash)
+	return sum, err == nil
+}
+
+// forget path와 그 아래 경로의 기록을 지움
+func (cf *ChecksumFilter) forget(path string) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	for p := range cf.cache {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			delete(cf.cache, p)
+		}
+	}
+}
+
+// move oldPath와 그 아래 경로의 기록을 newPath 아래로 옮김
+func (cf *ChecksumFilter) move(oldPath, newPath string) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	delete(cf.cache, newPath)
+
+	for p, sum := range cf.cache {
+		switch {
+		case p == oldPath:
+			cf.cache[newPath] = sum
+		case strings.HasPrefix(p, oldPath+string(filepath.Separator)):
+			cf.cache[newPath+strings.TrimPrefix(p, oldPath)] = sum
+		default:
+			continue
+		}
+
+		delete(cf.cache, p)
+	}
+}
+
+// checksum 링크는 따라가지 않고 가리키는 경로로 비교. 링크를 다시 걸었을 때만 바뀐 것으로 봄
 func checksum(path string) ([]byte, error) {
+	if target, err := os.Readlink(path); err == nil {
+		return util.LinkChecksum(target), nil
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
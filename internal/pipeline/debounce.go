@@ -1,40 +1,97 @@
 package pipeline
 
 import (
+	"sync"
 	"synco/internal/model"
 	"time"
 )
 
+// Debounce 같은 경로의 이벤트가 delay 동안 더 오지 않을 때 마지막 이벤트만 내보냄.
+// 이동은 내용이 바뀌는 이벤트가 아니므로 기다리지 않고 바로 내보냄
 func Debounce(inCh <-chan model.FileEvent, delay time.Duration) <-chan model.FileEvent {
 	outCh := make(chan model.FileEvent, cap(inCh))
 
 	go func() {
 		defer close(outCh)
 
+		// 타이머 함수가 보내는 동안에도 잠금을 유지하여 채널을 닫은 뒤에 보내지 않도록 함
+		var mu sync.Mutex
 		timers := make(map[string]*time.Timer)
 		events := make(map[string]model.FileEvent)
 
-		for event := range inCh {
+		cancel := func(path string) (model.FileEvent, bool) {
+			event, ok := events[path]
+			if ok {
+				timers[path].Stop()
+				delete(timers, path)
+				delete(events, path)
+			}
+
+			return event, ok
+		}
+
+		schedule := func(event model.FileEvent) {
 			path := event.Path
+			cancel(path)
 
-			if t, ok := timers[path]; ok {
-				t.Stop()
-			}
+			var t *time.Timer
+			t = time.AfterFunc(delay, func() {
+				mu.Lock()
+				defer mu.Unlock()
 
-			events[path] = event
+				// 멈추기 전에 이미 실행된 이전 타이머이면 새 이벤트를 먼저 보내지 않음
+				if timers[path] != t {
+					return
+				}
 
-			capturedPath := path
-			timers[path] = time.AfterFunc(delay, func() {
-				outCh <- events[capturedPath]
-				delete(timers, capturedPath)
-				delete(events, capturedPath)
+				outCh <- events[path]
+				delete(timers, path)
+				delete(events, path)
 			})
+
+			timers[path] = t
+			events[path] = event
 		}
 
+		for event := range inCh {
+			mu.Lock()
+
+			if event.Type != model.EventRename {
+				schedule(event)
+				mu.Unlock()
+				continue
+			}
+
+			// 새 경로의 밀린 변경은 이동한 내용으로 덮임
+			cancel(event.Path)
+
+			// 이전 경로의 변경이 아직 나가지 않았으면 대상의 내용이 오래되었으므로 삭제하고 새로 보냄
+			if prev, ok := cancel(event.OldPath); ok && prev.Type != model.EventRemove {
+				outCh <- model.FileEvent{
+					Type:      model.EventRemove,
+					Path:      event.OldPath,
+					Timestamp: event.Timestamp,
+				}
+				schedule(model.FileEvent{
+					Type:      model.EventCreate,
+					Path:      event.Path,
+					Timestamp: event.Timestamp,
+				})
+			} else {
+				outCh <- event
+			}
+
+			mu.Unlock()
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
 		for path, t := range timers {
 			t.Stop()
 			outCh <- events[path]
 		}
+		clear(timers)
 	}()
 
 	return outCh
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"synco/internal/logger"
+	"synco/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// EchoFilter 양방향 동기화에서 상대에게서 받아 기록한 파일의 이벤트를 걸러내어 다시 보내지 않음
+type EchoFilter struct {
+	mu       sync.Mutex
+	received map[string][]byte
+}
+
+func NewEchoFilter() *EchoFilter {
+	return &EchoFilter{
+		received: make(map[string][]byte),
+	}
+}
+
+// Received 상대에게서 받은 내용을 기록. 삭제한 경우와 디렉터리는 checksum이 nil
+func (ef *EchoFilter) Received(path string, checksum []byte) {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+
+	ef.received[normalize(path)] = checksum
+}
+
+func (ef *EchoFilter) Run(inCh <-chan model.FileEvent) <-chan model.FileEvent {
+	outCh := make(chan model.FileEvent, cap(inCh))
+
+	go func() {
+		defer close(outCh)
+
+		for event := range inCh {
+			if ef.isEcho(event) {
+				logger.Log.Debug("received from peer, skipping",
+					zap.String("path", event.Path))
+				continue
+			}
+
+			outCh <- event
+		}
+	}()
+
+	return outCh
+}
+
+// isEcho 기록은 한 번만 사용. 이후 같은 경로의 이벤트는 로컬에서 바뀐 것으로 봄.
+// 상대가 보낸 이동은 이전 경로의 삭제와 새 경로의 내용으로 기록됨
+func (ef *EchoFilter) isEcho(event model.FileEvent) bool {
+	expected, ok := ef.take(event.Path)
+
+	if event.Type == model.EventRename {
+		removed, moved := ef.take(event.OldPath)
+		if !moved || removed != nil {
+			return false
+		}
+	}
+
+	// 디렉터리는 내용이 없으므로 기록이 있으면 받은 것으로 봄
+	if !ok || event.IsDir {
+		return ok
+	}
+
+	sum, err := checksum(event.Path)
+	if err != nil {
+		return expected == nil && os.IsNotExist(err)
+	}
+
+	return expected != nil && equal(expected, sum)
+}
+
+func (ef *EchoFilter) take(path string) ([]byte, bool) {
+	path = normalize(path)
+
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+
+	checksum, ok := ef.received[path]
+	delete(ef.received, path)
+	return checksum, ok
+}
+
+func normalize(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return filepath.Clean(path)
+}
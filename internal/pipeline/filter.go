@@ -1,19 +1,28 @@
 package pipeline
 
 import (
-	"path/filepath"
-	"strings"
+	"synco/internal/ignore"
 	"synco/internal/model"
 )
 
-func Filter(inCh <-chan model.FileEvent, ignoreList []string) <-chan model.FileEvent {
+// Filter m의 규칙으로 무시하는 경로의 이벤트를 거름. 무시 파일이 바뀌면 다음 이벤트부터 새 규칙을 따름
+func Filter(inCh <-chan model.FileEvent, m *ignore.Matcher) <-chan model.FileEvent {
 	outCh := make(chan model.FileEvent, cap(inCh))
 
 	go func() {
 		defer close(outCh)
 
 		for event := range inCh {
-			if shouldIgnore(event.Path, ignoreList) {
+			m.Invalidate(event)
+
+			if event.Type == model.EventRename {
+				var ok bool
+				if event, ok = filterRename(event, m); !ok {
+					continue
+				}
+			}
+
+			if m.Ignored(event.Path, event.IsDir) {
 				continue
 			}
 			outCh <- event
@@ -23,17 +32,19 @@ func Filter(inCh <-chan model.FileEvent, ignoreList []string) <-chan model.FileE
 	return outCh
 }
 
-func shouldIgnore(path string, ignoreList []string) bool {
-	parts := strings.Split(filepath.ToSlash(path), "/")
-
-	for _, part := range parts {
-		for _, pattern := range ignoreList {
-			matched, err := filepath.Match(pattern, part)
-			if err == nil && matched {
-				return true
-			}
-		}
+// filterRename 무시하는 경로에서 옮겨 왔으면 새로 만든 것으로, 무시하는 경로로 옮겼으면 삭제한 것으로 바꿈
+func filterRename(event model.FileEvent, m *ignore.Matcher) (model.FileEvent, bool) {
+	oldIgnored := m.Ignored(event.OldPath, event.IsDir)
+	newIgnored := m.Ignored(event.Path, event.IsDir)
+
+	switch {
+	case oldIgnored && newIgnored:
+		return event, false
+	case oldIgnored:
+		event.Type, event.OldPath = model.EventCreate, ""
+	case newIgnored:
+		event.Type, event.Path, event.OldPath = model.EventRemove, event.OldPath, ""
 	}
 
-	return false
+	return event, true
 }
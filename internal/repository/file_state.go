@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"synco/internal/db"
+	"synco/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileStateRepository struct{}
+
+func NewFileStateRepository() *FileStateRepository {
+	return &FileStateRepository{}
+}
+
+// Get 기록이 없으면 ID가 0인 빈 상태를 반환
+func (r *FileStateRepository) Get(jobID uint, path string) (model.FileState, error) {
+	var state model.FileState
+	err := db.DB.
+		Where("job_id = ? AND path = ?", jobID, path).
+		Limit(1).
+		Find(&state).Error
+
+	return state, err
+}
+
+// GetAll job의 모든 기록
+func (r *FileStateRepository) GetAll(jobID uint) ([]model.FileState, error) {
+	var states []model.FileState
+	err := db.DB.
+		Where("job_id = ?", jobID).
+		Find(&states).Error
+
+	return states, err
+}
+
+// GetTree path 아래 경로의 기록
+func (r *FileStateRepository) GetTree(jobID uint, path string) ([]model.FileState, error) {
+	var states []model.FileState
+	err := underTree(db.DB, jobID, path).Find(&states).Error
+
+	return states, err
+}
+
+// Save 같은 경로가 동시에 기록되어도 하나의 행이 되도록 job과 경로로 upsert
+func (r *FileStateRepository) Save(state *model.FileState) error {
+	if state.ID != 0 {
+		return db.DB.Save(state).Error
+	}
+
+	return db.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "job_id"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"size", "mod_time", "hash", "remote_id", "remote_rev", "synced_at", "updated_at",
+		}),
+	}).Create(state).Error
+}
+
+// DeleteTree path와 그 아래 경로의 기록을 지움
+func (r *FileStateRepository) DeleteTree(jobID uint, path string) error {
+	return underTree(db.DB.Unscoped(), jobID, path).Delete(&model.FileState{}).Error
+}
+
+// MoveTree oldPath와 그 아래 경로의 기록을 newPath 아래로 옮김. newPath에 있던 기록은 덮어씀
+func (r *FileStateRepository) MoveTree(jobID uint, oldPath, newPath string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := underTree(tx.Unscoped(), jobID, newPath).Delete(&model.FileState{}).Error; err != nil {
+			return err
+		}
+
+		return underTree(tx.Model(&model.FileState{}), jobID, oldPath).
+			Update("path", gorm.Expr("? || substr(path, length(?) + 1)", newPath, oldPath)).Error
+	})
+}
+
+// DeleteJob 지운 job의 기록을 모두 지움
+func (r *FileStateRepository) DeleteJob(jobID uint) error {
+	return db.DB.Unscoped().Where("job_id = ?", jobID).Delete(&model.FileState{}).Error
+}
+
+// underTree LIKE는 경로의 %와 _를 와일드카드로 보므로 앞부분을 잘라 비교
+func underTree(q *gorm.DB, jobID uint, path string) *gorm.DB {
+	return q.Where("job_id = ? AND (path = ? OR substr(path, 1, length(?)) = ?)", jobID, path, path+"/", path+"/")
+}
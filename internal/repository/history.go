@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"errors"
 	"synco/internal/db"
 	"synco/internal/model"
+	"synco/internal/util"
 	"time"
 )
 
@@ -18,6 +20,10 @@ func (r *HistoryRepository) Save(result model.SyncResult, jobID uint) error {
 	if result.Err != nil {
 		status = model.StatusFailed
 		errMsg = result.Err.Error()
+
+		if errors.Is(result.Err, util.ErrUnsafePath) {
+			status = model.StatusRejected
+		}
 	}
 
 	history := model.History{
@@ -28,6 +34,8 @@ func (r *HistoryRepository) Save(result model.SyncResult, jobID uint) error {
 		FileEvent: string(result.Event.Type),
 		ErrMsg:    errMsg,
 		SyncedAt:  time.Now(),
+		Size:      result.Size,
+		WireBytes: result.WireBytes,
 	}
 
 	return db.DB.Create(&history).Error
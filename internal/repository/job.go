@@ -11,17 +11,9 @@ func NewJobRepository() *JobRepository {
 	return &JobRepository{}
 }
 
-func (r *JobRepository) Add(
-	srcPath string, srcType model.EndpointType,
-	dstPath string, dstType model.EndpointType) (model.Job, error) {
-	job := model.Job{
-		SrcType: srcType,
-		SrcPath: srcPath,
-		DstType: dstType,
-		DstPath: dstPath,
-		Status:  model.JobStatusActive,
-	}
-
+// Add 경로, 종류와 job별 설정을 채운 job을 활성 상태로 저장
+func (r *JobRepository) Add(job model.Job) (model.Job, error) {
+	job.Status = model.JobStatusActive
 	return job, db.DB.Create(&job).Error
 }
 
@@ -41,6 +33,15 @@ func (r *JobRepository) UpdateStatus(id uint, status model.JobStatus) error {
 		Update("status", status).Error
 }
 
+func (r *JobRepository) UpdateBandwidth(id uint, rateLimit int64, rateWindows string) error {
+	return db.DB.Model(&model.Job{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"rate_limit":   rateLimit,
+			"rate_windows": rateWindows,
+		}).Error
+}
+
 func (r *JobRepository) UpdateRecvPort(id uint, port int) error {
 	return db.DB.Model(&model.Job{}).
 		Where("id = ?", id).
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"synco/internal/db"
+	"synco/internal/model"
+)
+
+type PeerRepository struct{}
+
+func NewPeerRepository() *PeerRepository {
+	return &PeerRepository{}
+}
+
+// Save 같은 노드를 다시 페어링하면 주소와 fingerprint를 갱신
+func (r *PeerRepository) Save(nodeID, address, fingerprint string, secret []byte) (model.Peer, error) {
+	var peer model.Peer
+	err := db.DB.
+		Where(model.Peer{NodeID: nodeID}).
+		Assign(model.Peer{
+			Address:     address,
+			Fingerprint: strings.ToLower(fingerprint),
+			Secret:      hex.EncodeToString(secret),
+		}).
+		FirstOrCreate(&peer).Error
+
+	return peer, err
+}
+
+func (r *PeerRepository) GetAll() ([]model.Peer, error) {
+	var peers []model.Peer
+	return peers, db.DB.Order("node_id").Find(&peers).Error
+}
+
+func (r *PeerRepository) GetByNodeID(nodeID string) (model.Peer, error) {
+	var peer model.Peer
+	return peer, db.DB.Where("node_id = ?", nodeID).First(&peer).Error
+}
+
+// IsTrusted peer.TrustStore 구현
+func (r *PeerRepository) IsTrusted(nodeID, fingerprint string) bool {
+	peer, err := r.GetByNodeID(nodeID)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(peer.Fingerprint, fingerprint)
+}
+
+// Secret peer.TrustStore 구현
+func (r *PeerRepository) Secret(nodeID string) ([]byte, error) {
+	peer, err := r.GetByNodeID(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown peer %s: %w", nodeID, err)
+	}
+
+	if peer.Secret == "" {
+		return nil, fmt.Errorf("peer %s has no shared secret, pair again", nodeID)
+	}
+
+	return hex.DecodeString(peer.Secret)
+}
+
+// Delete node_id가 unique이므로 soft delete 대신 실제로 삭제해야 다시 페어링 가능
+func (r *PeerRepository) Delete(nodeID string) (int64, error) {
+	result := db.DB.Unscoped().Where("node_id = ?", nodeID).Delete(&model.Peer{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"synco/internal/db"
+	"synco/internal/model"
+
+	"gorm.io/gorm/clause"
+)
+
+type VersionRepository struct{}
+
+func NewVersionRepository() *VersionRepository {
+	return &VersionRepository{}
+}
+
+// Get 기록이 없으면 ID가 0인 빈 버전을 반환
+func (r *VersionRepository) Get(root, path string) (model.FileVersion, error) {
+	var version model.FileVersion
+	err := db.DB.
+		Where("root = ? AND path = ?", root, path).
+		Limit(1).
+		Find(&version).Error
+
+	return version, err
+}
+
+// Save 처음 기록하는 경로는 같은 경로가 동시에 기록되어도 하나의 행으로 합쳐지도록 upsert
+func (r *VersionRepository) Save(version *model.FileVersion) error {
+	if version.ID != 0 {
+		return db.DB.Save(version).Error
+	}
+
+	return db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "root"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"vector", "checksum", "deleted", "updated_at"}),
+	}).Create(version).Error
+}
+
+// GetTree path 아래 경로의 기록. LIKE는 경로의 %와 _를 와일드카드로 보므로 앞부분을 잘라 비교
+func (r *VersionRepository) GetTree(root, path string) ([]model.FileVersion, error) {
+	var versions []model.FileVersion
+	err := db.DB.
+		Where("root = ? AND substr(path, 1, length(?)) = ?", root, path+"/", path+"/").
+		Find(&versions).Error
+
+	return versions, err
+}
@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"time"
 )
@@ -25,6 +26,18 @@ var (
 	}
 )
 
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 재시도해도 결과가 같은 에러. Do는 더 시도하지 않고 감싼 에러를 그대로 반환
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
 func Do(ctx context.Context, cfg Config, fn func(attempt int) error) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -36,6 +49,10 @@ func Do(ctx context.Context, cfg Config, fn func(attempt int) error) error {
 			return nil
 		}
 
+		if p, ok := errors.AsType[*permanentError](err); ok {
+			return p.err
+		}
+
 		if cfg.MaxAttempts > 0 && attempt >= cfg.MaxAttempts {
 			return err
 		}
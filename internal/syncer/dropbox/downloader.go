@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"synco/internal/auth"
+	"synco/internal/ignore"
 	"synco/internal/logger"
 	"synco/internal/model"
 	"synco/internal/syncer"
@@ -20,9 +21,12 @@ type Downloader struct {
 	folderPath string
 	dst        string
 	client     files.Client
+	workers    int
+	ignore     *ignore.Matcher
 }
 
-func NewDownloader(folderPath, dst string) (*Downloader, error) {
+// NewDownloader workers는 Run에서 동시에 받는 파일 수. ig가 무시하는 경로는 전체 동기화에서 받지 않음
+func NewDownloader(folderPath, dst string, workers int, ig *ignore.Matcher) (*Downloader, error) {
 	absDst, err := filepath.Abs(dst)
 	if err != nil {
 		return nil, fmt.Errorf("invalid dst path: %w", err)
@@ -41,11 +45,13 @@ func NewDownloader(folderPath, dst string) (*Downloader, error) {
 		folderPath: normalizePath(folderPath),
 		dst:        absDst,
 		client:     client,
+		workers:    workers,
+		ignore:     ig,
 	}, nil
 }
 
 func (s *Downloader) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
-	return syncer.RunLoop(inCh, s.handle)
+	return syncer.RunLoop(inCh, s.workers, s.handle)
 }
 
 func (s *Downloader) FullSync() ([]model.SyncResult, error) {
@@ -57,7 +63,7 @@ func (s *Downloader) FullSync() ([]model.SyncResult, error) {
 		return nil, fmt.Errorf("failed to list dropbox folder: %w", err)
 	}
 
-	var results []model.SyncResult
+	var events []model.FileEvent
 	for {
 		for _, entry := range resp.Entries {
 			f, ok := entry.(*files.FileMetadata)
@@ -66,17 +72,14 @@ func (s *Downloader) FullSync() ([]model.SyncResult, error) {
 			}
 
 			relPath := toRelPath(s.folderPath, f.PathDisplay)
-			if relPath == "" {
+			if relPath == "" || s.ignore.Ignored(relPath, false) {
 				continue
 			}
 
-			localPath := filepath.Join(s.dst, filepath.FromSlash(relPath))
-			result := model.SyncResult{
-				SrcPath: "dropbox:" + relPath,
-				DstPath: localPath,
-			}
-			result.Err = s.downloadFile(relPath, localPath)
-			results = append(results, result)
+			events = append(events, model.FileEvent{
+				Type: model.EventWrite,
+				Path: relPath,
+			})
 		}
 
 		if !resp.HasMore {
@@ -85,7 +88,7 @@ func (s *Downloader) FullSync() ([]model.SyncResult, error) {
 
 		cont, err := s.client.ListFolderContinue(files.NewListFolderContinueArg(resp.Cursor))
 		if err != nil {
-			return results, fmt.Errorf("failed to continue listing: %w", err)
+			return nil, fmt.Errorf("failed to continue listing: %w", err)
 		}
 
 		resp = &files.ListFolderResult{
@@ -95,22 +98,39 @@ func (s *Downloader) FullSync() ([]model.SyncResult, error) {
 		}
 	}
 
-	return results, nil
+	return syncer.RunAll(events, s.workers, s.handle), nil
 }
 
 func (s *Downloader) handle(event model.FileEvent) model.SyncResult {
-	localPath := filepath.Join(s.dst, filepath.FromSlash(event.Path))
+	localPath, err := util.SafeJoin(s.dst, event.Path)
 	result := model.SyncResult{
 		Event:   event,
 		SrcPath: "dropbox:" + event.Path,
 		DstPath: localPath,
 	}
 
+	// 원격 이름이 dst를 벗어나면 내려받지도 삭제하지도 않음
+	if err != nil {
+		logger.Log.Warn("dropbox path rejected",
+			zap.String("path", event.Path),
+			zap.Error(err))
+
+		result.Err = err
+		return result
+	}
+
 	switch event.Type {
 	case model.EventWrite, model.EventCreate:
-		result.Err = s.downloadFile(event.Path, localPath)
-	case model.EventRemove, model.EventRename:
-		result.Err = util.RemoveIfExists(localPath)
+		if event.IsDir {
+			result.Err = os.MkdirAll(localPath, 0755)
+		} else {
+			result.Err = s.downloadFile(event.Path, localPath)
+		}
+	case model.EventRemove:
+		// 원격에서 지운 폴더는 종류를 알 수 없는 경우가 있으므로 항상 그 아래까지 지움
+		result.Err = util.RemoveAllIfExists(localPath)
+	case model.EventRename:
+		result.Err = s.move(event.OldPath, event.Path, localPath)
 	}
 
 	if result.Err != nil {
@@ -126,11 +146,26 @@ func (s *Downloader) handle(event model.FileEvent) model.SyncResult {
 	return result
 }
 
+// move 로컬에 이전 경로가 없으면 새 경로의 내용을 내려받음
+func (s *Downloader) move(oldRel, newRel, localPath string) error {
+	oldPath, err := util.SafeJoin(s.dst, oldRel)
+	if err != nil {
+		return err
+	}
+
+	moved, err := util.MoveIfExists(oldPath, localPath)
+	if err != nil || moved {
+		return err
+	}
+
+	return s.downloadFile(newRel, localPath)
+}
+
 func (s *Downloader) downloadFile(relPath, localPath string) error {
 	dropboxPath := s.folderPath + "/" + strings.TrimPrefix(relPath, "/")
 
 	arg := files.NewDownloadArg(dropboxPath)
-	_, content, err := s.client.Download(arg)
+	res, content, err := s.client.Download(arg)
 	if err != nil {
 		return fmt.Errorf("failed to download from dropbox: %w", err)
 	}
@@ -139,5 +174,5 @@ func (s *Downloader) downloadFile(relPath, localPath string) error {
 		_ = content.Close()
 	}(content)
 
-	return util.AtomicWrite(localPath, content)
+	return util.AtomicWrite(localPath, content, util.FileMeta{ModTime: res.ClientModified})
 }
@@ -234,7 +234,17 @@ func (p *Source) handleEntry(entry files.IsMetadata) {
 		}
 
 	case *files.FolderMetadata:
-		return
+		relPath := toRelPath(p.folderPath, e.PathDisplay)
+		if relPath == "" {
+			return
+		}
+
+		event = model.FileEvent{
+			Type:      model.EventCreate,
+			Path:      relPath,
+			IsDir:     true,
+			Timestamp: time.Now(),
+		}
 	}
 
 	select {
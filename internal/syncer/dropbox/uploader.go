@@ -1,16 +1,22 @@
 package dropbox
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"synco/internal/auth"
+	"synco/internal/bandwidth"
+	"synco/internal/ignore"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
 	"synco/internal/retry"
 	"synco/internal/syncer"
+	"synco/internal/util"
 	"time"
 
 	"github.com/dropbox/dropbox-sdk-go-unofficial/v6/dropbox"
@@ -27,9 +33,16 @@ type Uploader struct {
 	src        string
 	folderPath string
 	client     files.Client
+	limiter    *bandwidth.Limiter
+	workers    int
+	index      *index.Index
+	ignore     *ignore.Matcher
 }
 
-func NewUploader(src, folderPath string) (*Uploader, error) {
+// NewUploader limiter가 nil이면 속도를 제한하지 않음. workers는 Run에서 동시에 올리는 파일 수.
+// ix가 있으면 전체 동기화에서 마지막으로 올린 뒤 바뀌지 않은 파일은 다시 올리지 않음.
+// ig가 무시하는 경로는 전체 동기화와 디렉터리 업로드에서 뺌
+func NewUploader(src, folderPath string, limiter *bandwidth.Limiter, workers int, ix *index.Index, ig *ignore.Matcher) (*Uploader, error) {
 	absSrc, err := filepath.Abs(src)
 	if err != nil {
 		return nil, fmt.Errorf("invalid src path: %w", err)
@@ -53,31 +66,48 @@ func NewUploader(src, folderPath string) (*Uploader, error) {
 		src:        absSrc,
 		folderPath: folderPath,
 		client:     client,
+		limiter:    limiter,
+		workers:    workers,
+		index:      ix,
+		ignore:     ig,
 	}, nil
 }
 
 func (s *Uploader) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
-	return syncer.RunLoop(inCh, s.handle)
+	return syncer.RunLoop(inCh, s.workers, s.handle)
 }
 
 func (s *Uploader) FullSync() ([]model.SyncResult, error) {
-	var results []model.SyncResult
+	var events []model.FileEvent
 
-	err := filepath.WalkDir(s.src, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := filepath.WalkDir(s.src, s.ignore.WalkFunc(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
 			return err
 		}
 
-		results = append(results, s.handle(model.FileEvent{
+		// 다른 디렉터리는 안의 파일을 올리면서 만들어지므로 빈 디렉터리만 따로 만듦
+		if d.IsDir() && (path == s.src || !util.IsEmptyDir(path)) {
+			return nil
+		}
+
+		if s.uploaded(path, d) {
+			return nil
+		}
+
+		events = append(events, model.FileEvent{
 			Type:      model.EventWrite,
 			Path:      path,
+			IsDir:     d.IsDir(),
 			Timestamp: time.Now(),
-		}))
+		})
 
 		return nil
-	})
+	}))
+	if err != nil {
+		return nil, err
+	}
 
-	return results, err
+	return syncer.RunAll(events, s.workers, s.handle), nil
 }
 
 func (s *Uploader) handle(event model.FileEvent) model.SyncResult {
@@ -89,9 +119,18 @@ func (s *Uploader) handle(event model.FileEvent) model.SyncResult {
 
 	switch event.Type {
 	case model.EventCreate, model.EventWrite:
-		result.Err = s.uploadFile(event.Path)
-	case model.EventRemove, model.EventRename:
-		result.Err = s.deleteFile(event.Path)
+		if event.IsDir {
+			result.Err = s.createFolder(event.Path)
+		} else {
+			result.Err = s.uploadFile(event.Path)
+		}
+	case model.EventRemove:
+		// Dropbox는 폴더를 지우면 그 안의 항목도 함께 지움
+		if result.Err = s.deleteFile(event.Path); result.Err == nil {
+			s.index.Forget(event.Path)
+		}
+	case model.EventRename:
+		result.Err = s.moveFile(event.OldPath, event.Path)
 	}
 
 	if result.Err != nil {
@@ -113,37 +152,69 @@ func (s *Uploader) uploadFile(localPath string) error {
 		return fmt.Errorf("failed to stat file: %w", err)
 	}
 
+	// 세션으로 나눠 올리는 파일은 재시도할 때 다시 읽으므로 해시를 기록하지 않음
+	var res *files.FileMetadata
+	var hash []byte
 	if info.Size() < sessionThreshold {
-		return s.uploadSmallFile(localPath)
+		res, hash, err = s.uploadSmallFile(localPath)
+	} else {
+		res, err = s.uploadLargeFile(localPath, info.Size())
+	}
+	if err != nil {
+		return err
 	}
 
-	return s.uploadLargeFile(localPath, info.Size())
+	s.index.Record(localPath, info, hash, res.Id, res.Rev)
+	return nil
 }
 
-func (s *Uploader) uploadSmallFile(localPath string) error {
+// uploaded 마지막으로 올린 뒤 바뀌지 않은 파일이면 true
+func (s *Uploader) uploaded(path string, d fs.DirEntry) bool {
+	if !d.Type().IsRegular() {
+		return false
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+
+	state, ok := s.index.Unchanged(path, info)
+	return ok && state.RemoteID != ""
+}
+
+func (s *Uploader) uploadSmallFile(localPath string) (*files.FileMetadata, []byte, error) {
 	dropboxPath := s.folderPath + "/" + s.relPath(localPath)
 
 	f, err := os.Open(localPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	defer func(f *os.File) {
 		_ = f.Close()
 	}(f)
 
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
 	arg := files.NewUploadArg(dropboxPath)
 	arg.Mode = &files.WriteMode{Tagged: dropbox.Tagged{Tag: "overwrite"}}
 	arg.Autorename = false
+	arg.ClientModified = clientModified(info)
 
-	if _, err := s.client.Upload(arg, f); err != nil {
-		return fmt.Errorf("failed to upload to dropbox: %w", err)
+	h := sha256.New()
+	res, err := s.client.Upload(arg, s.limiter.Reader(io.TeeReader(f, h)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to upload to dropbox: %w", err)
 	}
 
-	return nil
+	return res, h.Sum(nil), nil
 }
 
-func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) error {
+func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) (*files.FileMetadata, error) {
 	dropboxPath := s.folderPath + "/" + s.relPath(localPath)
 
 	logger.Log.Info("starting upload session",
@@ -152,20 +223,25 @@ func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) error {
 
 	f, err := os.Open(localPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	defer func(f *os.File) {
 		_ = f.Close()
 	}(f)
 
-	firstChunk := io.LimitReader(f, chunkSize)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	firstChunk := s.limiter.Reader(io.LimitReader(f, chunkSize))
 	startArg := files.NewUploadSessionStartArg()
 	startArg.Close = false
 
 	session, err := s.client.UploadSessionStart(startArg, firstChunk)
 	if err != nil {
-		return fmt.Errorf("failed to start upload session: %w", err)
+		return nil, fmt.Errorf("failed to start upload session: %w", err)
 	}
 
 	sessionID := session.SessionId
@@ -173,7 +249,7 @@ func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) error {
 	remaining := totalSize - chunkSize
 
 	for remaining > chunkSize {
-		chunk := io.LimitReader(f, chunkSize)
+		chunk := s.limiter.Reader(io.LimitReader(f, chunkSize))
 		cursor := files.NewUploadSessionCursor(sessionID, offset)
 		appendArg := files.NewUploadSessionAppendArg(cursor)
 		appendArg.Close = false
@@ -188,25 +264,27 @@ func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) error {
 				if _, err := f.Seek(int64(offset), io.SeekStart); err != nil {
 					return fmt.Errorf("failed to seek: %w", err)
 				}
-				chunk = io.LimitReader(f, chunkSize)
+				chunk = s.limiter.Reader(io.LimitReader(f, chunkSize))
 			}
 
 			return s.client.UploadSessionAppendV2(appendArg, chunk)
 		}); err != nil {
-			return fmt.Errorf("failed to append chunk at offset %d: %w", offset, err)
+			return nil, fmt.Errorf("failed to append chunk at offset %d: %w", offset, err)
 		}
 
 		offset += uint64(chunkSize)
 		remaining -= chunkSize
 	}
 
-	lastChunk := io.LimitReader(f, remaining)
+	lastChunk := s.limiter.Reader(io.LimitReader(f, remaining))
 	cursor := files.NewUploadSessionCursor(sessionID, offset)
 	commitInfo := files.NewCommitInfo(dropboxPath)
 	commitInfo.Mode = &files.WriteMode{Tagged: dropbox.Tagged{Tag: "overwrite"}}
 	commitInfo.Autorename = false
+	commitInfo.ClientModified = clientModified(info)
 	finishArg := files.NewUploadSessionFinishArg(cursor, commitInfo)
 
+	var res *files.FileMetadata
 	if err := retry.Do(nil, retry.Config{
 		MaxAttempts: 3,
 		BaseDelay:   2 * time.Second,
@@ -217,18 +295,87 @@ func (s *Uploader) uploadLargeFile(localPath string, totalSize int64) error {
 				return fmt.Errorf("failed to seek: %w", err)
 			}
 
-			lastChunk = io.LimitReader(f, remaining)
+			lastChunk = s.limiter.Reader(io.LimitReader(f, remaining))
 		}
 
-		_, err := s.client.UploadSessionFinish(finishArg, lastChunk)
+		var err error
+		res, err = s.client.UploadSessionFinish(finishArg, lastChunk)
 		return err
 	}); err != nil {
-		return fmt.Errorf("failed to finish upload session: %w", err)
+		return nil, fmt.Errorf("failed to finish upload session: %w", err)
 	}
 
 	logger.Log.Info("upload session complete",
 		zap.String("file", filepath.Base(localPath)))
 
+	return res, nil
+}
+
+// moveFile 서버에서 옮겨 내용을 다시 올리지 않음. Dropbox에 이전 경로가 없으면 새로 올림
+func (s *Uploader) moveFile(oldLocal, newLocal string) error {
+	arg := files.NewRelocationArg(
+		s.folderPath+"/"+s.relPath(oldLocal),
+		s.folderPath+"/"+s.relPath(newLocal),
+	)
+	arg.Autorename = false
+
+	_, err := s.client.MoveV2(arg)
+	if isMoveConflict(err) {
+		// 로컬에서 덮어쓴 경우이므로 대상의 파일을 지우고 다시 옮김
+		if err := s.deleteFile(newLocal); err != nil {
+			return err
+		}
+
+		_, err = s.client.MoveV2(arg)
+	}
+
+	if isMoveSourceMissing(err) {
+		if err := s.uploadTree(newLocal); err != nil {
+			return err
+		}
+
+		s.index.Forget(oldLocal)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move in dropbox: %w", err)
+	}
+
+	s.index.Move(oldLocal, newLocal)
+	return nil
+}
+
+// uploadTree 디렉터리이면 빈 디렉터리를 포함해 그 아래를 모두 올림
+func (s *Uploader) uploadTree(localPath string) error {
+	var errs []error
+	err := filepath.WalkDir(localPath, s.ignore.WalkFunc(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if util.IsEmptyDir(path) {
+				err = s.createFolder(path)
+			}
+		} else {
+			err = s.uploadFile(path)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		return nil
+	}))
+
+	return errors.Join(append(errs, err)...)
+}
+
+func (s *Uploader) createFolder(localPath string) error {
+	if err := ensureFolder(s.client, s.folderPath+"/"+s.relPath(localPath)); err != nil {
+		return fmt.Errorf("failed to create dropbox folder: %w", err)
+	}
+
 	return nil
 }
 
@@ -2,8 +2,10 @@ package dropbox
 
 import (
 	"errors"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dropbox/dropbox-sdk-go-unofficial/v6/dropbox/files"
 )
@@ -68,3 +70,29 @@ func isConflict(err error) bool {
 
 	return false
 }
+
+func isMoveSourceMissing(err error) bool {
+	if apiErr, ok := errors.AsType[files.MoveV2APIError](err); ok {
+		return apiErr.EndpointError != nil &&
+			apiErr.EndpointError.FromLookup != nil &&
+			apiErr.EndpointError.FromLookup.Tag == "not_found"
+	}
+
+	return false
+}
+
+func isMoveConflict(err error) bool {
+	if apiErr, ok := errors.AsType[files.MoveV2APIError](err); ok {
+		return apiErr.EndpointError != nil &&
+			apiErr.EndpointError.To != nil &&
+			apiErr.EndpointError.To.Tag == "conflict"
+	}
+
+	return false
+}
+
+// clientModified Dropbox는 초 단위 UTC 시각만 받으므로 잘라서 보냄
+func clientModified(info os.FileInfo) *time.Time {
+	t := info.ModTime().UTC().Truncate(time.Second)
+	return &t
+}
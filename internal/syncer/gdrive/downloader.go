@@ -8,10 +8,12 @@ import (
 	"path/filepath"
 	"strings"
 	"synco/internal/auth"
+	"synco/internal/ignore"
 	"synco/internal/logger"
 	"synco/internal/model"
 	"synco/internal/syncer"
 	"synco/internal/util"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/api/drive/v3"
@@ -22,9 +24,12 @@ type Downloader struct {
 	dst      string
 	svc      *drive.Service
 	helper   *Uploader
+	workers  int
+	ignore   *ignore.Matcher
 }
 
-func NewDownloader(folderPath, dst string) (*Downloader, error) {
+// NewDownloader workers는 Run에서 동시에 받는 파일 수. ig가 무시하는 경로는 전체 동기화에서 받지 않음
+func NewDownloader(folderPath, dst string, workers int, ig *ignore.Matcher) (*Downloader, error) {
 	absDst, err := filepath.Abs(dst)
 	if err != nil {
 		return nil, fmt.Errorf("invalid dst path: %w", err)
@@ -51,11 +56,13 @@ func NewDownloader(folderPath, dst string) (*Downloader, error) {
 		dst:      absDst,
 		svc:      svc,
 		helper:   helper,
+		workers:  workers,
+		ignore:   ig,
 	}, nil
 }
 
 func (s *Downloader) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
-	return syncer.RunLoop(inCh, s.handle)
+	return syncer.RunLoop(inCh, s.workers, s.handle)
 }
 
 func (s *Downloader) FullSync() ([]model.SyncResult, error) {
@@ -64,33 +71,51 @@ func (s *Downloader) FullSync() ([]model.SyncResult, error) {
 		return nil, fmt.Errorf("failed to list gdrive files: %w", err)
 	}
 
-	var results []model.SyncResult
+	events := make([]model.FileEvent, 0, len(files))
 	for _, f := range files {
-		localPath := filepath.Join(s.dst, filepath.FromSlash(f.relPath))
-		result := model.SyncResult{
-			SrcPath: "gdrive:" + f.relPath,
-			DstPath: localPath,
+		if s.ignore.Ignored(f.relPath, false) {
+			continue
 		}
-		result.Err = s.downloadFile(f.relPath, localPath)
-		results = append(results, result)
+
+		events = append(events, model.FileEvent{
+			Type: model.EventWrite,
+			Path: f.relPath,
+		})
 	}
 
-	return results, nil
+	return syncer.RunAll(events, s.workers, s.handle), nil
 }
 
 func (s *Downloader) handle(event model.FileEvent) model.SyncResult {
-	localPath := filepath.Join(s.dst, filepath.FromSlash(event.Path))
+	localPath, err := util.SafeJoin(s.dst, event.Path)
 	result := model.SyncResult{
 		Event:   event,
 		SrcPath: "gdrive:" + event.Path,
 		DstPath: localPath,
 	}
 
+	// 원격 이름이 dst를 벗어나면 내려받지도 삭제하지도 않음
+	if err != nil {
+		logger.Log.Warn("gdrive path rejected",
+			zap.String("path", event.Path),
+			zap.Error(err))
+
+		result.Err = err
+		return result
+	}
+
 	switch event.Type {
 	case model.EventWrite, model.EventCreate:
-		result.Err = s.downloadFile(event.Path, localPath)
-	case model.EventRemove, model.EventRename:
-		result.Err = util.RemoveIfExists(localPath)
+		if event.IsDir {
+			result.Err = os.MkdirAll(localPath, 0755)
+		} else {
+			result.Err = s.downloadFile(event.Path, localPath)
+		}
+	case model.EventRemove:
+		// 원격에서 지운 폴더는 종류를 알 수 없는 경우가 있으므로 항상 그 아래까지 지움
+		result.Err = util.RemoveAllIfExists(localPath)
+	case model.EventRename:
+		result.Err = s.move(event.OldPath, event.Path, localPath)
 	}
 
 	if result.Err != nil {
@@ -106,6 +131,21 @@ func (s *Downloader) handle(event model.FileEvent) model.SyncResult {
 	return result
 }
 
+// move 로컬에 이전 경로가 없으면 새 경로의 내용을 내려받음
+func (s *Downloader) move(oldRel, newRel, localPath string) error {
+	oldPath, err := util.SafeJoin(s.dst, oldRel)
+	if err != nil {
+		return err
+	}
+
+	moved, err := util.MoveIfExists(oldPath, localPath)
+	if err != nil || moved {
+		return err
+	}
+
+	return s.downloadFile(newRel, localPath)
+}
+
 func (s *Downloader) downloadFile(relPath, localPath string) error {
 	parts := strings.Split(relPath, "/")
 	fileName := parts[len(parts)-1]
@@ -125,6 +165,16 @@ func (s *Downloader) downloadFile(relPath, localPath string) error {
 		return fmt.Errorf("file not found on gdrive: %s", relPath)
 	}
 
+	file, err := s.svc.Files.Get(fileID).Fields("modifiedTime").Do()
+	if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	var meta util.FileMeta
+	if modTime, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil {
+		meta.ModTime = modTime
+	}
+
 	resp, err := s.svc.Files.Get(fileID).Download()
 	if err != nil {
 		return fmt.Errorf("failed to download: %w", err)
@@ -134,7 +184,7 @@ func (s *Downloader) downloadFile(relPath, localPath string) error {
 		_ = Body.Close()
 	}(resp.Body)
 
-	return util.AtomicWrite(localPath, resp.Body)
+	return util.AtomicWrite(localPath, resp.Body, meta)
 }
 
 type gdriveFileEntry struct {
@@ -211,9 +211,11 @@ func (p *Source) handleChange(change *drive.Change) {
 			event := model.FileEvent{
 				Type:      model.EventRemove,
 				Path:      relPath,
+				IsDir:     p.knownDirs[change.FileId],
 				Timestamp: time.Now(),
 			}
 			delete(p.pathByID, change.FileId)
+			delete(p.knownDirs, change.FileId)
 			select {
 			case p.eventCh <- event:
 			case <-p.stopCh:
@@ -225,12 +227,9 @@ func (p *Source) handleChange(change *drive.Change) {
 
 	file := change.File
 
-	if file.MimeType == "application/vnd.google-apps.folder" {
-		if p.isUnderTarget(file.Parents) {
-			p.knownDirs[change.FileId] = true
-		}
-
-		return
+	isDir := file.MimeType == "application/vnd.google-apps.folder"
+	if isDir && p.isUnderTarget(file.Parents) {
+		p.knownDirs[change.FileId] = true
 	}
 
 	if !p.isUnderTarget(file.Parents) {
@@ -249,6 +248,7 @@ func (p *Source) handleChange(change *drive.Change) {
 	event := model.FileEvent{
 		Type:      model.EventWrite,
 		Path:      relPath,
+		IsDir:     isDir,
 		Timestamp: time.Now(),
 	}
 
@@ -2,17 +2,27 @@ package gdrive
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"synco/internal/auth"
+	"synco/internal/bandwidth"
+	"synco/internal/ignore"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
 	"synco/internal/retry"
 	"synco/internal/syncer"
+	"synco/internal/util"
 	"time"
 
 	"go.uber.org/zap"
@@ -29,9 +39,19 @@ type Uploader struct {
 	svc        *drive.Service
 	rootID     string
 	idCache    map[string]string
+	limiter    *bandwidth.Limiter
+	workers    int
+	index      *index.Index
+	ignore     *ignore.Matcher
+
+	// 여러 worker가 같은 폴더를 중복으로 만들지 않도록 폴더 생성을 직렬화
+	folderMu sync.Mutex
 }
 
-func NewUploader(src, folderPath string) (*Uploader, error) {
+// NewUploader limiter가 nil이면 속도를 제한하지 않음. workers는 Run에서 동시에 올리는 파일 수.
+// ix가 있으면 파일 ID를 다시 시작한 뒤에도 기억하고, 마지막으로 올린 뒤 바뀌지 않은 파일은 다시 올리지 않음.
+// ig가 무시하는 경로는 전체 동기화와 디렉터리 업로드에서 뺌
+func NewUploader(src, folderPath string, limiter *bandwidth.Limiter, workers int, ix *index.Index, ig *ignore.Matcher) (*Uploader, error) {
 	absSrc, err := filepath.Abs(src)
 	if err != nil {
 		return nil, fmt.Errorf("invalid src path: %w", err)
@@ -48,6 +68,10 @@ func NewUploader(src, folderPath string) (*Uploader, error) {
 		folderPath: strings.TrimPrefix(folderPath, "/"),
 		svc:        svc,
 		idCache:    make(map[string]string),
+		limiter:    limiter,
+		workers:    workers,
+		index:      ix,
+		ignore:     ig,
 	}
 
 	rootID, err := s.ensureFolderPath(folderPath)
@@ -65,27 +89,40 @@ func NewUploader(src, folderPath string) (*Uploader, error) {
 }
 
 func (s *Uploader) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
-	return syncer.RunLoop(inCh, s.handle)
+	return syncer.RunLoop(inCh, s.workers, s.handle)
 }
 
 func (s *Uploader) FullSync() ([]model.SyncResult, error) {
-	var results []model.SyncResult
+	var events []model.FileEvent
 
-	err := filepath.WalkDir(s.src, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	err := filepath.WalkDir(s.src, s.ignore.WalkFunc(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
 			return err
 		}
 
-		results = append(results, s.handle(model.FileEvent{
+		// 다른 디렉터리는 안의 파일을 올리면서 만들어지므로 빈 디렉터리만 따로 만듦
+		if d.IsDir() && (path == s.src || !util.IsEmptyDir(path)) {
+			return nil
+		}
+
+		if s.uploaded(path, d) {
+			return nil
+		}
+
+		events = append(events, model.FileEvent{
 			Type:      model.EventWrite,
 			Path:      path,
+			IsDir:     d.IsDir(),
 			Timestamp: time.Now(),
-		}))
+		})
 
 		return nil
-	})
+	}))
+	if err != nil {
+		return nil, err
+	}
 
-	return results, err
+	return syncer.RunAll(events, s.workers, s.handle), nil
 }
 
 func (s *Uploader) handle(event model.FileEvent) model.SyncResult {
@@ -97,9 +134,19 @@ func (s *Uploader) handle(event model.FileEvent) model.SyncResult {
 
 	switch event.Type {
 	case model.EventCreate, model.EventWrite:
-		result.Err = s.uploadFile(event.Path)
-	case model.EventRemove, model.EventRename:
-		result.Err = s.deleteFile(event.Path)
+		if event.IsDir {
+			_, result.Err = s.ensureFolders(s.relPath(event.Path))
+		} else {
+			result.Err = s.uploadFile(event.Path)
+		}
+	case model.EventRemove:
+		if event.IsDir {
+			result.Err = s.deleteFolder(event.Path)
+		} else {
+			result.Err = s.deleteFile(event.Path)
+		}
+	case model.EventRename:
+		result.Err = s.moveFile(event.OldPath, event.Path)
 	}
 
 	if result.Err != nil {
@@ -123,7 +170,7 @@ func (s *Uploader) uploadFile(localPath string) error {
 	}
 
 	fileName := filepath.Base(localPath)
-	existingID := s.getCachedID(relPath)
+	existingID := s.cachedFileID(relPath)
 	if existingID == "" {
 		existingID, _ = s.findFile(fileName, parentID)
 	}
@@ -142,63 +189,236 @@ func (s *Uploader) uploadFile(localPath string) error {
 			_ = f.Close()
 		}(f)
 
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		// 내려받을 때 로컬 수정 시각을 되살릴 수 있도록 함께 기록
+		modifiedTime := info.ModTime().UTC().Format(time.RFC3339Nano)
+		h := sha256.New()
+		media := s.limiter.Reader(io.TeeReader(f, h))
+
+		var uploaded *drive.File
 		if existingID != "" {
-			_, err = s.svc.Files.Update(existingID, &drive.File{}).
-				Media(f, googleapi.ChunkSize(chunkSize)).
-				Do()
+			uploaded, err = s.svc.Files.Update(existingID, &drive.File{ModifiedTime: modifiedTime}).
+				Media(media, googleapi.ChunkSize(chunkSize)).
+				Fields("id, version").Do()
+			if isNotFound(err) {
+				// 기록된 ID의 파일이 Drive에서 지워졌으면 다음 시도에서 새로 만듦
+				existingID = ""
+				s.deleteCachedID(relPath)
+			}
 			if err != nil {
 				return fmt.Errorf("resumable update failed: %w", err)
 			}
-
-			s.setCachedID(relPath, existingID)
 		} else {
-			created, err := s.svc.Files.Create(&drive.File{
-				Name:    fileName,
-				Parents: []string{parentID},
-			}).Media(f, googleapi.ChunkSize(chunkSize)).
-				Fields("id").Do()
+			uploaded, err = s.svc.Files.Create(&drive.File{
+				Name:         fileName,
+				Parents:      []string{parentID},
+				ModifiedTime: modifiedTime,
+			}).Media(media, googleapi.ChunkSize(chunkSize)).
+				Fields("id, version").Do()
 			if err != nil {
 				return fmt.Errorf("resumable create failed: %w", err)
 			}
-			s.setCachedID(relPath, created.Id)
-			existingID = created.Id
 		}
 
+		s.setCachedID(relPath, uploaded.Id)
+		existingID = uploaded.Id
+		s.index.Record(localPath, info, h.Sum(nil), uploaded.Id, strconv.FormatInt(uploaded.Version, 10))
+
 		return nil
 	})
 }
 
-func (s *Uploader) deleteFile(localPath string) error {
-	relPath := s.relPath(localPath)
+// uploaded 마지막으로 올린 뒤 바뀌지 않은 파일이면 true
+func (s *Uploader) uploaded(path string, d fs.DirEntry) bool {
+	if !d.Type().IsRegular() {
+		return false
+	}
 
-	fileID := s.getCachedID(relPath)
-	if fileID == "" {
-		fileName := filepath.Base(localPath)
-		parentPath := filepath.Dir(localPath)
-		parentID, err := s.findFolderByPath(parentPath)
-		if err != nil || parentID == "" {
-			return nil // 부모 폴더가 없으면 이미 삭제된 것
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+
+	state, ok := s.index.Unchanged(path, info)
+	return ok && state.RemoteID != ""
+}
+
+// uploadTree 디렉터리이면 빈 디렉터리를 포함해 그 아래를 모두 올림
+func (s *Uploader) uploadTree(localPath string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return s.uploadFile(localPath)
+	}
+
+	var errs []error
+	err := filepath.WalkDir(localPath, s.ignore.WalkFunc(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if util.IsEmptyDir(path) {
+				_, err = s.ensureFolders(s.relPath(path))
+			}
+		} else {
+			err = s.uploadFile(path)
 		}
 
-		fileID, _ = s.findFile(fileName, parentID)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		return nil
+	}))
+
+	return errors.Join(append(errs, err)...)
+}
+
+// moveFile Drive에서 이름과 부모 폴더만 바꾸어 내용을 다시 올리지 않음. Drive에 이전 경로가 없으면 새로 올림
+func (s *Uploader) moveFile(oldLocal, newLocal string) error {
+	info, err := os.Stat(newLocal)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	oldRel, newRel := s.relPath(oldLocal), s.relPath(newLocal)
+	name := path.Base(newRel)
+
+	var fileID string
+	if info.IsDir() {
+		fileID, _ = s.findFolderByPath(oldRel)
+	} else {
+		fileID = s.lookupFile(oldRel)
 	}
 
 	if fileID == "" {
-		return nil
+		return s.reuploadTree(oldLocal, newLocal, info)
 	}
 
-	if err := s.svc.Files.Delete(fileID).Do(); err != nil {
-		if isNotFound(err) {
-			return nil
+	current, err := s.svc.Files.Get(fileID).Fields("parents", "size").Do()
+	if isNotFound(err) {
+		return s.reuploadTree(oldLocal, newLocal, info)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	// 크기가 다르면 Drive의 이전 파일은 옮겨온 파일이 아니므로 옮기지 않고 새로 올림.
+	// 로컬에서도 이전 경로가 사라졌으면 Drive의 이전 파일을 지움
+	if !info.IsDir() && current.Size != info.Size() {
+		if _, err := os.Lstat(oldLocal); os.IsNotExist(err) {
+			if err := s.deleteFile(oldLocal); err != nil {
+				return err
+			}
 		}
 
+		return s.reuploadTree(oldLocal, newLocal, info)
+	}
+
+	parentID, err := s.ensureParentFolders(newRel)
+	if err != nil {
+		return fmt.Errorf("failed to create parent folders: %w", err)
+	}
+
+	// 덮어쓴 파일이 Drive에 남아 같은 이름의 파일이 둘이 되지 않도록 지움
+	if !info.IsDir() {
+		if existingID, _ := s.findFile(name, parentID); existingID != "" && existingID != fileID {
+			if err := s.svc.Files.Delete(existingID).Do(); err != nil && !isNotFound(err) {
+				return fmt.Errorf("failed to replace file: %w", err)
+			}
+		}
+	}
+
+	call := s.svc.Files.Update(fileID, &drive.File{Name: name})
+	if !slices.Contains(current.Parents, parentID) {
+		call = call.AddParents(parentID).RemoveParents(strings.Join(current.Parents, ","))
+	}
+
+	if _, err := call.Do(); err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	s.forget(oldRel)
+	if !info.IsDir() {
+		s.setCachedID(newRel, fileID)
+	}
+	s.index.Move(oldLocal, newLocal)
+
+	return nil
+}
+
+// reuploadTree 이동할 원본을 Drive에서 찾지 못했을 때 새 경로를 올리고 이전 경로의 기록을 지움
+func (s *Uploader) reuploadTree(oldLocal, newLocal string, info os.FileInfo) error {
+	if err := s.uploadTree(newLocal, info); err != nil {
+		return err
+	}
+
+	s.forget(s.relPath(oldLocal))
+	s.index.Forget(oldLocal)
+	return nil
+}
+
+// deleteFolder Drive는 폴더를 지우면 그 안의 항목도 함께 지움
+func (s *Uploader) deleteFolder(localPath string) error {
+	relPath := s.relPath(localPath)
+
+	folderID := s.getCachedID("__dir__/" + relPath)
+	if folderID == "" {
+		var err error
+		if folderID, err = s.findFolderByPath(relPath); err != nil {
+			return fmt.Errorf("failed to find folder: %w", err)
+		}
+	}
+
+	if folderID == "" {
+		return nil
+	}
+
+	if err := s.svc.Files.Delete(folderID).Do(); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete folder: %w", err)
+	}
+
+	s.forget(relPath)
+	s.index.Forget(localPath)
+	return nil
+}
+
+func (s *Uploader) deleteFile(localPath string) error {
+	relPath := s.relPath(localPath)
+
+	// 부모 폴더나 파일이 없으면 이미 삭제된 것
+	fileID := s.lookupFile(relPath)
+	if fileID == "" {
+		return nil
+	}
+
+	if err := s.svc.Files.Delete(fileID).Do(); err != nil && !isNotFound(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
 	s.deleteCachedID(relPath)
+	s.index.Forget(localPath)
 	return nil
 }
 
+// lookupFile 캐시에 없으면 부모 폴더에서 찾음. 없으면 빈 문자열
+func (s *Uploader) lookupFile(relPath string) string {
+	if id := s.cachedFileID(relPath); id != "" {
+		return id
+	}
+
+	parentID, err := s.findFolderByPath(path.Dir(relPath))
+	if err != nil || parentID == "" {
+		return ""
+	}
+
+	id, _ := s.findFile(path.Base(relPath), parentID)
+	return id
+}
+
 func (s *Uploader) ensureFolderPath(folderPath string) (string, error) {
 	parts := splitPath(folderPath)
 	if len(parts) == 0 {
@@ -226,18 +446,25 @@ func (s *Uploader) ensureFolderPath(folderPath string) (string, error) {
 }
 
 func (s *Uploader) ensureParentFolders(relPath string) (string, error) {
-	dir := filepath.ToSlash(filepath.Dir(relPath))
+	return s.ensureFolders(path.Dir(relPath))
+}
+
+// ensureFolders dir까지의 폴더를 찾거나 만들고 마지막 폴더의 ID를 반환
+func (s *Uploader) ensureFolders(dir string) (string, error) {
 	if dir == "." || dir == "" {
 		return s.rootID, nil
 	}
 
+	s.folderMu.Lock()
+	defer s.folderMu.Unlock()
+
 	parts := strings.Split(dir, "/")
 	parentID := s.rootID
 
 	for i, part := range parts {
 		cacheKey := strings.Join(parts[:i+1], "/")
 
-		id := s.getCachedID("__dir__" + cacheKey)
+		id := s.getCachedID("__dir__/" + cacheKey)
 		if id != "" {
 			parentID = id
 			continue
@@ -334,6 +561,20 @@ func (s *Uploader) relPath(localPath string) string {
 	return filepath.ToSlash(rel)
 }
 
+// cachedFileID 메모리 캐시에 없으면 파일 인덱스에 기록된 ID. 기록된 파일이 Drive에서 지워졌을 수 있음
+func (s *Uploader) cachedFileID(relPath string) string {
+	if id := s.getCachedID(relPath); id != "" {
+		return id
+	}
+
+	state, ok := s.index.Lookup(filepath.Join(s.src, filepath.FromSlash(relPath)))
+	if !ok {
+		return ""
+	}
+
+	return state.RemoteID
+}
+
 func (s *Uploader) getCachedID(key string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -351,3 +592,16 @@ func (s *Uploader) deleteCachedID(key string) {
 	defer s.mu.Unlock()
 	delete(s.idCache, key)
 }
+
+// forget relPath와 그 아래 경로의 파일과 폴더 ID를 캐시에서 지움
+func (s *Uploader) forget(relPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.idCache {
+		rel := strings.TrimPrefix(key, "__dir__/")
+		if rel == relPath || strings.HasPrefix(rel, relPath+"/") {
+			delete(s.idCache, key)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package local
+
+import "syscall"
+
+// 다른 기기에서 바꾼 내용은 inotify 이벤트가 오지 않는 파일 시스템의 statfs magic
+var networkFSTypes = map[uint32]struct{}{
+	0x6969:     {}, // NFS
+	0x517b:     {}, // SMB
+	0xff534d42: {}, // CIFS
+	0xfe534d42: {}, // SMB2
+	0x65735546: {}, // FUSE
+	0x01021997: {}, // 9P
+	0x00c36400: {}, // Ceph
+	0x5346414f: {}, // AFS
+}
+
+func isNetworkFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+
+	_, ok := networkFSTypes[uint32(st.Type)]
+	return ok
+}
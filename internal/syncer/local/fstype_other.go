@@ -0,0 +1,8 @@
+//go:build !linux
+
+package local
+
+// 파일 시스템 종류를 알아낼 수 없는 플랫폼에서는 감시를 씀
+func isNetworkFS(_ string) bool {
+	return false
+}
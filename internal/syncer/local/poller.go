@@ -0,0 +1,278 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"synco/internal/ignore"
+	"synco/internal/index"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"synco/internal/syncer"
+	"synco/internal/util"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Poller 감시 이벤트를 받을 수 없는 NFS, SMB, FUSE 마운트나 inotify 한도를 넘는 큰 디렉터리를 위해
+// interval마다 디렉터리 전체를 stat하여 파일 기록과 비교함. 이동은 삭제와 생성으로 나타남
+type Poller struct {
+	path     string
+	interval time.Duration
+	symlinks model.SymlinkPolicy
+	index    *index.Index
+	ignore   *ignore.Matcher
+	eventCh  chan model.FileEvent
+	doneCh   chan struct{}
+}
+
+// entry 훑은 항목의 종류, 크기와 수정 시각
+type entry struct {
+	typ     fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+// NewPoller ix가 있으면 훑을 때마다 그 기록과 비교하므로, 처음 훑을 때 데몬이 멈춰 있던 동안의 변경도 나감.
+// ig가 무시하는 디렉터리는 훑지 않음
+func NewPoller(path string, interval time.Duration, bufSize int, symlinks model.SymlinkPolicy, ix *index.Index, ig *ignore.Matcher) (*Poller, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if _, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("source directory not found: %w", err)
+	}
+
+	return &Poller{
+		path:     absPath,
+		interval: interval,
+		symlinks: symlinks,
+		index:    ix,
+		ignore:   ig,
+		eventCh:  make(chan model.FileEvent, bufSize),
+		doneCh:   make(chan struct{}),
+	}, nil
+}
+
+func (p *Poller) Events() <-chan model.FileEvent {
+	return p.eventCh
+}
+
+func (p *Poller) Start() error {
+	go p.run()
+
+	logger.Log.Info("poller started",
+		zap.String("dir", p.path),
+		zap.Duration("interval", p.interval))
+	return nil
+}
+
+func (p *Poller) Stop() {
+	close(p.doneCh)
+}
+
+func (p *Poller) run() {
+	defer close(p.eventCh)
+
+	// 처음에는 이전에 훑은 결과가 없으므로 파일 기록하고만 비교함
+	prev, ok := p.poll(nil)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.doneCh:
+			return
+		case <-ticker.C:
+			if prev, ok = p.poll(prev); !ok {
+				return
+			}
+		}
+	}
+}
+
+// poll 한 번 훑어 바뀐 항목을 내보내고 다음 비교에 쓸 결과를 반환. 멈췄으면 false
+func (p *Poller) poll(prev map[string]entry) (map[string]entry, bool) {
+	cur, err := scan(p.path, p.symlinks, p.ignore)
+	if err != nil {
+		// 일부만 훑은 결과와 비교하면 읽지 못한 파일이 지워진 것으로 보이므로 이번 주기는 건너뜀
+		logger.Log.Warn("failed to scan source, retrying at next poll",
+			zap.String("dir", p.path),
+			zap.Error(err))
+		return prev, true
+	}
+
+	states, err := p.index.States(p.path)
+	if err != nil {
+		logger.Log.Warn("failed to load file index, retrying at next poll",
+			zap.String("dir", p.path),
+			zap.Error(err))
+		return prev, true
+	}
+
+	// 기록도 이전 결과도 없으면 비교할 기준이 없으므로, 처음 전체 동기화에 맡기고 이번 결과를 기준으로 삼음
+	if prev == nil && len(states) == 0 {
+		return cur, true
+	}
+
+	return cur, p.send(compare(p.path, prev, cur, states, p.ignore))
+}
+
+func (p *Poller) send(events []model.FileEvent) bool {
+	for _, event := range events {
+		select {
+		case p.eventCh <- event:
+		case <-p.doneCh:
+			return false
+		}
+	}
+
+	return true
+}
+
+// scan root 아래의 디렉터리와 파일을 훑음. 링크는 SymlinkCopyAsLink일 때만 링크 자체로 담김.
+// 훑는 동안 지워진 항목은 없는 것으로 보고 넘어가므로, 바쁜 디렉터리에서도 주기 전체가 실패하지 않음
+func scan(root string, symlinks model.SymlinkPolicy, ig *ignore.Matcher) (map[string]entry, error) {
+	entries := make(map[string]entry)
+
+	err := syncer.Walk(root, symlinks, ig.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path != root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if path == root {
+			return nil
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entries[path] = entry{
+			typ:     d.Type(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// compare 훑은 결과를 파일 기록(states)과 비교. 기록과 같은 파일은 동기화된 것으로 보고,
+// 다른 파일은 이전에 훑었을 때와도 달라졌을 때만 내보내 동기화를 기다리는 동안 같은 이벤트를 거듭 내보내지 않음.
+// 기록이 없는 디렉터리는 이전 결과와만 비교함. prev가 nil이면 처음 훑은 것.
+// 지우는 이벤트를 먼저 내보내고, 디렉터리째 지워졌으면 그 디렉터리만 지움
+func compare(root string, prev, cur map[string]entry, states map[string]model.FileState, ig *ignore.Matcher) []model.FileEvent {
+	now := time.Now()
+	var removes, events []model.FileEvent
+
+	removed := make(map[string]struct{})
+	remove := func(path string, isDir bool) {
+		if ig.Ignored(path, isDir) {
+			return
+		}
+
+		top := removedRoot(root, path)
+		if _, ok := removed[top]; ok {
+			return
+		}
+		removed[top] = struct{}{}
+
+		removes = append(removes, model.FileEvent{
+			Type:      model.EventRemove,
+			Path:      top,
+			IsDir:     isDir || top != path,
+			Timestamp: now,
+		})
+	}
+
+	for path, old := range prev {
+		if e, ok := cur[path]; !ok || e.typ != old.typ {
+			remove(path, old.typ.IsDir())
+		}
+	}
+
+	// 기록만 있고 이전 결과에 없는 파일은 이미 지운 것을 내보냈으므로 처음 훑을 때만 봄
+	// 링크를 링크로 복사하지 않게 바뀌었으면 남아 있는 링크의 기록은 지우지 않음
+	if prev == nil {
+		for path := range states {
+			if _, ok := cur[path]; !ok && !util.IsSymlink(path) {
+				remove(path, false)
+			}
+		}
+	}
+
+	for path, e := range cur {
+		old, seen := prev[path]
+
+		if e.typ.IsDir() {
+			// 처음 훑을 때는 다른 디렉터리가 안의 파일을 보내면서 만들어지므로 빈 디렉터리만 만듦
+			if seen && old.typ.IsDir() || prev == nil && !util.IsEmptyDir(path) {
+				continue
+			}
+
+			events = append(events, model.FileEvent{
+				Type:      model.EventCreate,
+				Path:      path,
+				IsDir:     true,
+				Timestamp: now,
+			})
+			continue
+		}
+
+		if seen && old == e {
+			continue
+		}
+
+		state, known := states[path]
+		if known && state.Size == e.size && state.ModTime.Equal(e.modTime) {
+			continue
+		}
+
+		eventType := model.EventWrite
+		if seen && old.typ != e.typ || !seen && !known {
+			eventType = model.EventCreate
+		}
+
+		events = append(events, model.FileEvent{
+			Type:      eventType,
+			Path:      path,
+			Timestamp: now,
+		})
+	}
+
+	// 상위 디렉터리가 먼저 만들어지도록 경로 순으로 내보냄
+	byPath := func(a, b model.FileEvent) int {
+		return strings.Compare(a.Path, b.Path)
+	}
+	slices.SortFunc(removes, byPath)
+	slices.SortFunc(events, byPath)
+
+	return append(removes, events...)
+}
@@ -0,0 +1,128 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"synco/internal/ignore"
+	"synco/internal/index"
+	"synco/internal/model"
+	"testing"
+	"time"
+)
+
+func TestPollerReportsChangesAgainstIndex(t *testing.T) {
+	initDB(t)
+
+	root := t.TempDir()
+	for _, name := range []string{"removed.txt", "changed.txt", "same.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ix := index.New(1, root)
+	for _, name := range []string{"removed.txt", "changed.txt", "same.txt"} {
+		recordFile(t, ix, filepath.Join(root, name))
+	}
+
+	// 데몬이 멈춰 있던 동안의 변경
+	if err := os.Remove(filepath.Join(root, "removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "changed.txt"), []byte("changed content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "created.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPoller(root, time.Hour, 100, model.SymlinkSkip, ix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Stop)
+
+	got := make(map[string]model.EventType)
+	for _, event := range collect(p.Events(), 300*time.Millisecond) {
+		got[filepath.Base(event.Path)] = event.Type
+	}
+
+	want := map[string]model.EventType{
+		"removed.txt": model.EventRemove,
+		"changed.txt": model.EventWrite,
+		"created.txt": model.EventCreate,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, eventType := range want {
+		if got[name] != eventType {
+			t.Errorf("%s: got %q, want %q", name, got[name], eventType)
+		}
+	}
+}
+
+func TestCompareDoesNotRepeatPendingChanges(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	modTime := time.Now()
+
+	states := map[string]model.FileState{
+		path: {Path: "a.txt", Size: 1, ModTime: modTime},
+	}
+	changed := map[string]entry{
+		path: {size: 2, modTime: modTime},
+	}
+
+	events := compare(root, nil, changed, states, nil)
+	if len(events) != 1 || events[0].Type != model.EventWrite {
+		t.Fatalf("first scan: got %+v, want one write", events)
+	}
+
+	// 동기화되기 전에 다시 훑어도 같은 변경을 다시 내보내지 않음
+	if events := compare(root, changed, changed, states, nil); len(events) != 0 {
+		t.Errorf("second scan: got %+v, want none", events)
+	}
+
+	// 기록과 같아지면 바뀐 것이 아님
+	synced := map[string]entry{
+		path: {size: 1, modTime: modTime},
+	}
+	if events := compare(root, nil, synced, states, nil); len(events) != 0 {
+		t.Errorf("synced file: got %+v, want none", events)
+	}
+}
+
+func TestScanSkipsIgnoredDirectories(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"node_modules/pkg/index.js", ".git/HEAD", "src/main.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := scan(root, model.SymlinkSkip, ignore.New(root, []string{"node_modules", ".git"}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path := range entries {
+		rel, _ := filepath.Rel(root, path)
+		top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if top == "node_modules" || top == ".git" {
+			t.Errorf("scanned ignored path %s", rel)
+		}
+	}
+
+	if _, ok := entries[filepath.Join(root, "src", "main.go")]; !ok {
+		t.Errorf("src/main.go was not scanned: %v", entries)
+	}
+}
@@ -0,0 +1,192 @@
+package local
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"synco/internal/index"
+	"synco/internal/model"
+	"synco/internal/syncer"
+	"synco/internal/util"
+	"time"
+)
+
+// Changes 데몬이 멈춰 있던 동안 root에서 생기거나 바뀌거나 지워진 파일을 ix의 기록과 비교해 이벤트로 만듦.
+// 기록이 하나도 없으면 비교할 기준이 없으므로 아무것도 만들지 않음
+func Changes(root string, symlinks model.SymlinkPolicy, ix *index.Index) ([]model.FileEvent, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid src path: %w", err)
+	}
+
+	states, err := ix.States(absRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file index: %w", err)
+	}
+
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	return diff(absRoot, absRoot, symlinks, states)
+}
+
+// Rescan 이벤트를 놓친 dir 아래를 다시 훑어 ix의 기록과 다른 항목을 이벤트로 만듦.
+// ix가 없으면 지워진 파일은 찾지 못하고, 있는 파일을 모두 새로 만든 것으로 봄
+func Rescan(root, dir string, symlinks model.SymlinkPolicy, ix *index.Index) ([]model.FileEvent, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid src path: %w", err)
+	}
+
+	// dir째 지워졌으면 남아 있는 상위 디렉터리에서 지워진 것을 찾음
+	for len(dir) > len(absRoot) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	states, err := ix.States(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file index: %w", err)
+	}
+
+	return diff(absRoot, dir, symlinks, states)
+}
+
+// diff dir 아래를 states와 비교. 비교한 기록은 states에서 지움
+func diff(root, dir string, symlinks model.SymlinkPolicy, states map[string]model.FileState) ([]model.FileEvent, error) {
+	now := time.Now()
+	var events []model.FileEvent
+
+	// 읽지 못한 디렉터리가 있으면 그 아래의 기록이 지워진 것으로 보이므로 비교를 멈춤
+	err := syncer.Walk(dir, symlinks, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// 다른 디렉터리는 안의 파일을 보내면서 만들어지므로 빈 디렉터리만 따로 만듦
+			if path != root && util.IsEmptyDir(path) {
+				events = append(events, model.FileEvent{
+					Type:      model.EventCreate,
+					Path:      path,
+					IsDir:     true,
+					Timestamp: now,
+				})
+			}
+			return nil
+		}
+
+		// 링크로 복사하는 링크는 가리키는 경로의 체크섬이 기록되어 있으므로 그것과 비교
+		if d.Type()&fs.ModeSymlink != 0 && symlinks == model.SymlinkCopyAsLink {
+			eventType, err := linkChange(path, states)
+			if err != nil || eventType == "" {
+				return err
+			}
+
+			events = append(events, model.FileEvent{
+				Type:      eventType,
+				Path:      path,
+				Timestamp: now,
+			})
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		state, known := states[path]
+		delete(states, path)
+
+		if !known {
+			events = append(events, model.FileEvent{
+				Type:      model.EventCreate,
+				Path:      path,
+				Timestamp: now,
+			})
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if state.Size != info.Size() || !state.ModTime.Equal(info.ModTime()) {
+			events = append(events, model.FileEvent{
+				Type:      model.EventWrite,
+				Path:      path,
+				Timestamp: now,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 남은 기록은 지워진 파일. 디렉터리째 지워졌으면 그 디렉터리를 한 번만 지움.
+	// 파일이 있던 자리에 디렉터리가 생겼을 수 있으므로 지우는 이벤트를 먼저 내보냄
+	var removes []model.FileEvent
+	removed := make(map[string]struct{})
+	for path := range states {
+		// 링크를 링크로 복사하지 않게 바뀌었으면 남아 있는 링크의 기록이 남으므로 지우지 않음
+		if util.IsSymlink(path) {
+			continue
+		}
+
+		top := removedRoot(root, path)
+		if _, ok := removed[top]; ok {
+			continue
+		}
+		removed[top] = struct{}{}
+
+		removes = append(removes, model.FileEvent{
+			Type:      model.EventRemove,
+			Path:      top,
+			IsDir:     top != path,
+			Timestamp: now,
+		})
+	}
+
+	return append(removes, events...), nil
+}
+
+// linkChange 기록에 없는 링크는 새로 만든 것으로, 가리키는 경로가 달라졌으면 바뀐 것으로 봄. 그대로이면 빈 값
+func linkChange(path string, states map[string]model.FileState) (model.EventType, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+
+	state, known := states[path]
+	delete(states, path)
+
+	switch {
+	case !known:
+		return model.EventCreate, nil
+	case state.Hash != hex.EncodeToString(util.LinkChecksum(target)):
+		return model.EventWrite, nil
+	}
+
+	return "", nil
+}
+
+// removedRoot 지워진 path의 상위 중 root 아래에서 가장 위에 있는 없는 디렉터리. 부모가 있으면 path 자신
+func removedRoot(root, path string) string {
+	top := path
+	for dir := filepath.Dir(path); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		top = dir
+	}
+
+	return top
+}
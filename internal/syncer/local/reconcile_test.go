@@ -0,0 +1,117 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"synco/internal/index"
+	"synco/internal/model"
+	"testing"
+)
+
+// syncedTree root에 파일과 링크를 만들고 한 번 동기화하여 기록을 남김
+func syncedTree(t *testing.T, symlinks model.SymlinkPolicy) (string, *index.Index) {
+	t.Helper()
+	initDB(t)
+
+	src, dst := t.TempDir(), t.TempDir()
+	for _, name := range []string{"changed.txt", "removed.txt", "same.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"retargeted": "same.txt", "gone": "same.txt", "kept": "same.txt"} {
+		if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	ix := index.New(1, src)
+	s, err := NewSyncer(src, dst, model.StrategyNewerWins, 2, symlinks, false, ix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FullSync(); err != nil {
+		t.Fatal(err)
+	}
+
+	return src, ix
+}
+
+func changesByName(t *testing.T, src string, symlinks model.SymlinkPolicy, ix *index.Index) map[string]model.EventType {
+	t.Helper()
+
+	events, err := Changes(src, symlinks, ix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]model.EventType)
+	for _, event := range events {
+		got[filepath.Base(event.Path)] = event.Type
+	}
+
+	return got
+}
+
+func TestChangesFindsFilesChangedWhileStopped(t *testing.T) {
+	src, ix := syncedTree(t, model.SymlinkSkip)
+
+	if err := os.WriteFile(filepath.Join(src, "changed.txt"), []byte("changed content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(src, "removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "created.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := changesByName(t, src, model.SymlinkSkip, ix)
+	want := map[string]model.EventType{
+		"changed.txt": model.EventWrite,
+		"removed.txt": model.EventRemove,
+		"created.txt": model.EventCreate,
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, eventType := range want {
+		if got[name] != eventType {
+			t.Errorf("%s: got %q, want %q", name, got[name], eventType)
+		}
+	}
+}
+
+func TestChangesFindsLinksChangedWhileStopped(t *testing.T) {
+	src, ix := syncedTree(t, model.SymlinkCopyAsLink)
+
+	if err := os.Remove(filepath.Join(src, "retargeted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("changed.txt", filepath.Join(src, "retargeted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(src, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("same.txt", filepath.Join(src, "added")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := changesByName(t, src, model.SymlinkCopyAsLink, ix)
+	want := map[string]model.EventType{
+		"retargeted": model.EventWrite,
+		"gone":       model.EventRemove,
+		"added":      model.EventCreate,
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, eventType := range want {
+		if got[name] != eventType {
+			t.Errorf("%s: got %q, want %q", name, got[name], eventType)
+		}
+	}
+}
@@ -1,34 +1,225 @@
 package local
 
 import (
+	"sync"
+	"sync/atomic"
+	"synco/internal/ignore"
+	"synco/internal/index"
+	"synco/internal/logger"
 	"synco/internal/model"
+	"time"
+
+	"go.uber.org/zap"
 )
 
+// 이벤트를 처음 놓친 뒤 다시 훑기까지 기다리는 시간. 몰려오던 이벤트가 잦아들 때까지 기다려 여러 번 훑지 않도록 함
+const rescanDelay = time.Second
+
 type Source struct {
-	w *Watcher
+	w       *Watcher
+	path    string
+	index   *index.Index
+	ignore  *ignore.Matcher
+	bufSize int
+	eventCh chan model.FileEvent
+	doneCh  chan struct{}
+	rescans atomic.Int64
+
+	// pollInterval 0이 아니면 실행 중에 감시 한도에 걸렸을 때 감시를 멈추고 이 간격의 polling으로 바꿈
+	pollInterval time.Duration
+	mu           sync.Mutex
+	poller       *Poller
+	stopped      bool
+	stopWatch    sync.Once
 }
 
-func NewSource(path string, bufSize int) (*Source, error) {
-	w, err := New(bufSize)
+// NewSource ix가 있으면 Start할 때 데몬이 멈춰 있던 동안의 변경을 감시 이벤트보다 먼저 내보냄.
+// ig는 감시 한도에 걸려 polling으로 바꿀 때 씀
+func NewSource(path string, bufSize int, symlinks model.SymlinkPolicy, ix *index.Index, ig *ignore.Matcher) (*Source, error) {
+	w, err := New(bufSize, symlinks)
 	if err != nil {
 		return nil, err
 	}
+	w.index = ix
 
+	// 한도에 걸려 실패하면 등록한 감시를 풀어야 다른 job이 쓸 수 있음
 	if err := w.Watch(path); err != nil {
+		_ = w.fw.Close()
 		return nil, err
 	}
 
-	return &Source{w: w}, nil
+	return &Source{
+		w:       w,
+		path:    path,
+		index:   ix,
+		ignore:  ig,
+		bufSize: bufSize,
+		eventCh: make(chan model.FileEvent, bufSize),
+		doneCh:  make(chan struct{}),
+	}, nil
 }
 
 func (s *Source) Events() <-chan model.FileEvent {
-	return s.w.Events()
+	return s.eventCh
 }
 
 func (s *Source) Start() error {
+	go s.run()
 	return nil
 }
 
 func (s *Source) Stop() {
-	s.w.Stop()
+	s.mu.Lock()
+	s.stopped = true
+	p := s.poller
+	s.mu.Unlock()
+
+	close(s.doneCh)
+	s.stopWatch.Do(s.w.Stop)
+	if p != nil {
+		p.Stop()
+	}
+}
+
+// run 감시는 NewSource에서 이미 시작했으므로 비교하는 동안의 변경은 감시 이벤트로 뒤이어 나감
+func (s *Source) run() {
+	defer close(s.eventCh)
+
+	changes, err := Changes(s.path, s.w.symlinks, s.index)
+	if err != nil {
+		logger.Log.Warn("failed to detect changes made while stopped",
+			zap.String("path", s.path),
+			zap.Error(err))
+	} else if len(changes) > 0 {
+		logger.Log.Info("changes made while stopped detected",
+			zap.String("path", s.path),
+			zap.Int("events", len(changes)))
+	}
+
+	for _, event := range changes {
+		if !s.send(event) {
+			return
+		}
+	}
+
+	events, dirtyCh := s.w.Events(), s.w.dirtyCh
+	var limitCh <-chan struct{}
+	if s.pollInterval > 0 {
+		limitCh = s.w.limitCh
+	}
+
+	var rescanCh <-chan time.Time
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if !s.send(event) {
+				return
+			}
+
+		case <-limitCh:
+			limitCh = nil
+			p, ok := s.switchToPoller()
+			if !ok {
+				continue
+			}
+
+			events, dirtyCh, rescanCh = p.Events(), nil, nil
+
+		case <-dirtyCh:
+			if rescanCh == nil {
+				rescanCh = time.After(rescanDelay)
+			}
+
+		case <-rescanCh:
+			rescanCh = nil
+			if !s.rescan() {
+				return
+			}
+
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+// switchToPoller 감시를 멈추고 디렉터리 전체를 polling으로 감시함. 처음 훑을 때 파일 기록과 비교하므로
+// 감시하지 못한 동안의 변경도 나감. 바꾸지 못했으면 감시를 유지하고 놓친 디렉터리를 다시 훑기만 함
+func (s *Source) switchToPoller() (*Poller, bool) {
+	p, err := NewPoller(s.path, s.pollInterval, s.bufSize, s.w.symlinks, s.index, s.ignore)
+	if err != nil {
+		logger.Log.Warn("failed to switch to polling after inotify limit",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return nil, false
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil, false
+	}
+	s.poller = p
+	s.mu.Unlock()
+
+	if err := p.Start(); err != nil {
+		logger.Log.Warn("failed to switch to polling after inotify limit",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return nil, false
+	}
+
+	logger.Log.Warn("inotify limit reached while watching, polling for changes",
+		zap.String("path", s.path))
+
+	s.stopWatch.Do(s.w.Stop)
+	return p, true
+}
+
+// rescan 감시가 이벤트를 놓친 디렉터리를 다시 훑어 놓친 변경을 내보냄
+func (s *Source) rescan() bool {
+	for _, dir := range s.w.takeDirty() {
+		events, err := Rescan(s.path, dir, s.w.symlinks, s.index)
+		if err != nil {
+			logger.Log.Warn("failed to rescan after lost events",
+				zap.String("dir", dir),
+				zap.Error(err))
+			continue
+		}
+
+		s.rescans.Add(1)
+		logger.Log.Info("rescanned after lost events",
+			zap.String("dir", dir),
+			zap.Int("events", len(events)))
+
+		for _, event := range events {
+			if !s.send(event) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Lost 감시가 놓친 이벤트 수
+func (s *Source) Lost() int64 {
+	return s.w.Lost()
+}
+
+// Rescans 놓친 이벤트 때문에 디렉터리를 다시 훑은 횟수
+func (s *Source) Rescans() int64 {
+	return s.rescans.Load()
+}
+
+func (s *Source) send(event model.FileEvent) bool {
+	select {
+	case s.eventCh <- event:
+		return true
+	case <-s.doneCh:
+		return false
+	}
 }
@@ -0,0 +1,97 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"synco/internal/index"
+	"synco/internal/model"
+	"testing"
+	"time"
+)
+
+func TestSourceRescansAfterLostEvents(t *testing.T) {
+	initDB(t)
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gone := filepath.Join(dir, "gone.txt")
+	if err := os.WriteFile(gone, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := index.New(1, root)
+	recordFile(t, ix, gone)
+
+	s, err := NewSource(root, 2, model.SymlinkSkip, ix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	// 이벤트를 받지 않는 동안 채널이 넘치도록 함
+	const files = 50
+	for i := range files {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprint(i)), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	var created []string
+	var removed bool
+	for _, event := range collect(s.Events(), rescanDelay+time.Second) {
+		switch {
+		case event.Type == model.EventRemove && event.Path == gone:
+			removed = true
+		case event.Type != model.EventRemove && !event.IsDir:
+			created = append(created, event.Path)
+		}
+	}
+
+	if s.Lost() == 0 || s.Rescans() == 0 {
+		t.Fatalf("lost=%d rescans=%d, want the channel to overflow and a rescan", s.Lost(), s.Rescans())
+	}
+	for i := range files {
+		if path := filepath.Join(dir, fmt.Sprint(i)); !slices.Contains(created, path) {
+			t.Errorf("%s was not reported after the rescan", path)
+		}
+	}
+	if !removed {
+		t.Errorf("removal of %s was not reported after the rescan", gone)
+	}
+}
+
+func TestTakeDirtySkipsNestedDirs(t *testing.T) {
+	w := &Watcher{dirty: make(map[string]struct{}), dirtyCh: make(chan struct{}, 1)}
+	root := t.TempDir()
+
+	for _, dir := range []string{
+		filepath.Join(root, "a", "b"),
+		filepath.Join(root, "a"),
+		filepath.Join(root, "a", "b", "c"),
+		filepath.Join(root, "ab"),
+	} {
+		w.markDirty(dir)
+	}
+
+	got := w.takeDirty()
+	slices.Sort(got)
+	if want := []string{filepath.Join(root, "a"), filepath.Join(root, "ab")}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := w.takeDirty(); len(got) != 0 {
+		t.Errorf("dirty dirs were taken twice: %v", got)
+	}
+}
@@ -1,10 +1,14 @@
 package local
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"synco/internal/ignore"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
 	"synco/internal/syncer"
@@ -18,9 +22,16 @@ type Syncer struct {
 	src      string
 	dst      string
 	resolver *conflict.Resolver
+	workers  int
+	symlinks model.SymlinkPolicy
+	owner    bool
+	index    *index.Index
+	ignore   *ignore.Matcher
 }
 
-func NewSyncer(src, dst string, strategy model.ConflictStrategy) (*Syncer, error) {
+// NewSyncer workers는 Run에서 동시에 처리하는 이벤트 수. owner이면 소유자와 user 확장 속성도 복사.
+// ix가 있으면 복사한 파일을 기록하고, 전체 동기화에서 그 뒤로 바뀌지 않은 파일은 건너뜀. ig가 무시하는 경로는 전체 동기화와 디렉터리 복사에서 뺌
+func NewSyncer(src, dst string, strategy model.ConflictStrategy, workers int, symlinks model.SymlinkPolicy, owner bool, ix *index.Index, ig *ignore.Matcher) (*Syncer, error) {
 	absSrc, err := filepath.Abs(src)
 	if err != nil {
 		return nil, fmt.Errorf("invalid src path: %w", err)
@@ -38,17 +49,22 @@ func NewSyncer(src, dst string, strategy model.ConflictStrategy) (*Syncer, error
 		src:      absSrc,
 		dst:      absDst,
 		resolver: conflict.NewResolver(strategy),
+		workers:  workers,
+		symlinks: symlinks,
+		owner:    owner,
+		index:    ix,
+		ignore:   ig,
 	}, nil
 }
 
 func (s *Syncer) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
-	return syncer.RunLoop(inCh, s.handle)
+	return syncer.RunLoop(inCh, s.workers, s.handle)
 }
 
 func (s *Syncer) FullSync() ([]model.SyncResult, error) {
-	var results []model.SyncResult
+	var events []model.FileEvent
 
-	err := filepath.WalkDir(s.src, func(path string, d os.DirEntry, err error) error {
+	err := syncer.Walk(s.src, s.symlinks, s.ignore.WalkFunc(func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -59,16 +75,21 @@ func (s *Syncer) FullSync() ([]model.SyncResult, error) {
 			return os.MkdirAll(dstPath, 0755)
 		}
 
-		event := model.FileEvent{
+		if s.synced(path, dstPath, d) {
+			return nil
+		}
+
+		events = append(events, model.FileEvent{
 			Type: model.EventWrite,
 			Path: path,
-		}
-		result := s.handle(event)
-		results = append(results, result)
+		})
 		return nil
-	})
+	}))
+	if err != nil {
+		return nil, err
+	}
 
-	return results, err
+	return syncer.RunAll(events, s.workers, s.handle), nil
 }
 
 func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
@@ -81,6 +102,16 @@ func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
 
 	switch event.Type {
 	case model.EventCreate, model.EventWrite:
+		if event.IsDir {
+			result.Err = os.MkdirAll(dstPath, 0755)
+			break
+		}
+
+		if s.symlinks == model.SymlinkCopyAsLink && util.IsSymlink(event.Path) {
+			result.Err = s.copyLink(event.Path, dstPath)
+			break
+		}
+
 		conflictInfo, err := s.resolver.DetectConflict(event.Path, dstPath)
 		if err != nil {
 			result.Err = err
@@ -103,12 +134,18 @@ func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
 		result.Err = s.copyFile(event.Path, dstPath)
 
 	case model.EventRemove:
-		result.Err = util.RemoveIfExists(dstPath)
+		if event.IsDir {
+			result.Err = util.RemoveAllIfExists(dstPath)
+		} else {
+			result.Err = util.RemoveIfExists(dstPath)
+		}
+
+		if result.Err == nil {
+			s.index.Forget(event.Path)
+		}
 
 	case model.EventRename:
-		// Rename의 경우 이전 경로 삭제 + 새 경로 복사로 처리
-		// fsnotify는 rename 시에 이전 경로만 알려주므로 해당 경로는 삭제만 수행함
-		result.Err = util.RemoveIfExists(dstPath)
+		result.Err = s.move(event.OldPath, event.Path, dstPath)
 	}
 
 	if result.Err != nil {
@@ -126,6 +163,78 @@ func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
 	return result
 }
 
+// move 대상에서도 이전 경로를 옮기고, 대상에 이전 경로가 없으면 새 경로의 내용을 복사.
+// 대상의 이전 파일이 옮겨온 파일과 크기나 수정 시각이 다르면 다른 파일이므로 옮기지 않고 복사한 뒤 지움
+func (s *Syncer) move(oldPath, newPath, dstPath string) error {
+	oldDst := s.toDst(oldPath)
+	if !sameFile(oldDst, newPath) {
+		if err := s.copyTree(newPath, dstPath); err != nil {
+			return err
+		}
+
+		if _, err := os.Lstat(oldPath); os.IsNotExist(err) {
+			if err := util.RemoveIfExists(oldDst); err != nil {
+				return err
+			}
+		}
+
+		s.index.Forget(oldPath)
+		return nil
+	}
+
+	moved, err := util.MoveIfExists(oldDst, dstPath)
+	if err != nil {
+		return err
+	}
+
+	if moved {
+		s.index.Move(oldPath, newPath)
+		return nil
+	}
+
+	if err := s.copyTree(newPath, dstPath); err != nil {
+		return err
+	}
+
+	s.index.Forget(oldPath)
+	return nil
+}
+
+// sameFile 둘 다 일반 파일이면 복사할 때 맞춘 크기와 수정 시각으로 같은 파일인지 확인. 디렉터리나 링크, 없는 경로는 true
+func sameFile(dst, src string) bool {
+	dstInfo, err := os.Lstat(dst)
+	if err != nil || !dstInfo.Mode().IsRegular() {
+		return true
+	}
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil || !srcInfo.Mode().IsRegular() {
+		return true
+	}
+
+	return dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime())
+}
+
+// copyTree 디렉터리이면 빈 디렉터리를 포함해 그 아래를 모두 복사
+func (s *Syncer) copyTree(src, dst string) error {
+	return syncer.Walk(src, s.symlinks, s.ignore.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, strings.TrimPrefix(path, src))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if d.Type()&os.ModeSymlink != 0 {
+			return s.copyLink(path, target)
+		}
+
+		return s.copyFile(path, target)
+	}))
+}
+
 func (s *Syncer) copyFile(src, dst string) error {
 	f, err := os.Open(src)
 	if err != nil {
@@ -136,7 +245,66 @@ func (s *Syncer) copyFile(src, dst string) error {
 		_ = f.Close()
 	}(f)
 
-	return util.AtomicWrite(dst, f)
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat src: %w", err)
+	}
+
+	meta, err := util.StatMeta(src, s.owner)
+	if err != nil {
+		return fmt.Errorf("failed to stat src: %w", err)
+	}
+
+	h := sha256.New()
+	if err := util.AtomicWrite(dst, io.TeeReader(f, h), meta); err != nil {
+		return err
+	}
+
+	s.index.Record(src, info, h.Sum(nil), "", "")
+	return nil
+}
+
+// synced 마지막으로 복사한 뒤 src가 바뀌지 않았고 dst도 그대로 남아 있으면 true
+func (s *Syncer) synced(src, dst string, d os.DirEntry) bool {
+	if !d.Type().IsRegular() {
+		return false
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+
+	state, ok := s.index.Unchanged(src, info)
+	if !ok {
+		return false
+	}
+
+	dstInfo, err := os.Lstat(dst)
+	return err == nil && dstInfo.Mode().IsRegular() && dstInfo.Size() == state.Size
+}
+
+// copyLink 링크가 가리키는 경로를 바꾸지 않고 그대로 만듦. 상대 경로 링크는 대상에서도 대상 안을 가리킴.
+// 데몬이 멈춰 있던 동안 바뀐 링크를 찾을 수 있도록 가리키는 경로의 체크섬을 기록
+func (s *Syncer) copyLink(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat link: %w", err)
+	}
+
+	target, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("failed to read link: %w", err)
+	}
+
+	if current, err := os.Readlink(dst); err != nil || current != target {
+		if err := util.WriteSymlink(dst, target); err != nil {
+			return err
+		}
+	}
+
+	s.index.Record(src, info, util.LinkChecksum(target), "", "")
+	return nil
 }
 
 func (s *Syncer) toDst(srcPath string) string {
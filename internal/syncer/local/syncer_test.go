@@ -0,0 +1,77 @@
+package local
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"synco/internal/model"
+	"testing"
+)
+
+func TestFullSyncSymlinkPolicies(t *testing.T) {
+	initDB(t)
+
+	tests := []struct {
+		policy model.SymlinkPolicy
+		want   []string
+	}{
+		{model.SymlinkSkip, []string{"d", "d/f.txt"}},
+		{model.SymlinkCopyAsLink, []string{"broken -> missing", "d", "d/f.txt", "d/loop -> ..", "dirlink -> d", "rel -> d/f.txt"}},
+		{model.SymlinkFollow, []string{"d", "d/f.txt", "dirlink", "dirlink/f.txt", "rel"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			if err := os.Mkdir(filepath.Join(src, "d"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(src, "d", "f.txt"), []byte("hello"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for link, target := range map[string]string{"rel": "d/f.txt", "dirlink": "d", "broken": "missing", "d/loop": ".."} {
+				if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(link))); err != nil {
+					t.Skip("symlinks not supported:", err)
+				}
+			}
+
+			s, err := NewSyncer(src, dst, model.StrategyNewerWins, 4, tt.policy, false, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := s.FullSync()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, result := range results {
+				if result.Err != nil {
+					t.Errorf("%s: %v", result.Event.Path, result.Err)
+				}
+			}
+
+			var got []string
+			err = filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || path == dst {
+					return err
+				}
+
+				rel, _ := filepath.Rel(dst, path)
+				rel = filepath.ToSlash(rel)
+				if target, err := os.Readlink(path); err == nil {
+					rel += " -> " + target
+				}
+				got = append(got, rel)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("dst has %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
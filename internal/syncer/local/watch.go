@@ -0,0 +1,52 @@
+package local
+
+import (
+	"errors"
+	"synco/internal/ignore"
+	"synco/internal/index"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"synco/internal/syncer"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// NewWatchSource mode에 따라 감시나 polling으로 path의 변경을 알아냄. WatchAuto이면 감시를 쓰되,
+// 다른 기기에서 바꾼 내용의 이벤트가 오지 않는 네트워크 파일 시스템이거나 inotify 한도에 걸리면 polling으로 바꿈.
+// polling은 ig가 무시하는 디렉터리를 훑지 않음
+func NewWatchSource(path string, mode model.WatchMode, bufSize int, interval time.Duration, symlinks model.SymlinkPolicy, ix *index.Index, ig *ignore.Matcher) (syncer.EventSource, error) {
+	switch mode {
+	case model.WatchPoll:
+		return NewPoller(path, interval, bufSize, symlinks, ix, ig)
+	case model.WatchFsnotify:
+		return NewSource(path, bufSize, symlinks, ix, ig)
+	}
+
+	if isNetworkFS(path) {
+		logger.Log.Info("network filesystem detected, polling for changes",
+			zap.String("path", path))
+		return NewPoller(path, interval, bufSize, symlinks, ix, ig)
+	}
+
+	src, err := NewSource(path, bufSize, symlinks, ix, ig)
+	if isWatchLimit(err) {
+		logger.Log.Warn("inotify limit reached, polling for changes",
+			zap.String("path", path),
+			zap.Error(err))
+		return NewPoller(path, interval, bufSize, symlinks, ix, ig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 시작한 뒤에 새 디렉터리를 감시하다 한도에 걸려도 polling으로 바꿈
+	src.pollInterval = interval
+	return src, nil
+}
+
+// isWatchLimit 감시 수(max_user_watches)나 인스턴스 수(max_user_instances) 한도에 걸린 에러
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
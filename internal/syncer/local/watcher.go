@@ -1,11 +1,17 @@
 package local
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/syncer"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -16,18 +22,38 @@ type Watcher struct {
 	fw      *fsnotify.Watcher
 	eventCh chan model.FileEvent
 	doneCh  chan struct{}
+	// 감시 중인 디렉터리와 등록할 때의 정보. 삭제된 경로는 stat할 수 없으므로 디렉터리였는지,
+	// 옮겨온 디렉터리가 같은 디렉터리인지 여기서 확인
+	dirs     map[string]os.FileInfo
+	symlinks model.SymlinkPolicy
+	root     string
+	// index 옮겨온 파일이 Rename으로 사라진 파일과 같은지 마지막으로 동기화한 크기와 수정 시각으로 확인
+	index *index.Index
+
+	// 이벤트를 놓친 디렉터리. Source가 그 아래를 다시 훑어 놓친 변경을 찾음
+	dirtyMu sync.Mutex
+	dirty   map[string]struct{}
+	dirtyCh chan struct{}
+	lost    atomic.Int64
+	// limitCh 실행 중에 감시 한도에 걸려 새 디렉터리를 감시하지 못하면 알림
+	limitCh chan struct{}
 }
 
-func New(bufferSize int) (*Watcher, error) {
+func New(bufferSize int, symlinks model.SymlinkPolicy) (*Watcher, error) {
 	fw, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
 	return &Watcher{
-		fw:      fw,
-		eventCh: make(chan model.FileEvent, bufferSize),
-		doneCh:  make(chan struct{}),
+		fw:       fw,
+		eventCh:  make(chan model.FileEvent, bufferSize),
+		doneCh:   make(chan struct{}),
+		dirs:     make(map[string]os.FileInfo),
+		symlinks: symlinks,
+		dirty:    make(map[string]struct{}),
+		dirtyCh:  make(chan struct{}, 1),
+		limitCh:  make(chan struct{}, 1),
 	}, nil
 }
 
@@ -41,10 +67,11 @@ func (w *Watcher) Watch(dir string) error {
 		return fmt.Errorf("source directory not found: %w", err)
 	}
 
-	if err := w.addRecursive(absDir); err != nil {
+	if err := w.addRecursive(absDir, false); err != nil {
 		return err
 	}
 
+	w.root = absDir
 	go w.run()
 
 	logger.Log.Info("watcher started",
@@ -52,35 +79,128 @@ func (w *Watcher) Watch(dir string) error {
 	return nil
 }
 
-func (w *Watcher) addRecursive(dir string) error {
-	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+// addRecursive emit이면 dir 아래에 이미 있는 파일과 디렉터리를 새로 만든 것으로 내보냄.
+// 감시를 등록하기 전에 만들어졌거나 다른 곳에서 함께 옮겨온 항목은 이벤트가 오지 않음
+func (w *Watcher) addRecursive(dir string, emit bool) error {
+	return syncer.Walk(dir, w.symlinks, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if d.IsDir() {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
 			if err := w.fw.Add(path); err != nil {
 				return fmt.Errorf("failed to watch %s: %w", path, err)
 			}
+			w.dirs[path] = info
+
 			logger.Log.Debug("watching directory",
 				zap.String("path", path))
 		}
 
+		if emit && path != dir {
+			w.emit(model.FileEvent{
+				Type:      model.EventCreate,
+				Path:      path,
+				IsDir:     d.IsDir(),
+				Timestamp: time.Now(),
+			})
+		}
+
 		return nil
 	})
 }
 
+// forgetDir path가 감시 중인 디렉터리였으면 그 아래의 기록과 함께 지우고 true
+func (w *Watcher) forgetDir(path string) bool {
+	if _, ok := w.dirs[path]; !ok {
+		return false
+	}
+
+	for dir := range w.dirs {
+		if dir == path || strings.HasPrefix(dir, path+string(filepath.Separator)) {
+			delete(w.dirs, dir)
+		}
+	}
+
+	return true
+}
+
+// 같은 감시 범위 안에서 이동하면 이전 경로의 Rename 바로 뒤에 새 경로의 Create가 옴.
+// 이 시간 안에 Create가 오지 않으면 범위 밖으로 나간 것으로 보고 삭제로 처리
+const renamePairWindow = 50 * time.Millisecond
+
+// sameEntry 새 경로의 info가 Rename으로 사라진 oldPath와 같은 항목이면 true.
+// 범위 밖으로 옮긴 직후 다른 파일을 만든 것을 이동으로 보면 대상에서 엉뚱한 내용을 새 이름으로 옮기게 됨.
+// 디렉터리는 감시를 등록할 때의 정보로, 파일은 index에 기록된 크기와 수정 시각으로 비교하고, 기록이 없으면 다른 항목으로 봄
+func (w *Watcher) sameEntry(oldPath string, info os.FileInfo) bool {
+	if info == nil {
+		return false
+	}
+
+	if old, ok := w.dirs[oldPath]; ok {
+		return info.IsDir() && os.SameFile(old, info)
+	}
+
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	_, ok := w.index.Unchanged(oldPath, info)
+	return ok
+}
+
 func (w *Watcher) run() {
 	defer close(w.eventCh)
 
+	var (
+		// 짝이 되는 Create를 기다리는 Rename
+		renamed *model.FileEvent
+		pairCh  <-chan time.Time
+		// 옮긴 디렉터리. 자신의 감시에서 오는 Rename을 기다렸다가 새 경로로 다시 감시함
+		movedDir *model.FileEvent
+		selfCh   <-chan time.Time
+	)
+
+	flushRenamed := func() {
+		if renamed != nil {
+			w.emit(model.FileEvent{
+				Type:      model.EventRemove,
+				Path:      renamed.Path,
+				IsDir:     w.forgetDir(renamed.Path),
+				Timestamp: renamed.Timestamp,
+			})
+		}
+
+		renamed, pairCh = nil, nil
+	}
+
+	flushMovedDir := func() {
+		if movedDir != nil {
+			w.rewatch(movedDir.OldPath, movedDir.Path)
+		}
+
+		movedDir, selfCh = nil, nil
+	}
+
 	for {
 		select {
 		case <-w.doneCh:
 			logger.Log.Info("watcher stopping")
 			return
 
+		case <-pairCh:
+			flushRenamed()
+
+		case <-selfCh:
+			flushMovedDir()
+
 		case fsEvent, ok := <-w.fw.Events:
 			if !ok {
+				flushRenamed()
 				return
 			}
 
@@ -89,30 +209,71 @@ func (w *Watcher) run() {
 				continue
 			}
 
-			if fsEvent.Op.Has(fsnotify.Create) {
-				if info, err := os.Stat(fsEvent.Name); err == nil && info.IsDir() {
-					if err := w.fw.Add(fsEvent.Name); err != nil {
-						logger.Log.Warn("failed to watch new directory",
-							zap.String("path", fsEvent.Name),
-							zap.Error(err))
-					} else {
-						logger.Log.Debug("added new directory to watch",
-							zap.String("path", fsEvent.Name))
-					}
-				}
-			}
-
 			event := model.FileEvent{
 				Type:      eventType,
 				Path:      fsEvent.Name,
 				Timestamp: time.Now(),
 			}
 
-			select {
-			case w.eventCh <- event:
-			default:
-				logger.Log.Warn("event channel is full, dropping event",
-					zap.String("path", fsEvent.Name))
+			if eventType == model.EventRename {
+				// 감시 중인 디렉터리를 옮기면 부모의 감시에 이어 자신의 감시에서도 Rename이 옴.
+				// fsnotify는 이때 감시를 지우므로, 그 뒤에 새 경로로 다시 등록해야 함
+				if movedDir != nil && movedDir.OldPath == event.Path {
+					flushMovedDir()
+					continue
+				}
+				if renamed != nil && renamed.Path == event.Path {
+					continue
+				}
+
+				flushRenamed()
+				renamed, pairCh = &event, time.After(renamePairWindow)
+				continue
+			}
+
+			var info os.FileInfo
+			switch eventType {
+			case model.EventCreate:
+				var err error
+				info, err = os.Lstat(event.Path)
+				if err == nil && info.Mode()&os.ModeSymlink != 0 {
+					if w.symlinks == model.SymlinkSkip {
+						flushRenamed()
+						continue
+					}
+					// 링크를 따라가면 가리키는 디렉터리로 보고 그 아래까지 감시
+					if w.symlinks == model.SymlinkFollow {
+						info, err = os.Stat(event.Path)
+					}
+				}
+				if err != nil {
+					info = nil
+				}
+				event.IsDir = info != nil && info.IsDir()
+			case model.EventRemove:
+				event.IsDir = w.forgetDir(event.Path)
+			}
+
+			if renamed != nil && eventType == model.EventCreate && w.sameEntry(renamed.Path, info) {
+				event.Type = model.EventRename
+				event.OldPath = renamed.Path
+				renamed, pairCh = nil, nil
+
+				if event.IsDir {
+					flushMovedDir()
+					movedDir, selfCh = &event, time.After(renamePairWindow)
+				}
+
+				w.emit(event)
+				continue
+			}
+
+			flushRenamed()
+			w.emit(event)
+
+			// 새로 만들었거나 다른 곳에서 옮겨온 디렉터리는 안의 항목까지 감시하고 내보냄
+			if event.IsDir && eventType == model.EventCreate {
+				w.watchNew(event.Path)
 			}
 
 		case err, ok := <-w.fw.Errors:
@@ -120,12 +281,135 @@ func (w *Watcher) run() {
 				return
 			}
 
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.overflow()
+				continue
+			}
+
 			logger.Log.Error("watcher error",
 				zap.Error(err))
 		}
 	}
 }
 
+func (w *Watcher) watchNew(dir string) {
+	if err := w.addRecursive(dir, true); err != nil {
+		logger.Log.Warn("failed to watch new directory",
+			zap.String("path", dir),
+			zap.Error(err))
+		w.watchFailed(dir, err)
+		return
+	}
+
+	logger.Log.Debug("added new directory to watch",
+		zap.String("path", dir))
+}
+
+// rewatch 옮긴 디렉터리 아래의 감시는 이전 경로로 남아 있으므로 지우고 새 경로로 다시 등록
+func (w *Watcher) rewatch(oldDir, newDir string) {
+	for _, path := range w.fw.WatchList() {
+		if path == oldDir || strings.HasPrefix(path, oldDir+string(filepath.Separator)) {
+			_ = w.fw.Remove(path)
+		}
+	}
+	w.forgetDir(oldDir)
+
+	if err := w.addRecursive(newDir, false); err != nil {
+		logger.Log.Warn("failed to watch moved directory",
+			zap.String("path", newDir),
+			zap.Error(err))
+		w.watchFailed(newDir, err)
+	}
+}
+
+func (w *Watcher) emit(event model.FileEvent) {
+	select {
+	case w.eventCh <- event:
+	default:
+		logger.Log.Warn("event channel is full, dropping event",
+			zap.String("path", event.Path))
+
+		w.lost.Add(1)
+		w.markDirty(filepath.Dir(event.Path))
+		if event.Type == model.EventRename {
+			w.markDirty(filepath.Dir(event.OldPath))
+		}
+	}
+}
+
+// overflow 커널의 이벤트 큐가 넘치면 어느 경로의 이벤트를 놓쳤는지 알 수 없으므로 전체를 다시 훑음.
+// 놓친 이벤트 중에 새 디렉터리가 있었을 수 있으므로 감시도 다시 등록
+func (w *Watcher) overflow() {
+	logger.Log.Warn("watcher queue overflowed, rescanning",
+		zap.String("dir", w.root))
+
+	if err := w.addRecursive(w.root, false); err != nil {
+		logger.Log.Warn("failed to rewatch after overflow",
+			zap.String("dir", w.root),
+			zap.Error(err))
+		w.watchFailed(w.root, err)
+	}
+
+	w.lost.Add(1)
+	w.markDirty(w.root)
+}
+
+// watchFailed 감시를 등록하지 못한 디렉터리에서는 이벤트가 오지 않으므로 다시 훑음.
+// 감시 한도에 걸렸으면 Source가 polling으로 바꿀 수 있도록 알림
+func (w *Watcher) watchFailed(dir string, err error) {
+	w.markDirty(dir)
+
+	if isWatchLimit(err) {
+		select {
+		case w.limitCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *Watcher) markDirty(dir string) {
+	w.dirtyMu.Lock()
+	w.dirty[dir] = struct{}{}
+	w.dirtyMu.Unlock()
+
+	select {
+	case w.dirtyCh <- struct{}{}:
+	default:
+	}
+}
+
+// takeDirty 이벤트를 놓친 디렉터리를 꺼냄. 다른 디렉터리 아래에 있는 디렉터리는 함께 훑으므로 뺌
+func (w *Watcher) takeDirty() []string {
+	w.dirtyMu.Lock()
+	dirty := w.dirty
+	w.dirty = make(map[string]struct{})
+	w.dirtyMu.Unlock()
+
+	var dirs []string
+	for dir := range dirty {
+		if !hasDirtyParent(dirty, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+func hasDirtyParent(dirty map[string]struct{}, dir string) bool {
+	for parent := filepath.Dir(dir); parent != dir; dir, parent = parent, filepath.Dir(parent) {
+		if _, ok := dirty[parent]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lost 채널이 가득 차 버렸거나 커널 큐가 넘쳐 놓친 이벤트 수
+func (w *Watcher) Lost() int64 {
+	return w.lost.Load()
+}
+
 func (w *Watcher) Events() <-chan model.FileEvent {
 	return w.eventCh
 }
@@ -0,0 +1,185 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"synco/internal/db"
+	"synco/internal/index"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func initDB(t *testing.T) {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	if err := db.Init(filepath.Join(t.TempDir(), "synco.db")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// collect 이벤트가 quiet 동안 더 오지 않을 때까지 모음
+func collect(ch <-chan model.FileEvent, quiet time.Duration) []model.FileEvent {
+	var events []model.FileEvent
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-time.After(quiet):
+			return events
+		}
+	}
+}
+
+func startWatcher(t *testing.T, root string, ix *index.Index) *Watcher {
+	t.Helper()
+
+	w, err := New(100, model.SymlinkSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.index = ix
+
+	if err := w.Watch(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.Stop)
+
+	return w
+}
+
+func recordFile(t *testing.T, ix *index.Index, path string) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.Record(path, info, nil, "", "")
+}
+
+func TestWatcherPairsRenameOfSameFile(t *testing.T) {
+	initDB(t)
+
+	root := t.TempDir()
+	oldPath, newPath := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+	if err := os.WriteFile(oldPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := index.New(1, root)
+	recordFile(t, ix, oldPath)
+
+	w := startWatcher(t, root, ix)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	events := collect(w.Events(), 300*time.Millisecond)
+	if len(events) != 1 || events[0].Type != model.EventRename || events[0].OldPath != oldPath || events[0].Path != newPath {
+		t.Fatalf("got %+v, want one rename %s -> %s", events, oldPath, newPath)
+	}
+}
+
+func TestWatcherDoesNotPairUnrelatedCreate(t *testing.T) {
+	initDB(t)
+
+	root, outside := t.TempDir(), t.TempDir()
+	oldPath, newPath := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+	if err := os.WriteFile(oldPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := index.New(1, root)
+	recordFile(t, ix, oldPath)
+
+	w := startWatcher(t, root, ix)
+	// 범위 밖으로 옮긴 직후 다른 파일을 만듦
+	if err := os.Rename(oldPath, filepath.Join(outside, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var removed, created bool
+	for _, event := range collect(w.Events(), 300*time.Millisecond) {
+		switch {
+		case event.Type == model.EventRename:
+			t.Fatalf("unrelated create was paired as rename: %+v", event)
+		case event.Type == model.EventRemove && event.Path == oldPath:
+			removed = true
+		case event.Type == model.EventCreate && event.Path == newPath:
+			created = true
+		}
+	}
+
+	if !removed || !created {
+		t.Errorf("removed=%v created=%v, want both", removed, created)
+	}
+}
+
+func TestWatcherPairsRenameOfSameDir(t *testing.T) {
+	initDB(t)
+
+	root := t.TempDir()
+	oldDir, newDir := filepath.Join(root, "a"), filepath.Join(root, "b")
+	if err := os.Mkdir(oldDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := startWatcher(t, root, nil)
+	if err := os.Rename(oldDir, newDir); err != nil {
+		t.Fatal(err)
+	}
+
+	events := collect(w.Events(), 300*time.Millisecond)
+	if len(events) != 1 || events[0].Type != model.EventRename || !events[0].IsDir || events[0].OldPath != oldDir {
+		t.Fatalf("got %+v, want one directory rename %s -> %s", events, oldDir, newDir)
+	}
+}
+
+func TestMoveCopiesWhenDestinationIsDifferentFile(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	src, dst := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(dst, "a.txt"), []byte("content of a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "b.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSyncer(src, dst, model.StrategyNewerWins, 1, model.SymlinkSkip, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := s.handle(model.FileEvent{
+		Type:    model.EventRename,
+		OldPath: filepath.Join(src, "a.txt"),
+		Path:    filepath.Join(src, "b.txt"),
+	})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("dst b.txt = %q, want the empty source file", data)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("dst a.txt still exists: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package syncer
 
 import (
+	"path/filepath"
+	"strings"
 	"synco/internal/model"
 )
 
@@ -15,15 +17,130 @@ type Syncer interface {
 	FullSync() ([]model.SyncResult, error)
 }
 
-func RunLoop(inCh <-chan model.FileEvent, handle func(model.FileEvent) model.SyncResult) <-chan model.SyncResult {
+// waitingPerWorker RunLoop가 시작하지 못한 이벤트를 worker 하나당 이만큼까지 꺼내 둠
+const waitingPerWorker = 4
+
+// RunLoop 최대 workers개의 이벤트를 동시에 처리. 경로가 겹치는 이벤트는 받은 순서대로 하나씩 처리하여
+// 쓰기 뒤의 삭제가 앞서지 않도록 함. 이동은 이전 경로와 새 경로 모두, 디렉터리는 그 아래 경로와 겹치는 것으로 봄.
+// 결과는 처리가 끝난 순서로 나옴
+func RunLoop(inCh <-chan model.FileEvent, workers int, handle func(model.FileEvent) model.SyncResult) <-chan model.SyncResult {
 	outCh := make(chan model.SyncResult, cap(inCh))
+	workers = max(workers, 1)
 
 	go func() {
 		defer close(outCh)
-		for event := range inCh {
-			outCh <- handle(event)
+
+		var (
+			// 아직 시작하지 못한 이벤트. 앞의 이벤트와 경로가 겹치면 그 뒤에서 기다림
+			waiting []model.FileEvent
+			// 처리 중인 이벤트의 경로
+			busy    [][]string
+			running int
+			doneCh  = make(chan []string)
+		)
+
+		dispatch := func() {
+			var blocked [][]string
+			rest := waiting[:0]
+
+			for _, event := range waiting {
+				paths := eventPaths(event)
+				if running < workers && !overlapsAny(paths, busy) && !overlapsAny(paths, blocked) {
+					busy = append(busy, paths)
+					running++
+
+					go func(event model.FileEvent, paths []string) {
+						outCh <- handle(event)
+						doneCh <- paths
+					}(event, paths)
+					continue
+				}
+
+				blocked = append(blocked, paths)
+				rest = append(rest, event)
+			}
+
+			waiting = rest
+		}
+
+		for inCh != nil || running > 0 {
+			// 밀린 이벤트가 많으면 새 이벤트를 받지 않아 앞 단계가 기다리도록 함.
+			// 이벤트가 끝날 때마다 waiting 전체를 훑으므로, 전체 동기화처럼 한꺼번에 몰려와도 몇 배수까지만 꺼냄
+			in := inCh
+			if len(waiting) >= workers*waitingPerWorker {
+				in = nil
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					inCh = nil
+					continue
+				}
+				waiting = append(waiting, event)
+
+			case paths := <-doneCh:
+				running--
+				// 시작할 때 넣은 슬라이스 그대로 돌아오므로 같은 배열인지로 찾음
+				for i, p := range busy {
+					if &p[0] == &paths[0] {
+						busy = append(busy[:i], busy[i+1:]...)
+						break
+					}
+				}
+			}
+
+			dispatch()
 		}
 	}()
 
 	return outCh
 }
+
+func eventPaths(event model.FileEvent) []string {
+	paths := []string{filepath.ToSlash(event.Path)}
+	if event.OldPath != "" {
+		paths = append(paths, filepath.ToSlash(event.OldPath))
+	}
+
+	return paths
+}
+
+func overlapsAny(paths []string, others [][]string) bool {
+	for _, other := range others {
+		for _, a := range paths {
+			for _, b := range other {
+				if overlaps(a, b) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// overlaps 같은 경로이거나 한쪽이 다른 쪽의 상위 디렉터리
+func overlaps(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	return a == b || strings.HasPrefix(b, a) && b[len(a)] == '/'
+}
+
+// RunAll 전체 동기화처럼 미리 모은 이벤트를 RunLoop로 동시에 처리하고 결과를 모두 모음
+func RunAll(events []model.FileEvent, workers int, handle func(model.FileEvent) model.SyncResult) []model.SyncResult {
+	inCh := make(chan model.FileEvent, len(events))
+	for _, event := range events {
+		inCh <- event
+	}
+	close(inCh)
+
+	results := make([]model.SyncResult, 0, len(events))
+	for result := range RunLoop(inCh, workers, handle) {
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,105 @@
+package syncer
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"synco/internal/model"
+	"testing"
+	"time"
+)
+
+func TestRunLoopKeepsOrderForOverlappingPaths(t *testing.T) {
+	events := []model.FileEvent{
+		{Type: model.EventWrite, Path: "/src/dir/a.txt"},
+		{Type: model.EventWrite, Path: "/src/other.txt"},
+		{Type: model.EventRemove, Path: "/src/dir", IsDir: true},
+		{Type: model.EventRename, OldPath: "/src/other.txt", Path: "/src/dir/b.txt"},
+		{Type: model.EventWrite, Path: "/src/dir/b.txt"},
+	}
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	RunAll(events, 4, func(event model.FileEvent) model.SyncResult {
+		// 앞의 이벤트가 늦게 끝나도 겹치는 이벤트가 먼저 시작하지 않아야 함
+		if event.Type == model.EventWrite {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		mu.Lock()
+		order = append(order, string(event.Type)+" "+event.Path)
+		mu.Unlock()
+		return model.SyncResult{Event: event}
+	})
+
+	index := make(map[string]int, len(order))
+	for i, entry := range order {
+		index[entry] = i
+	}
+
+	for i, earlier := range events {
+		for _, later := range events[i+1:] {
+			if !overlapsAny(eventPaths(earlier), [][]string{eventPaths(later)}) {
+				continue
+			}
+
+			prev := string(earlier.Type) + " " + earlier.Path
+			cur := string(later.Type) + " " + later.Path
+			if index[prev] > index[cur] {
+				t.Errorf("%q finished before %q: %v", cur, prev, order)
+			}
+		}
+	}
+}
+
+func TestRunAllLimitsConcurrencyToWorkers(t *testing.T) {
+	const workers = 3
+
+	var running, peak atomic.Int64
+	events := make([]model.FileEvent, 50)
+	for i := range events {
+		events[i] = model.FileEvent{Type: model.EventWrite, Path: fmt.Sprintf("/src/%d.txt", i)}
+	}
+
+	results := RunAll(events, workers, func(event model.FileEvent) model.SyncResult {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return model.SyncResult{Event: event}
+	})
+
+	if len(results) != len(events) {
+		t.Fatalf("got %d results, want %d", len(results), len(events))
+	}
+	if peak.Load() > workers {
+		t.Errorf("%d events ran at once, want at most %d", peak.Load(), workers)
+	}
+}
+
+func TestRunAllSchedulesLargeFullSync(t *testing.T) {
+	events := make([]model.FileEvent, 100000)
+	for i := range events {
+		events[i] = model.FileEvent{Type: model.EventWrite, Path: fmt.Sprintf("/src/%d/%d.txt", i%100, i)}
+	}
+
+	start := time.Now()
+	results := RunAll(events, 8, func(event model.FileEvent) model.SyncResult {
+		return model.SyncResult{Event: event}
+	})
+
+	if len(results) != len(events) {
+		t.Fatalf("got %d results, want %d", len(results), len(events))
+	}
+	// 밀린 이벤트 전체를 매번 훑으면 수 분이 걸림
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("scheduling %d events took %s", len(events), elapsed)
+	}
+}
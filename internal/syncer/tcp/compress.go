@@ -0,0 +1,143 @@
+package tcp
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// 청크 길이의 최상위 비트가 켜져 있으면 deflate로 압축된 청크
+	compressedFlag uint32 = 1 << 31
+
+	// 이보다 작은 파일은 압축해도 이득이 거의 없음
+	minCompressSize = 1024
+
+	entropySampleSize = 64 * 1024
+	// 샘플의 바이트당 엔트로피가 이보다 높으면 이미 압축되었거나 암호화된 내용으로 봄
+	maxEntropy = 7.5
+)
+
+// 이미 압축된 형식이라 다시 압축해도 줄지 않는 확장자
+var incompressibleExts = map[string]struct{}{
+	".7z": {}, ".br": {}, ".bz2": {}, ".gz": {}, ".lz4": {}, ".rar": {}, ".tgz": {}, ".xz": {}, ".zip": {}, ".zst": {},
+	".avif": {}, ".gif": {}, ".heic": {}, ".jpeg": {}, ".jpg": {}, ".png": {}, ".webp": {},
+	".aac": {}, ".flac": {}, ".m4a": {}, ".mp3": {}, ".ogg": {}, ".opus": {},
+	".avi": {}, ".m4v": {}, ".mkv": {}, ".mov": {}, ".mp4": {}, ".webm": {},
+	".apk": {}, ".docx": {}, ".jar": {}, ".pdf": {}, ".pptx": {}, ".xlsx": {},
+}
+
+// shouldCompress 이미 압축된 형식은 확장자로 거르고, 나머지는 앞부분 샘플의 엔트로피로 판단
+func shouldCompress(f *os.File, size int64) bool {
+	if size < minCompressSize {
+		return false
+	}
+
+	if _, ok := incompressibleExts[strings.ToLower(filepath.Ext(f.Name()))]; ok {
+		return false
+	}
+
+	sample := make([]byte, min(size, entropySampleSize))
+	n, err := f.ReadAt(sample, 0)
+	if n == 0 && err != nil {
+		return false
+	}
+
+	return entropy(sample[:n]) < maxEntropy
+}
+
+// entropy 바이트당 섀넌 엔트로피 (0~8 bits)
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+
+	var e float64
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+
+		p := float64(n) / float64(len(b))
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
+
+// compressor 청크마다 새로 만들지 않도록 deflate writer와 버퍼를 재사용
+type compressor struct {
+	fw  *flate.Writer
+	buf bytes.Buffer
+}
+
+func newCompressor() *compressor {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &compressor{fw: fw}
+}
+
+// compress 압축한 결과가 원본보다 작을 때만 true. 반환한 슬라이스는 다음 호출까지만 유효
+func (c *compressor) compress(p []byte) ([]byte, bool) {
+	c.buf.Reset()
+	c.fw.Reset(&c.buf)
+
+	if _, err := c.fw.Write(p); err != nil {
+		return nil, false
+	}
+
+	if err := c.fw.Close(); err != nil {
+		return nil, false
+	}
+
+	if c.buf.Len() >= len(p) {
+		return nil, false
+	}
+
+	return c.buf.Bytes(), true
+}
+
+// readCompressed 압축된 블록 하나를 읽어 풂. 풀린 크기가 MaxChunkSize를 넘으면 에러
+func readCompressed(r io.Reader, length uint32) ([]byte, error) {
+	if length > MaxChunkSize {
+		return nil, fmt.Errorf("compressed chunk too large: %d bytes", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	fr := flate.NewReader(bytes.NewReader(data))
+	defer func(fr io.ReadCloser) {
+		_ = fr.Close()
+	}(fr)
+
+	out, err := io.ReadAll(io.LimitReader(fr, MaxChunkSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress chunk: %w", err)
+	}
+
+	if len(out) > MaxChunkSize {
+		return nil, fmt.Errorf("decompressed chunk too large")
+	}
+
+	return out, nil
+}
+
+// countingWriter 실제로 연결에 쓴 바이트 수를 셈
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
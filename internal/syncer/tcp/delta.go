@@ -0,0 +1,520 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+const (
+	minBlockSize = 2 * 1024   // 2KB
+	maxBlockSize = 128 * 1024 // 128KB
+	maxBlocks    = 1 << 20
+
+	// 이보다 작은 파일은 시그니처 교환 없이 전체 전송
+	DeltaThreshold = 64 * 1024 // 64KB
+)
+
+const (
+	opEnd     byte = 0x00
+	opLiteral byte = 0x01
+	opCopy    byte = 0x02
+	// deflate로 압축된 literal. 압축을 지원하는 서버에만 보냄
+	opCompressed byte = 0x03
+)
+
+type BlockSignature struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+type Signature struct {
+	BlockSize uint32
+	FileSize  int64
+	Blocks    []BlockSignature
+}
+
+func (sig Signature) blockLen(idx uint32) int64 {
+	start := int64(idx) * int64(sig.BlockSize)
+	return min(int64(sig.BlockSize), sig.FileSize-start)
+}
+
+// rsync와 같이 파일 크기의 제곱근 근처로 블록 크기를 정함
+func blockSizeFor(size int64) uint32 {
+	bs := int64(math.Sqrt(float64(size)))
+	bs = (bs + 1023) / 1024 * 1024
+
+	return uint32(min(max(bs, minBlockSize), maxBlockSize))
+}
+
+func weakChecksum(b []byte) (uint32, uint32) {
+	var a, s uint32
+	n := uint32(len(b))
+	for i, c := range b {
+		a += uint32(c)
+		s += (n - uint32(i)) * uint32(c)
+	}
+
+	return a, s
+}
+
+func weakSum(a, b uint32) uint32 {
+	return (a & 0xffff) | (b << 16)
+}
+
+func ComputeSignature(r io.Reader, size int64) (Signature, error) {
+	sig := Signature{
+		BlockSize: blockSizeFor(size),
+		FileSize:  size,
+	}
+
+	buf := make([]byte, sig.BlockSize)
+	var read int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			a, b := weakChecksum(buf[:n])
+			sig.Blocks = append(sig.Blocks, BlockSignature{
+				Weak:   weakSum(a, b),
+				Strong: sha256.Sum256(buf[:n]),
+			})
+			read += int64(n)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return sig, err
+		}
+	}
+
+	// 읽는 도중 파일이 바뀌었을 수 있으므로 실제로 읽은 크기를 기준으로 함
+	sig.FileSize = read
+	return sig, nil
+}
+
+func WriteSignature(w io.Writer, sig Signature) error {
+	if err := binary.Write(w, binary.BigEndian, sig.BlockSize); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, sig.FileSize); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(sig.Blocks))); err != nil {
+		return err
+	}
+
+	for _, b := range sig.Blocks {
+		if err := binary.Write(w, binary.BigEndian, b.Weak); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(b.Strong[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ReadSignature(r io.Reader) (Signature, error) {
+	var sig Signature
+	if err := binary.Read(r, binary.BigEndian, &sig.BlockSize); err != nil {
+		return sig, err
+	}
+
+	if sig.BlockSize < minBlockSize || sig.BlockSize > maxBlockSize {
+		return sig, fmt.Errorf("invalid block size: %d", sig.BlockSize)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &sig.FileSize); err != nil {
+		return sig, err
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return sig, err
+	}
+
+	if count > maxBlocks || int64(count) != (sig.FileSize+int64(sig.BlockSize)-1)/int64(sig.BlockSize) {
+		return sig, fmt.Errorf("invalid block count: %d", count)
+	}
+
+	sig.Blocks = make([]BlockSignature, count)
+	for i := range sig.Blocks {
+		if err := binary.Read(r, binary.BigEndian, &sig.Blocks[i].Weak); err != nil {
+			return sig, err
+		}
+
+		if _, err := io.ReadFull(r, sig.Blocks[i].Strong[:]); err != nil {
+			return sig, err
+		}
+	}
+
+	return sig, nil
+}
+
+type deltaEncoder struct {
+	w    io.Writer
+	lit  []byte
+	comp *compressor
+}
+
+func (e *deltaEncoder) literal(c byte) error {
+	e.lit = append(e.lit, c)
+	if len(e.lit) >= ChunkSize {
+		return e.flush()
+	}
+
+	return nil
+}
+
+func (e *deltaEncoder) flush() error {
+	if len(e.lit) == 0 {
+		return nil
+	}
+
+	op, data := opLiteral, e.lit
+	if e.comp != nil {
+		if compressed, ok := e.comp.compress(e.lit); ok {
+			op, data = opCompressed, compressed
+		}
+	}
+
+	if _, err := e.w.Write([]byte{op}); err != nil {
+		return err
+	}
+
+	if err := binary.Write(e.w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+
+	e.lit = e.lit[:0]
+	return nil
+}
+
+func (e *deltaEncoder) copyBlock(idx int) error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Write([]byte{opCopy}); err != nil {
+		return err
+	}
+
+	return binary.Write(e.w, binary.BigEndian, uint32(idx))
+}
+
+// WriteDelta sig를 기준으로 r의 내용을 literal/블록 참조 연산으로 인코딩해 전송.
+// 마지막에 opEnd와 전체 내용의 SHA-256을 붙임
+func WriteDelta(w io.Writer, r io.Reader, sig Signature) ([]byte, error) {
+	return writeDelta(w, r, sig, nil)
+}
+
+// comp가 있으면 줄어드는 literal을 opCompressed로 보냄
+func writeDelta(w io.Writer, r io.Reader, sig Signature, comp *compressor) ([]byte, error) {
+	h := sha256.New()
+	br := bufio.NewReaderSize(io.TeeReader(r, h), 64*1024)
+	enc := &deltaEncoder{w: w, lit: make([]byte, 0, ChunkSize), comp: comp}
+
+	index := make(map[uint32][]int, len(sig.Blocks))
+	for i, b := range sig.Blocks {
+		index[b.Weak] = append(index[b.Weak], i)
+	}
+
+	bs := int(sig.BlockSize)
+	ring := make([]byte, bs)
+	window := make([]byte, bs)
+	start, n := 0, 0
+	var a, b uint32
+	eof := len(sig.Blocks) == 0
+
+	fill := func() error {
+		start, n = 0, 0
+		for n < bs {
+			c, err := br.ReadByte()
+			if errors.Is(err, io.EOF) {
+				eof = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			ring[n] = c
+			n++
+		}
+
+		a, b = weakChecksum(ring[:n])
+		return nil
+	}
+
+	if !eof {
+		if err := fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	for n > 0 {
+		if candidates, ok := index[weakSum(a, b)]; ok {
+			for i := range n {
+				window[i] = ring[(start+i)%bs]
+			}
+
+			strong := sha256.Sum256(window[:n])
+			matched := -1
+			for _, idx := range candidates {
+				if sig.blockLen(uint32(idx)) == int64(n) && sig.Blocks[idx].Strong == strong {
+					matched = idx
+					break
+				}
+			}
+
+			if matched >= 0 {
+				if err := enc.copyBlock(matched); err != nil {
+					return nil, err
+				}
+
+				if err := fill(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		out := ring[start]
+		if err := enc.literal(out); err != nil {
+			return nil, err
+		}
+
+		if !eof {
+			c, err := br.ReadByte()
+			if err == nil {
+				ring[start] = c
+				start = (start + 1) % bs
+				a = a - uint32(out) + uint32(c)
+				b = b - uint32(bs)*uint32(out) + a
+				continue
+			}
+
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			eof = true
+		}
+
+		// 파일 끝: 윈도우를 한 바이트씩 줄여가며 마지막 (짧은) 블록과 비교
+		a -= uint32(out)
+		b -= uint32(n) * uint32(out)
+		start = (start + 1) % bs
+		n--
+	}
+
+	// 시그니처가 없으면 남은 내용 전체가 literal
+	for {
+		c, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := enc.literal(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write([]byte{opEnd}); err != nil {
+		return nil, err
+	}
+
+	sum := h.Sum(nil)
+	if _, err := w.Write(sum); err != nil {
+		return nil, err
+	}
+
+	return sum, nil
+}
+
+type patchReader struct {
+	r       io.Reader
+	base    io.ReaderAt
+	sig     Signature
+	h       hash.Hash
+	size    int64
+	written int64
+	pending []byte
+	buf     []byte
+	lit     io.Reader
+	done    bool
+}
+
+// NewPatchReader WriteDelta로 전송된 연산을 base에 적용해 새 파일 내용을 만들어내는 io.Reader를 반환
+func NewPatchReader(r io.Reader, base io.ReaderAt, sig Signature, size int64) io.Reader {
+	return &patchReader{
+		r:    r,
+		base: base,
+		sig:  sig,
+		h:    sha256.New(),
+		size: size,
+		buf:  make([]byte, sig.BlockSize),
+	}
+}
+
+func (p *patchReader) Read(out []byte) (int, error) {
+	for {
+		if p.done {
+			return 0, io.EOF
+		}
+
+		if len(p.pending) > 0 {
+			n := copy(out, p.pending)
+			p.pending = p.pending[n:]
+			return n, nil
+		}
+
+		if p.lit != nil {
+			n, err := p.lit.Read(out)
+			if n > 0 {
+				p.h.Write(out[:n])
+				p.written += int64(n)
+				if p.written > p.size {
+					return n, ErrSizeMismatch
+				}
+				return n, nil
+			}
+
+			if errors.Is(err, io.EOF) {
+				p.lit = nil
+				continue
+			}
+
+			return 0, err
+		}
+
+		var op [1]byte
+		if _, err := io.ReadFull(p.r, op[:]); err != nil {
+			return 0, err
+		}
+
+		switch op[0] {
+		case opLiteral:
+			var length uint32
+			if err := binary.Read(p.r, binary.BigEndian, &length); err != nil {
+				return 0, err
+			}
+
+			if length > MaxChunkSize {
+				return 0, fmt.Errorf("literal too large: %d bytes", length)
+			}
+
+			p.lit = &exactReader{r: io.LimitReader(p.r, int64(length)), remaining: int64(length)}
+
+		case opCompressed:
+			var length uint32
+			if err := binary.Read(p.r, binary.BigEndian, &length); err != nil {
+				return 0, err
+			}
+
+			data, err := readCompressed(p.r, length)
+			if err != nil {
+				return 0, err
+			}
+
+			p.lit = bytes.NewReader(data)
+
+		case opCopy:
+			var idx uint32
+			if err := binary.Read(p.r, binary.BigEndian, &idx); err != nil {
+				return 0, err
+			}
+
+			if int(idx) >= len(p.sig.Blocks) {
+				return 0, fmt.Errorf("invalid block index: %d", idx)
+			}
+
+			length := p.sig.blockLen(idx)
+			block := p.buf[:length]
+			if _, err := p.base.ReadAt(block, int64(idx)*int64(p.sig.BlockSize)); err != nil && !errors.Is(err, io.EOF) {
+				return 0, fmt.Errorf("failed to read base block %d: %w", idx, err)
+			}
+
+			// 시그니처 계산 이후 기존 파일이 바뀌었다면 잘못된 내용을 조립하게 되므로 검증
+			if sha256.Sum256(block) != p.sig.Blocks[idx].Strong {
+				return 0, fmt.Errorf("base block %d changed during transfer", idx)
+			}
+
+			p.h.Write(block)
+			p.written += length
+			if p.written > p.size {
+				return 0, ErrSizeMismatch
+			}
+			p.pending = block
+
+		case opEnd:
+			return 0, p.finish()
+
+		default:
+			return 0, fmt.Errorf("unknown delta op: %d", op[0])
+		}
+	}
+}
+
+func (p *patchReader) finish() error {
+	p.done = true
+
+	// AtomicWrite가 rename하기 전에 기존 파일 핸들을 닫음 (Windows에서는 열린 파일을 덮어쓸 수 없음)
+	if c, ok := p.base.(io.Closer); ok {
+		_ = c.Close()
+	}
+
+	expected := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(p.r, expected); err != nil {
+		return err
+	}
+
+	if p.written != p.size {
+		return ErrSizeMismatch
+	}
+
+	if !ChecksumEqual(p.h.Sum(nil), expected) {
+		return ErrChecksumMismatch
+	}
+
+	return io.EOF
+}
+
+// literal 구간이 끝나기 전에 연결이 끊기면 EOF 대신 ErrUnexpectedEOF를 반환
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+
+	if errors.Is(err, io.EOF) && e.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,171 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func applyDelta(base []byte, delta io.Reader, sig Signature, size int64) ([]byte, error) {
+	var out bytes.Buffer
+	_, err := out.ReadFrom(NewPatchReader(delta, bytes.NewReader(base), sig, size))
+	return out.Bytes(), err
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := randomBytes(t, 300*1024+123)
+
+	inserted := append(append(append([]byte{}, base[:100000]...), []byte("inserted")...), base[100000:]...)
+	flipped := append([]byte{}, base...)
+	flipped[200000] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unchanged", base},
+		{"byte flipped", flipped},
+		{"bytes inserted", inserted},
+		{"truncated", base[:150000]},
+		{"prefix removed", base[1000:]},
+		{"appended", append(append([]byte{}, base...), []byte("tail")...)},
+		{"empty", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := ComputeSignature(bytes.NewReader(base), int64(len(base)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var delta bytes.Buffer
+			if _, err := WriteDelta(&delta, bytes.NewReader(tt.data), sig); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := applyDelta(base, &delta, sig, int64(len(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("patched %d bytes, want %d bytes of the new content", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestReadSignatureRejectsInvalidHeader(t *testing.T) {
+	header := func(blockSize uint32, fileSize int64, count uint32) *bytes.Buffer {
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.BigEndian, blockSize)
+		_ = binary.Write(&buf, binary.BigEndian, fileSize)
+		_ = binary.Write(&buf, binary.BigEndian, count)
+		return &buf
+	}
+
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"block size too small", header(minBlockSize-1, 0, 0)},
+		{"block size too large", header(maxBlockSize+1, 0, 0)},
+		{"count does not match size", header(minBlockSize, 10*minBlockSize, 1)},
+		{"too many blocks", header(minBlockSize, int64(maxBlocks+1)*minBlockSize, maxBlocks+1)},
+		{"truncated blocks", header(minBlockSize, minBlockSize, 1)},
+	}
+
+	for _, tt := range tests {
+		if _, err := ReadSignature(tt.r); err == nil {
+			t.Errorf("%s: signature was accepted", tt.name)
+		}
+	}
+}
+
+func TestPatchReaderRejectsOutOfBoundsDelta(t *testing.T) {
+	base := randomBytes(t, 3*minBlockSize)
+	sig, err := ComputeSignature(bytes.NewReader(base), int64(len(base)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyOp := func(idx uint32) []byte {
+		var buf bytes.Buffer
+		buf.WriteByte(opCopy)
+		_ = binary.Write(&buf, binary.BigEndian, idx)
+		return buf.Bytes()
+	}
+	literalOp := func(length uint32, data []byte) []byte {
+		var buf bytes.Buffer
+		buf.WriteByte(opLiteral)
+		_ = binary.Write(&buf, binary.BigEndian, length)
+		buf.Write(data)
+		return buf.Bytes()
+	}
+	end := func(content []byte) []byte {
+		sum := sha256.Sum256(content)
+		return append([]byte{opEnd}, sum[:]...)
+	}
+
+	tests := []struct {
+		name  string
+		delta []byte
+		size  int64
+		want  error
+	}{
+		{"block index past the signature", copyOp(uint32(len(sig.Blocks))), int64(len(base)), nil},
+		{"huge block index", copyOp(^uint32(0)), int64(len(base)), nil},
+		{"literal larger than a chunk", literalOp(MaxChunkSize+1, nil), MaxChunkSize + 1, nil},
+		{"literal cut short", literalOp(100, []byte("short")), 100, io.ErrUnexpectedEOF},
+		{"more content than announced", append(copyOp(0), end(base[:minBlockSize])...), minBlockSize - 1, ErrSizeMismatch},
+		{"less content than announced", append(copyOp(0), end(base[:minBlockSize])...), minBlockSize + 1, ErrSizeMismatch},
+		{"wrong checksum", append(copyOp(0), end([]byte("other"))...), minBlockSize, ErrChecksumMismatch},
+		{"unknown op", []byte{0x7f}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		_, err := applyDelta(base, bytes.NewReader(tt.delta), sig, tt.size)
+		if err == nil {
+			t.Errorf("%s: delta was accepted", tt.name)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPatchReaderDetectsChangedBase(t *testing.T) {
+	base := randomBytes(t, 2*minBlockSize)
+	sig, err := ComputeSignature(bytes.NewReader(base), int64(len(base)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var delta bytes.Buffer
+	if _, err := WriteDelta(&delta, bytes.NewReader(base), sig); err != nil {
+		t.Fatal(err)
+	}
+
+	// 시그니처를 만든 뒤 받는 쪽의 파일이 바뀐 경우
+	changed := append([]byte{}, base...)
+	changed[0] ^= 0xff
+
+	if _, err := applyDelta(changed, &delta, sig, int64(len(base))); err == nil {
+		t.Error("patch was applied to a changed base")
+	}
+}
@@ -0,0 +1,157 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ProtocolVersion 세션 핸드셰이크로 주고받는 프로토콜 버전. 세션 이전의 연결마다 메시지 하나를
+// 보내는 형식이 1. 메시지 형식이 호환되지 않게 바뀌면 올리고, 지원하는 가장 낮은 버전은 MinProtocolVersion
+const (
+	ProtocolVersion    uint16 = 2
+	MinProtocolVersion uint16 = 2
+)
+
+var helloMagic = [4]byte{'S', 'Y', 'N', 'C'}
+
+var ErrIncompatibleProtocol = errors.New("incompatible protocol")
+
+// Feature 노드가 지원하는 기능. 세션에서는 양쪽 모두 지원하는 기능만 사용
+type Feature uint32
+
+const (
+	// FeatureStreaming 청크 단위 전송과 체크섬 트레일러
+	FeatureStreaming Feature = 1 << iota
+	FeatureDelta
+	FeatureResume
+	FeatureManifest
+	// FeatureCompression 청크와 delta literal을 deflate로 압축
+	FeatureCompression
+	// FeatureRename 서버에서 파일을 옮기는 MessageRename
+	FeatureRename
+	// FeatureDirs 디렉터리를 만들고 지우고 옮기는 메시지
+	FeatureDirs
+	// FeatureMeta 내용과 함께 권한, 소유자, 확장 속성을 보냄
+	FeatureMeta
+	// FeatureSymlinks 링크를 가리키는 경로 그대로 만드는 MessageSymlink
+	FeatureSymlinks
+	// FeatureKeep 목록과 함께 받은 무시 규칙에 맞는 파일을 mirror에서 지우지 않음
+	FeatureKeep
+	// FeatureDirVersions 디렉터리를 지우거나 옮길 때 그 아래 파일의 벡터를 함께 보내 동시에 바뀐 파일을 남김
+	FeatureDirVersions
+)
+
+const supportedFeatures = FeatureStreaming | FeatureDelta | FeatureResume | FeatureManifest | FeatureCompression | FeatureRename | FeatureDirs | FeatureMeta | FeatureSymlinks | FeatureKeep | FeatureDirVersions
+
+// legacyFeatures 세션을 지원하지 않는 이전 버전이 제공하던 기능
+const legacyFeatures = FeatureStreaming | FeatureDelta | FeatureResume
+
+var featureNames = []struct {
+	f    Feature
+	name string
+}{
+	{FeatureStreaming, "streaming"},
+	{FeatureDelta, "delta"},
+	{FeatureResume, "resume"},
+	{FeatureManifest, "manifest"},
+	{FeatureCompression, "compression"},
+	{FeatureRename, "rename"},
+	{FeatureDirs, "dirs"},
+	{FeatureMeta, "meta"},
+	{FeatureSymlinks, "symlinks"},
+	{FeatureKeep, "keep"},
+	{FeatureDirVersions, "dir-versions"},
+}
+
+func (f Feature) Has(other Feature) bool {
+	return f&other == other
+}
+
+func (f Feature) String() string {
+	var names []string
+	for _, n := range featureNames {
+		if f.Has(n.f) {
+			names = append(names, n.name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// Hello 세션을 열 때 양쪽이 보내는 정보. 클라이언트는 MessageSession 뒤에, 서버는 OK 응답 뒤에 보냄
+type Hello struct {
+	Version  uint16
+	NodeID   string
+	Features Feature
+}
+
+func localHello(nodeID string) Hello {
+	return Hello{
+		Version:  ProtocolVersion,
+		NodeID:   nodeID,
+		Features: supportedFeatures,
+	}
+}
+
+func WriteHello(w io.Writer, h Hello) error {
+	if _, err := w.Write(helloMagic[:]); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, h.Version); err != nil {
+		return err
+	}
+
+	if err := writeString(w, h.NodeID); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, uint32(h.Features))
+}
+
+func ReadHello(r io.Reader) (Hello, error) {
+	var h Hello
+
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return h, err
+	}
+	if magic != helloMagic {
+		return h, fmt.Errorf("%w: peer is not a synco node", ErrIncompatibleProtocol)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &h.Version); err != nil {
+		return h, err
+	}
+
+	nodeID, err := readString(r)
+	if err != nil {
+		return h, err
+	}
+	h.NodeID = nodeID
+
+	var features uint32
+	if err := binary.Read(r, binary.BigEndian, &features); err != nil {
+		return h, err
+	}
+	h.Features = Feature(features)
+
+	return h, nil
+}
+
+// negotiate 두 노드 모두 지원하는 버전과 기능. 상대 버전이 범위를 벗어나면 ErrIncompatibleProtocol
+func negotiate(local, remote Hello) (Hello, error) {
+	if remote.Version < MinProtocolVersion {
+		return Hello{}, fmt.Errorf("%w: peer %s speaks version %d, this node requires %d or newer",
+			ErrIncompatibleProtocol, remote.NodeID, remote.Version, MinProtocolVersion)
+	}
+
+	return Hello{
+		Version:  min(local.Version, remote.Version),
+		NodeID:   remote.NodeID,
+		Features: local.Features & remote.Features,
+	}, nil
+}
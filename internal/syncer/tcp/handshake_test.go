@@ -0,0 +1,141 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHelloRoundTrip(t *testing.T) {
+	want := Hello{Version: ProtocolVersion, NodeID: "node", Features: supportedFeatures}
+
+	var buf bytes.Buffer
+	if err := WriteHello(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadHello(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadHelloRejectsOtherProtocols(t *testing.T) {
+	_, err := ReadHello(bytes.NewReader([]byte("GET / HTTP/1.1\r\n\r\n")))
+	if !errors.Is(err, ErrIncompatibleProtocol) {
+		t.Errorf("got %v, want ErrIncompatibleProtocol", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	local := localHello("local")
+
+	tests := []struct {
+		name    string
+		remote  Hello
+		want    Hello
+		wantErr bool
+	}{
+		{"same version", Hello{Version: ProtocolVersion, NodeID: "remote", Features: supportedFeatures},
+			Hello{Version: ProtocolVersion, NodeID: "remote", Features: supportedFeatures}, false},
+		{"newer peer with unknown features", Hello{Version: ProtocolVersion + 1, NodeID: "remote", Features: supportedFeatures | 1<<31},
+			Hello{Version: ProtocolVersion, NodeID: "remote", Features: supportedFeatures}, false},
+		{"peer without some features", Hello{Version: ProtocolVersion, NodeID: "remote", Features: legacyFeatures},
+			Hello{Version: ProtocolVersion, NodeID: "remote", Features: legacyFeatures}, false},
+		{"older peer", Hello{Version: MinProtocolVersion - 1, NodeID: "remote", Features: legacyFeatures}, Hello{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := negotiate(local, tt.remote)
+		if tt.wantErr {
+			if !errors.Is(err, ErrIncompatibleProtocol) {
+				t.Errorf("%s: got %v, want ErrIncompatibleProtocol", tt.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServerHandshake(t *testing.T) {
+	_, s := startSync(t, t.TempDir(), t.TempDir(), Options{})
+
+	// hello 대신 다른 내용을 보내면 magic이 없음
+	other := func(w *bufio.Writer) error {
+		_, err := w.WriteString("GET / HTTP/1.1\r\n\r\n........")
+		return err
+	}
+	hello := func(h Hello) func(w *bufio.Writer) error {
+		return func(w *bufio.Writer) error { return WriteHello(w, h) }
+	}
+
+	tests := []struct {
+		name  string
+		write func(w *bufio.Writer) error
+		want  ResponseCode
+	}{
+		{"current version", hello(localHello(s.id.NodeID)), ResponseOK},
+		{"newer version", hello(Hello{Version: ProtocolVersion + 1, NodeID: s.id.NodeID, Features: 0xffff}), ResponseOK},
+		{"older version", hello(Hello{Version: MinProtocolVersion - 1, NodeID: s.id.NodeID, Features: legacyFeatures}), ResponseIncompatible},
+		{"not a synco node", other, ResponseIncompatible},
+		{"node id of another peer", hello(Hello{Version: ProtocolVersion, NodeID: "other", Features: supportedFeatures}), ResponseErr},
+	}
+
+	for _, tt := range tests {
+		resp, remote := openSession(t, s, tt.write)
+		if resp.Code != tt.want {
+			t.Errorf("%s: got response %d (%s), want %d", tt.name, resp.Code, resp.Msg, tt.want)
+			continue
+		}
+
+		if resp.Code == ResponseOK && (remote.Version != ProtocolVersion || remote.Features != supportedFeatures) {
+			t.Errorf("%s: server sent %+v", tt.name, remote)
+		}
+	}
+}
+
+// openSession MessageSession 뒤에 write로 hello를 보내고 서버의 응답을 읽음
+func openSession(t *testing.T, s *Syncer, write func(w *bufio.Writer) error) (Response, Hello) {
+	t.Helper()
+
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	if err := WriteMessage(w, Message{Type: MessageSession, OriginID: s.id.NodeID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := ReadResponse(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != ResponseOK {
+		return resp, Hello{}
+	}
+
+	remote, err := ReadHello(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, remote
+}
@@ -0,0 +1,325 @@
+package tcp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"synco/internal/ignore"
+	"time"
+)
+
+// 목록이 이보다 크면 거부. 항목당 수백 바이트이므로 메모리 사용은 수백 MB 이하로 제한됨
+const maxManifestEntries = 1 << 20
+
+const (
+	manifestMirror byte = 0x01
+	// manifestKeep 목록 뒤에 서버가 mirror에서 지우면 안 되는 경로의 규칙이 이어짐
+	manifestKeep byte = 0x02
+)
+
+// ManifestEntry 전체 동기화 시 src에 있는 파일 하나. Vector는 src에 저장된 이 경로의 version vector
+type ManifestEntry struct {
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	Checksum []byte
+	Vector   map[string]uint64
+}
+
+type Manifest struct {
+	// Mirror이면 서버가 목록에 없는 파일을 삭제
+	Mirror  bool
+	Entries []ManifestEntry
+	// Ignore src에서 무시한 경로의 규칙. 서버는 이 규칙에 맞는 파일을 목록에 없어도 지우지 않음
+	Ignore ignore.Rules
+	// Skipped 링크 정책에 따라 src에서 건너뛴 경로. 서버는 이 경로와 그 아래를 지우지 않음
+	Skipped []string
+}
+
+// hasKeep 서버에 지키라고 알릴 경로가 있으면 true
+func (m Manifest) hasKeep() bool {
+	return len(m.Ignore.Patterns) > 0 || len(m.Ignore.Files) > 0 || len(m.Skipped) > 0
+}
+
+// ManifestDiff Need는 서버에 없거나 내용이 다른 파일, Extra는 서버에만 있는 파일.
+// Mirror인 경우 Extra는 서버가 삭제한 파일. Merged는 내용이 같아 전송하지 않은 파일 중
+// 서버의 벡터가 더 앞서 있던 경로로, 클라이언트도 이 벡터를 합쳐야 이후 변경이 충돌로 오인되지 않음
+type ManifestDiff struct {
+	Need   []string
+	Extra  []string
+	Merged map[string]map[string]uint64
+}
+
+func WriteManifest(w io.Writer, m Manifest) error {
+	var flags byte
+	if m.Mirror {
+		flags |= manifestMirror
+	}
+	if m.hasKeep() {
+		flags |= manifestKeep
+	}
+
+	if _, err := w.Write([]byte{flags}); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(m.Entries))); err != nil {
+		return err
+	}
+
+	for _, e := range m.Entries {
+		if err := writeString(w, e.Path); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, e.Size); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, e.ModTime.UnixNano()); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(e.Checksum); err != nil {
+			return err
+		}
+
+		if err := writeClock(w, e.Vector); err != nil {
+			return err
+		}
+	}
+
+	if m.hasKeep() {
+		return writeKeep(w, m)
+	}
+
+	return nil
+}
+
+func writeKeep(w io.Writer, m Manifest) error {
+	if err := writeStrings(w, m.Ignore.Patterns); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(m.Ignore.Files))); err != nil {
+		return err
+	}
+
+	for dir, lines := range m.Ignore.Files {
+		if err := writeString(w, dir); err != nil {
+			return err
+		}
+
+		if err := writeStrings(w, lines); err != nil {
+			return err
+		}
+	}
+
+	return writeStrings(w, m.Skipped)
+}
+
+func readKeep(r io.Reader, m *Manifest) error {
+	var err error
+	if m.Ignore.Patterns, err = readStrings(r); err != nil {
+		return err
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if count > maxManifestEntries {
+		return fmt.Errorf("too many ignore files: %d", count)
+	}
+
+	m.Ignore.Files = make(map[string][]string, count)
+	for range count {
+		dir, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		if m.Ignore.Files[dir], err = readStrings(r); err != nil {
+			return err
+		}
+	}
+
+	m.Skipped, err = readStrings(r)
+	return err
+}
+
+func writeStrings(w io.Writer, list []string) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(list))); err != nil {
+		return err
+	}
+
+	for _, s := range list {
+		if err := writeString(w, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readStrings(r io.Reader) ([]string, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	if count > maxManifestEntries {
+		return nil, fmt.Errorf("too many strings: %d", count)
+	}
+
+	list := make([]string, 0, count)
+	for range count {
+		s, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+
+	flags := make([]byte, 1)
+	if _, err := io.ReadFull(r, flags); err != nil {
+		return m, err
+	}
+	m.Mirror = flags[0]&manifestMirror != 0
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return m, err
+	}
+	if count > maxManifestEntries {
+		return m, fmt.Errorf("manifest too large: %d entries", count)
+	}
+
+	m.Entries = make([]ManifestEntry, 0, count)
+	for range count {
+		var e ManifestEntry
+
+		path, err := readString(r)
+		if err != nil {
+			return m, err
+		}
+		e.Path = path
+
+		if err := binary.Read(r, binary.BigEndian, &e.Size); err != nil {
+			return m, err
+		}
+		if e.Size < 0 {
+			return m, fmt.Errorf("invalid size: %d", e.Size)
+		}
+
+		var modTimeNano int64
+		if err := binary.Read(r, binary.BigEndian, &modTimeNano); err != nil {
+			return m, err
+		}
+		e.ModTime = time.Unix(0, modTimeNano)
+
+		e.Checksum = make([]byte, sha256.Size)
+		if _, err := io.ReadFull(r, e.Checksum); err != nil {
+			return m, err
+		}
+
+		e.Vector, err = readClock(r)
+		if err != nil {
+			return m, err
+		}
+
+		m.Entries = append(m.Entries, e)
+	}
+
+	if flags[0]&manifestKeep != 0 {
+		if err := readKeep(r, &m); err != nil {
+			return m, err
+		}
+	}
+
+	return m, nil
+}
+
+func WriteManifestDiff(w io.Writer, d ManifestDiff) error {
+	for _, paths := range [][]string{d.Need, d.Extra} {
+		if err := binary.Write(w, binary.BigEndian, uint32(len(paths))); err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			if err := writeString(w, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(d.Merged))); err != nil {
+		return err
+	}
+
+	for p, vector := range d.Merged {
+		if err := writeString(w, p); err != nil {
+			return err
+		}
+
+		if err := writeClock(w, vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ReadManifestDiff(r io.Reader) (ManifestDiff, error) {
+	var d ManifestDiff
+
+	for _, dst := range []*[]string{&d.Need, &d.Extra} {
+		var count uint32
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return d, err
+		}
+		if count > maxManifestEntries {
+			return d, fmt.Errorf("manifest diff too large: %d entries", count)
+		}
+
+		paths := make([]string, 0, count)
+		for range count {
+			p, err := readString(r)
+			if err != nil {
+				return d, err
+			}
+			paths = append(paths, p)
+		}
+
+		*dst = paths
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return d, err
+	}
+	if count > maxManifestEntries {
+		return d, fmt.Errorf("manifest diff too large: %d entries", count)
+	}
+
+	d.Merged = make(map[string]map[string]uint64, count)
+	for range count {
+		p, err := readString(r)
+		if err != nil {
+			return d, err
+		}
+
+		d.Merged[p], err = readClock(r)
+		if err != nil {
+			return d, err
+		}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,130 @@
+package tcp
+
+import (
+	"os"
+	"path/filepath"
+	"synco/internal/ignore"
+	"synco/internal/model"
+	"testing"
+	"time"
+)
+
+// writeTree 상대 경로별 내용으로 root 아래에 파일을 만듦
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkExists 경로마다 dst에 있어야 하는지 확인. 링크는 따라가지 않음
+func checkExists(t *testing.T, root string, want map[string]bool) {
+	t.Helper()
+
+	for rel, exists := range want {
+		_, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel)))
+		if (err == nil) != exists {
+			t.Errorf("%s: exists=%v, want %v", rel, err == nil, exists)
+		}
+	}
+}
+
+func TestFullSyncSendsOnlyChangedFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b", "c.txt": "c-src"})
+	writeTree(t, dst, map[string]string{"sub/b.txt": "b", "c.txt": "c-dst-older", "d.txt": "extra"})
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dst, "c.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s := startSync(t, src, dst, Options{})
+
+	sent := make(map[string]bool)
+	for _, result := range fullSync(t, s) {
+		rel, _ := filepath.Rel(src, result.Event.Path)
+		sent[filepath.ToSlash(rel)] = true
+	}
+	if len(sent) != 2 || !sent["a.txt"] || !sent["c.txt"] {
+		t.Errorf("sent %v, want a.txt and c.txt", sent)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dst, "c.txt")); string(data) != "c-src" {
+		t.Errorf("c.txt = %q, want the source content", data)
+	}
+	// mirror가 아니면 src에 없는 파일을 남김
+	checkExists(t, dst, map[string]bool{"d.txt": true})
+
+	if results := fullSync(t, s); len(results) != 0 {
+		t.Errorf("second full sync sent %d files, want none", len(results))
+	}
+}
+
+func TestMirrorRemovesExtraFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a"})
+	writeTree(t, dst, map[string]string{"a.txt": "a", "d.txt": "extra", "sub/e.txt": "extra", "x.synco.tmp": "in flight"})
+
+	_, s := startSync(t, src, dst, Options{Mirror: true})
+	fullSync(t, s)
+
+	// 전송 중인 임시 파일은 지우지 않음
+	checkExists(t, dst, map[string]bool{
+		"a.txt":       true,
+		"d.txt":       false,
+		"sub/e.txt":   false,
+		"x.synco.tmp": true,
+	})
+}
+
+func TestMirrorKeepsIgnoredFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "sub/" + ignore.FileName: "out/\n", "sub/out/x": "x"})
+	writeTree(t, dst, map[string]string{".git/config": "g", "sub/out/y": "y", "sub/extra": "e", "b.log": "l"})
+
+	_, s := startSync(t, src, dst, Options{
+		Mirror: true,
+		Ignore: ignore.New(src, []string{".git", "*.log"}, false),
+	})
+	fullSync(t, s)
+
+	checkExists(t, dst, map[string]bool{
+		"a.txt":       true,
+		".git/config": true,
+		"b.log":       true,
+		"sub/out/y":   true,
+		"sub/out/x":   false,
+		"sub/extra":   false,
+	})
+}
+
+func TestMirrorKeepsSkippedSymlinks(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "d/f": "f"})
+	if err := os.Symlink("a.txt", filepath.Join(src, "l")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink("d", filepath.Join(src, "ld")); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dst, map[string]string{"l": "old", "ld/f": "f", "gone": "g"})
+
+	_, s := startSync(t, src, dst, Options{Mirror: true, Symlinks: model.SymlinkSkip})
+	fullSync(t, s)
+
+	// 건너뛴 링크 경로는 src에서 지운 것이 아니므로 남김
+	checkExists(t, dst, map[string]bool{
+		"a.txt": true,
+		"l":     true,
+		"ld/f":  true,
+		"gone":  false,
+	})
+}
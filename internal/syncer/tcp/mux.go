@@ -0,0 +1,417 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// 하나의 TLS 연결 위에 여러 스트림을 나눠 보내는 프레임 형식
+// [type 1byte][stream id 4byte][length 4byte][payload]
+const (
+	frameData   byte = 0x00
+	frameWindow byte = 0x01 // payload: 수신 측이 더 받을 수 있는 바이트 수(uint32)
+	frameClose  byte = 0x02
+	frameOpen   byte = 0x03
+
+	frameHeaderSize = 9
+	maxFramePayload = 32 * 1024
+
+	// 스트림마다 읽지 않은 데이터를 이만큼만 받아, 느린 스트림이 다른 스트림을 막지 않도록 함
+	streamWindow = 1024 * 1024
+
+	maxStreams = 256
+)
+
+var ErrSessionClosed = errors.New("session closed")
+
+type session struct {
+	conn   net.Conn
+	client bool
+
+	writeMu sync.Mutex
+	w       *bufio.Writer
+
+	// 스트림을 연 순서대로 서버에 알리도록 Open을 직렬화
+	openMu sync.Mutex
+
+	mu       sync.Mutex
+	streams  map[uint32]*stream
+	nextID   uint32
+	lastID   uint32
+	acceptCh chan *stream
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// newSession r은 핸드셰이크 메시지를 읽던 reader. 이미 읽어둔 프레임이 있을 수 있으므로 이어서 사용
+func newSession(conn net.Conn, r *bufio.Reader, client bool) *session {
+	sess := &session{
+		conn:     conn,
+		client:   client,
+		w:        bufio.NewWriterSize(conn, frameHeaderSize+maxFramePayload),
+		streams:  make(map[uint32]*stream),
+		nextID:   1,
+		acceptCh: make(chan *stream, maxStreams),
+		closed:   make(chan struct{}),
+	}
+
+	go sess.readLoop(r)
+	return sess
+}
+
+// Open 새 스트림을 엶. 스트림은 클라이언트만 열 수 있고, id 순서대로 서버에 알림
+func (sess *session) Open() (*stream, error) {
+	sess.openMu.Lock()
+	defer sess.openMu.Unlock()
+
+	sess.mu.Lock()
+	if sess.isClosed() {
+		sess.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+
+	id := sess.nextID
+	sess.nextID++
+
+	st := newStream(id, sess)
+	sess.streams[id] = st
+	sess.mu.Unlock()
+
+	if err := sess.writeFrame(frameOpen, id, nil); err != nil {
+		sess.remove(id)
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (sess *session) Accept() (*stream, error) {
+	select {
+	case st := <-sess.acceptCh:
+		return st, nil
+	case <-sess.closed:
+		return nil, sess.closeErr()
+	}
+}
+
+func (sess *session) Close() error {
+	sess.closeWithErr(ErrSessionClosed)
+	return nil
+}
+
+func (sess *session) Done() <-chan struct{} {
+	return sess.closed
+}
+
+func (sess *session) isClosed() bool {
+	select {
+	case <-sess.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sess *session) closeErr() error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.err != nil {
+		return sess.err
+	}
+	return ErrSessionClosed
+}
+
+func (sess *session) closeWithErr(err error) {
+	sess.closeOnce.Do(func() {
+		sess.mu.Lock()
+		sess.err = err
+		streams := sess.streams
+		sess.streams = make(map[uint32]*stream)
+		sess.mu.Unlock()
+
+		close(sess.closed)
+		_ = sess.conn.Close()
+
+		for _, st := range streams {
+			st.wake()
+		}
+	})
+}
+
+func (sess *session) writeFrame(typ byte, id uint32, payload []byte) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	if sess.isClosed() {
+		return sess.closeErr()
+	}
+
+	var header [frameHeaderSize]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:5], id)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+
+	if _, err := sess.w.Write(header[:]); err != nil {
+		sess.closeWithErr(err)
+		return err
+	}
+	if _, err := sess.w.Write(payload); err != nil {
+		sess.closeWithErr(err)
+		return err
+	}
+	if err := sess.w.Flush(); err != nil {
+		sess.closeWithErr(err)
+		return err
+	}
+
+	return nil
+}
+
+func (sess *session) readLoop(r *bufio.Reader) {
+	var header [frameHeaderSize]byte
+	payload := make([]byte, maxFramePayload)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			sess.closeWithErr(err)
+			return
+		}
+
+		typ := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		length := binary.BigEndian.Uint32(header[5:9])
+		if length > maxFramePayload {
+			sess.closeWithErr(fmt.Errorf("frame too large: %d bytes", length))
+			return
+		}
+
+		if _, err := io.ReadFull(r, payload[:length]); err != nil {
+			sess.closeWithErr(err)
+			return
+		}
+
+		if err := sess.handleFrame(typ, id, payload[:length]); err != nil {
+			sess.closeWithErr(err)
+			return
+		}
+	}
+}
+
+func (sess *session) handleFrame(typ byte, id uint32, payload []byte) error {
+	switch typ {
+	case frameOpen:
+		return sess.accept(id)
+
+	case frameData:
+		if st := sess.lookup(id); st != nil {
+			return st.push(payload)
+		}
+
+	case frameWindow:
+		if len(payload) != 4 {
+			return fmt.Errorf("invalid window frame")
+		}
+		if st := sess.lookup(id); st != nil {
+			st.grant(binary.BigEndian.Uint32(payload))
+		}
+
+	case frameClose:
+		if st := sess.lookup(id); st != nil {
+			st.remoteClose()
+			sess.remove(id)
+		}
+
+	default:
+		return fmt.Errorf("unknown frame type: %d", typ)
+	}
+
+	return nil
+}
+
+func (sess *session) accept(id uint32) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.client || id <= sess.lastID {
+		return fmt.Errorf("unexpected stream id: %d", id)
+	}
+
+	if len(sess.streams) >= maxStreams {
+		return fmt.Errorf("too many streams")
+	}
+
+	sess.lastID = id
+	st := newStream(id, sess)
+	sess.streams[id] = st
+	sess.acceptCh <- st
+	return nil
+}
+
+func (sess *session) lookup(id uint32) *stream {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	return sess.streams[id]
+}
+
+func (sess *session) remove(id uint32) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	delete(sess.streams, id)
+}
+
+// stream 세션 안의 요청 하나. 기존 한 연결 한 메시지 처리와 같은 방식으로 읽고 씀
+type stream struct {
+	id   uint32
+	sess *session
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	buf        bytes.Buffer
+	sendWindow uint32
+	consumed   uint32
+	remoteDone bool
+	localDone  bool
+}
+
+func newStream(id uint32, sess *session) *stream {
+	st := &stream{
+		id:         id,
+		sess:       sess,
+		sendWindow: streamWindow,
+	}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+func (st *stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for st.buf.Len() == 0 && !st.remoteDone && !st.localDone && !st.sess.isClosed() {
+		st.cond.Wait()
+	}
+
+	if st.buf.Len() == 0 {
+		st.mu.Unlock()
+		if st.sess.isClosed() {
+			return 0, st.sess.closeErr()
+		}
+		return 0, io.EOF
+	}
+
+	n, _ := st.buf.Read(p)
+	st.consumed += uint32(n)
+
+	// 절반 이상 읽었으면 상대에게 그만큼 더 보내도 된다고 알림
+	var update uint32
+	if st.consumed >= streamWindow/2 && !st.remoteDone {
+		update = st.consumed
+		st.consumed = 0
+	}
+	st.mu.Unlock()
+
+	if update > 0 {
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], update)
+		_ = st.sess.writeFrame(frameWindow, st.id, payload[:])
+	}
+
+	return n, nil
+}
+
+func (st *stream) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		st.mu.Lock()
+		for st.sendWindow == 0 && !st.remoteDone && !st.localDone && !st.sess.isClosed() {
+			st.cond.Wait()
+		}
+
+		if st.sess.isClosed() {
+			st.mu.Unlock()
+			return written, st.sess.closeErr()
+		}
+		if st.remoteDone || st.localDone {
+			st.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+
+		n := min(len(p), int(st.sendWindow), maxFramePayload)
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(frameData, st.id, p[:n]); err != nil {
+			return written, err
+		}
+
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// Close 스트림을 양쪽 모두 닫음. 이후 도착하는 프레임은 버려짐
+func (st *stream) Close() error {
+	st.mu.Lock()
+	if st.localDone {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localDone = true
+	remoteDone := st.remoteDone
+	st.mu.Unlock()
+	st.cond.Broadcast()
+
+	st.sess.remove(st.id)
+	if remoteDone {
+		return nil
+	}
+
+	return st.sess.writeFrame(frameClose, st.id, nil)
+}
+
+func (st *stream) push(data []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.localDone {
+		return nil
+	}
+
+	if st.buf.Len()+len(data) > streamWindow {
+		return fmt.Errorf("stream %d exceeded its window", st.id)
+	}
+
+	st.buf.Write(data)
+	st.cond.Broadcast()
+	return nil
+}
+
+func (st *stream) grant(n uint32) {
+	st.mu.Lock()
+	st.sendWindow += n
+	st.mu.Unlock()
+	st.cond.Broadcast()
+}
+
+func (st *stream) remoteClose() {
+	st.mu.Lock()
+	st.remoteDone = true
+	st.mu.Unlock()
+	st.cond.Broadcast()
+}
+
+func (st *stream) wake() {
+	st.cond.Broadcast()
+}
@@ -0,0 +1,278 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"synco/internal/model"
+	"testing"
+	"time"
+)
+
+// sessionPair 메모리 위의 연결로 클라이언트와 서버 세션을 만듦
+func sessionPair(t *testing.T) (client, server *session) {
+	t.Helper()
+
+	c, s := net.Pipe()
+	client = newSession(c, bufio.NewReader(c), true)
+	server = newSession(s, bufio.NewReader(s), false)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	return client, server
+}
+
+// echoStreams 받은 size 바이트를 그대로 돌려보내는 서버
+func echoStreams(server *session, size int64) {
+	for {
+		st, err := server.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			_, _ = io.CopyN(st, st, size)
+		}()
+	}
+}
+
+func TestSessionStreamsRoundTrip(t *testing.T) {
+	const (
+		streams = 16
+		// 창보다 크게 보내 흐름 제어를 거치게 함
+		size = 3 * streamWindow
+	)
+
+	client, server := sessionPair(t)
+	go echoStreams(server, size)
+
+	var wg sync.WaitGroup
+	for range streams {
+		data := randomBytes(t, size)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			st, err := client.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer st.Close()
+
+			go func() {
+				_, _ = st.Write(data)
+			}()
+
+			got := make([]byte, size)
+			if _, err := io.ReadFull(st, got); err != nil {
+				t.Errorf("stream %d: %v", st.id, err)
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("stream %d: echoed data differs", st.id)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessionSlowStreamDoesNotBlockOthers(t *testing.T) {
+	client, server := sessionPair(t)
+
+	slow, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Accept(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 서버가 읽지 않는 스트림에 창을 넘겨 보내면 쓰기가 멈춤
+	go func() {
+		_, _ = slow.Write(make([]byte, 2*streamWindow))
+	}()
+
+	go echoStreams(server, 5)
+
+	done := make(chan error, 1)
+	go func() {
+		st, err := client.Open()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer st.Close()
+
+		if _, err := st.Write([]byte("hello")); err != nil {
+			done <- err
+			return
+		}
+		got := make([]byte, 5)
+		_, err = io.ReadFull(st, got)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was blocked by a stream that is not being read")
+	}
+}
+
+func TestSessionClosesOnInvalidFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame func() []byte
+	}{
+		{"frame larger than the limit", func() []byte {
+			header := make([]byte, frameHeaderSize)
+			header[0] = frameData
+			binary.BigEndian.PutUint32(header[5:9], maxFramePayload+1)
+			return header
+		}},
+		{"unknown frame type", func() []byte {
+			header := make([]byte, frameHeaderSize)
+			header[0] = 0x7f
+			return header
+		}},
+		{"stream id reused", func() []byte {
+			var buf bytes.Buffer
+			for range 2 {
+				header := make([]byte, frameHeaderSize)
+				header[0] = frameOpen
+				binary.BigEndian.PutUint32(header[1:5], 1)
+				buf.Write(header)
+			}
+			return buf.Bytes()
+		}},
+	}
+
+	for _, tt := range tests {
+		c, s := net.Pipe()
+		server := newSession(s, bufio.NewReader(s), false)
+
+		go func() {
+			_, _ = c.Write(tt.frame())
+		}()
+
+		select {
+		case <-server.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: session stayed open", tt.name)
+		}
+
+		_ = c.Close()
+		_ = server.Close()
+	}
+}
+
+func TestStreamReadFailsAfterSessionClose(t *testing.T) {
+	client, _ := sessionPair(t)
+
+	st, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := st.Read(make([]byte, 1))
+		errCh <- err
+	}()
+
+	_ = client.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("read succeeded on a closed session")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read was not woken by the session closing")
+	}
+
+	if _, err := client.Open(); err == nil {
+		t.Error("stream was opened on a closed session")
+	}
+}
+
+func TestSyncerKeepsOneSessionAndReconnects(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for i := range 200 {
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprintf("%03d.txt", i)), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	initDB(t)
+	trust := trustStore{}
+	serverID := newIdentity(t, trust)
+
+	// 테스트 안에서 멈추므로 startSync를 쓰지 않음
+	srv, err := NewServer(dst, "127.0.0.1:0", serverID, model.StrategyNewerWins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.listener.Addr().String()
+
+	s, err := NewSyncer(src, addr, newIdentity(t, trust), Options{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	fullSync(t, s)
+
+	srv.mu.Lock()
+	sessions := len(srv.sessions)
+	srv.mu.Unlock()
+	if sessions != 1 {
+		t.Errorf("full sync used %d sessions, want 1", sessions)
+	}
+
+	// 서버가 다시 시작되면 다음 이벤트에서 새 세션을 엶
+	srv.Stop()
+	restarted, err := NewServer(dst, addr, serverID, model.StrategyNewerWins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(restarted.Stop)
+
+	path := filepath.Join(src, "new.txt")
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan model.FileEvent, 1)
+	out := s.Run(in)
+	in <- model.FileEvent{Type: model.EventWrite, Path: path}
+	close(in)
+
+	for result := range out {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "new.txt")); err != nil || string(data) != "new" {
+		t.Errorf("new.txt = %q, %v after reconnecting", data, err)
+	}
+}
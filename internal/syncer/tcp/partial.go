@@ -0,0 +1,132 @@
+package tcp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"synco/internal/logger"
+	"synco/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// 이보다 큰 파일은 전송 전에 이어받을 위치를 조회
+const ResumeThreshold = 1024 * 1024 // 1MB
+
+const partialSuffix = ".part.tmp"
+
+// 경로 + 체크섬별로 부분 업로드를 보관하여, 같은 내용을 다시 보낼 때만 이어받음
+func partialPath(dstPath string, checksum []byte) string {
+	return fmt.Sprintf("%s.synco-%s%s", dstPath, hex.EncodeToString(checksum[:8]), partialSuffix)
+}
+
+func committedOffset(dstPath string, checksum []byte, size int64) int64 {
+	info, err := os.Stat(partialPath(dstPath, checksum))
+	if err != nil || info.Size() > size {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// openPartial offset 이후를 잘라낸 부분 파일과, 앞부분을 미리 넣어둔 해시를 반환
+func openPartial(path string, offset int64) (*os.File, hash.Hash, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create parent dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open partial file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to stat partial file: %w", err)
+	}
+
+	if info.Size() < offset {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("partial file has %d bytes, cannot resume at %d", info.Size(), offset)
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.LimitReader(f, offset)); err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to hash partial file: %w", err)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to seek partial file: %w", err)
+	}
+
+	return f, h, nil
+}
+
+// receivePartial body의 내용을 부분 파일에 이어 쓰고, 완료되면 파일 속성을 적용하여 dstPath로 rename.
+// 연결이 끊기면 부분 파일을 남겨두어 다음 시도에서 이어받을 수 있게 함
+func receivePartial(dstPath string, msg Message, body func(h hash.Hash) io.Reader) error {
+	part := partialPath(dstPath, msg.Checksum)
+
+	f, h, err := openPartial(part, msg.Offset)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, body(h))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		// 내용이 잘못된 경우에는 이어받으면 안 되므로 삭제
+		if errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrSizeMismatch) {
+			_ = os.Remove(part)
+		}
+
+		return fmt.Errorf("failed to write: %w", err)
+	}
+
+	if err := util.ReplaceFile(part, dstPath, msg.meta()); err != nil {
+		return err
+	}
+
+	removeStalePartials(dstPath)
+	return nil
+}
+
+// 전송 도중 원본이 바뀌어 다른 체크섬으로 남은 부분 파일 정리
+func removeStalePartials(dstPath string) {
+	dir, base := filepath.Split(dstPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	prefix := base + ".synco-"
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, partialSuffix) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			logger.Log.Debug("failed to remove stale partial",
+				zap.String("path", name),
+				zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package tcp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFullSyncResumesFromPartial(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	data := randomBytes(t, 3*ResumeThreshold+5)
+	path := filepath.Join(src, "big.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 앞선 시도에서 받다 만 부분 파일과, 원본이 바뀌기 전에 받던 부분 파일
+	if err := os.WriteFile(partialPath(filepath.Join(dst, "big.bin"), sum), data[:ResumeThreshold+1234], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partialPath(filepath.Join(dst, "big.bin"), make([]byte, 8)), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s := startSync(t, src, dst, Options{})
+	results := fullSync(t, s)
+
+	got, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("resumed file differs from the source")
+	}
+	if len(results) != 1 || results[0].WireBytes >= int64(len(data)-ResumeThreshold) {
+		t.Errorf("got %+v, want only the rest after the partial sent", results)
+	}
+
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("partial files were left behind: %v", entries)
+	}
+}
+
+func TestFullSyncDiscardsCorruptedPartial(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	data := randomBytes(t, 2*ResumeThreshold)
+	path := filepath.Join(src, "big.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := FileChecksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := bytes.Clone(data[:ResumeThreshold+1])
+	corrupted[5] ^= 0xff
+	part := partialPath(filepath.Join(dst, "big.bin"), sum)
+	if err := os.WriteFile(part, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s := startSync(t, src, dst, Options{})
+
+	// 이어받은 내용의 체크섬이 맞지 않으면 부분 파일을 지우고, 다시 보낼 때 처음부터 받음
+	fullSync(t, s)
+
+	got, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("file differs from the source after the retry")
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf("corrupted partial was kept: %v", err)
+	}
+}
+
+func TestCommittedOffset(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "a.bin")
+	sum := make([]byte, 32)
+
+	if got := committedOffset(dst, sum, 100); got != 0 {
+		t.Errorf("offset without a partial = %d, want 0", got)
+	}
+
+	if err := os.WriteFile(partialPath(dst, sum), make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := committedOffset(dst, sum, 100); got != 40 {
+		t.Errorf("offset = %d, want 40", got)
+	}
+	// 부분 파일이 보낼 파일보다 크면 처음부터 받음
+	if got := committedOffset(dst, sum, 10); got != 0 {
+		t.Errorf("offset past the size = %d, want 0", got)
+	}
+}
+
+func TestReadMessageRejectsInvalidOffset(t *testing.T) {
+	for _, offset := range []int64{-1, 11} {
+		var buf bytes.Buffer
+		err := WriteMessage(&buf, Message{
+			Type:     MessageOffset,
+			Path:     "a.bin",
+			ModTime:  time.Now(),
+			Checksum: make([]byte, 32),
+			Size:     10,
+			Offset:   offset,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReadMessage(&buf); err == nil {
+			t.Errorf("offset %d of a 10 byte file was accepted", offset)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package tcp
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"synco/internal/util"
 	"time"
 )
 
@@ -15,34 +19,137 @@ const (
 	MessageSync   MessageType = 0x01
 	MessageDelete MessageType = 0x02
 	MessagePing   MessageType = 0x03
+	MessageDelta  MessageType = 0x04
+	MessageOffset MessageType = 0x05
+	// 전체 동기화 시 src 목록을 보내고 서버가 필요한 파일과 남는 파일을 응답
+	MessageManifest MessageType = 0x06
+	// 연결을 세션으로 전환. 메시지 뒤에 Hello가 오고, 이후 메시지는 세션의 스트림마다 하나씩 오감
+	MessageSession MessageType = 0x07
+	// 서버에 있는 OldPath의 파일을 Path로 옮김. 서버의 내용이 Checksum과 다르면 내용을 보내야 함
+	MessageRename MessageType = 0x08
+	// 디렉터리를 만들거나, 그 아래까지 지우거나, OldPath의 디렉터리를 Path로 옮김
+	MessageMkdir     MessageType = 0x09
+	MessageRemoveDir MessageType = 0x0A
+	MessageRenameDir MessageType = 0x0B
+	// Path에 Target을 가리키는 심볼릭 링크를 만듦. Checksum은 받는 쪽에서 Target으로 계산
+	MessageSymlink MessageType = 0x0C
 )
 
+// 내용을 보내는 메시지 종류의 최상위 비트가 켜져 있으면 Offset 뒤에 파일 속성이 옴
+const metaFlag MessageType = 0x80
+
+// 디렉터리를 지우거나 옮기는 메시지에 0x40 비트가 켜져 있으면 OldPath 뒤에 그 아래 파일의 벡터가 옴
+const vectorsFlag MessageType = 0x40
+
+func (t MessageType) hasContent() bool {
+	return t == MessageSync || t == MessageDelta || t == MessageOffset
+}
+
+func (t MessageType) isDirChange() bool {
+	return t == MessageRemoveDir || t == MessageRenameDir
+}
+
+func (t MessageType) hasOldPath() bool {
+	return t == MessageRename || t == MessageRenameDir
+}
+
 type ResponseCode byte
 
 const (
-	ResponseOK   ResponseCode = 0x00
-	ResponseErr  ResponseCode = 0x01
-	ResponseSkip ResponseCode = 0x02
+	ResponseOK    ResponseCode = 0x00
+	ResponseErr   ResponseCode = 0x01
+	ResponseSkip  ResponseCode = 0x02
+	ResponseReady ResponseCode = 0x03
+	// 경로가 대상 디렉터리를 벗어나는 등 안전하지 않아 거부됨. 재시도해도 결과가 같음
+	ResponseRejected ResponseCode = 0x04
+	// 세션 핸드셰이크에서 프로토콜 버전이 맞지 않음
+	ResponseIncompatible ResponseCode = 0x05
+	// 이동할 파일이 서버에 없거나 내용이 달라 옮기지 못함. 새 경로의 내용을 보내야 함
+	ResponseNeedContent ResponseCode = 0x06
 )
 
+const (
+	ChunkSize    = 256 * 1024      // 256KB
+	MaxChunkSize = 4 * 1024 * 1024 // 4MB
+
+	maxStringLen = 64 * 1024
+	maxClockLen  = 4096
+	maxXattrs    = 256
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrSizeMismatch     = errors.New("size mismatch")
+)
+
+// Message MessageRename에서 VClock은 새 경로, OldVClock은 이전 경로의 version vector.
+// Mode가 0이 아니면 내용과 함께 권한, 소유자, 확장 속성을 보냄. Target은 MessageSymlink에서만 씀.
+// Vectors는 디렉터리를 지우거나 옮길 때 보내는 쪽이 아는 그 아래 파일의 벡터로, 키는 디렉터리 기준 상대 경로.
+// nil이면 벡터를 보내지 않는 이전 버전
 type Message struct {
-	Type     MessageType
-	OriginID string
-	VClock   map[string]uint64
-	Path     string
-	ModTime  time.Time
-	Checksum []byte
-	Data     []byte
+	Type      MessageType
+	OriginID  string
+	VClock    map[string]uint64
+	Path      string
+	OldPath   string
+	OldVClock map[string]uint64
+	ModTime   time.Time
+	Checksum  []byte
+	Size      int64
+	Offset    int64
+	Mode      os.FileMode
+	Owner     *util.Owner
+	Xattrs    map[string][]byte
+	Target    string
+	Vectors   map[string]map[string]uint64
+}
+
+// meta 받은 내용에 적용할 파일 속성
+func (m Message) meta() util.FileMeta {
+	return util.FileMeta{
+		ModTime: m.ModTime,
+		Mode:    m.Mode,
+		Owner:   m.Owner,
+		Xattrs:  m.Xattrs,
+	}
+}
+
+func (m Message) hasMeta() bool {
+	return m.Type.hasContent() && m.Mode != 0
+}
+
+func (m Message) hasVectors() bool {
+	return m.Type.isDirChange() && m.Vectors != nil
 }
 
 type Response struct {
 	Code   ResponseCode
 	Msg    string
 	VClock map[string]uint64
+	Offset int64
 }
 
+// WriteMessage 세션에서 프레임 하나로 나가도록 모아서 한 번에 씀
 func WriteMessage(w io.Writer, msg Message) error {
-	if _, err := w.Write([]byte{byte(msg.Type)}); err != nil {
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, msg); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeMessage(w io.Writer, msg Message) error {
+	msgType := msg.Type
+	if msg.hasMeta() {
+		msgType |= metaFlag
+	}
+	if msg.hasVectors() {
+		msgType |= vectorsFlag
+	}
+
+	if _, err := w.Write([]byte{byte(msgType)}); err != nil {
 		return err
 	}
 
@@ -50,24 +157,37 @@ func WriteMessage(w io.Writer, msg Message) error {
 		return err
 	}
 
-	if err := binary.Write(w, binary.BigEndian, uint32(len(msg.VClock))); err != nil {
+	if err := writeClock(w, msg.VClock); err != nil {
 		return err
 	}
-	for k, v := range msg.VClock {
-		if err := writeString(w, k); err != nil {
+
+	if err := writeString(w, msg.Path); err != nil {
+		return err
+	}
+
+	if msg.Type.hasOldPath() {
+		if err := writeString(w, msg.OldPath); err != nil {
 			return err
 		}
+	}
 
-		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+	if msg.hasVectors() {
+		if err := writeVectors(w, msg.Vectors); err != nil {
 			return err
 		}
 	}
 
-	if err := writeString(w, msg.Path); err != nil {
-		return err
+	if msg.Type == MessageRename {
+		if err := writeClock(w, msg.OldVClock); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(msg.Checksum); err != nil {
+			return err
+		}
 	}
 
-	if msg.Type == MessageSync {
+	if msg.Type.hasContent() {
 		if err := binary.Write(w, binary.BigEndian, msg.ModTime.UnixNano()); err != nil {
 			return err
 		}
@@ -76,10 +196,44 @@ func WriteMessage(w io.Writer, msg Message) error {
 			return err
 		}
 
-		if err := binary.Write(w, binary.BigEndian, uint64(len(msg.Data))); err != nil {
+		if err := binary.Write(w, binary.BigEndian, msg.Size); err != nil {
 			return err
 		}
-		if _, err := w.Write(msg.Data); err != nil {
+
+		if err := binary.Write(w, binary.BigEndian, msg.Offset); err != nil {
+			return err
+		}
+	}
+
+	if msg.Type == MessageSymlink {
+		if err := writeString(w, msg.Target); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, msg.ModTime.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	if msg.hasMeta() {
+		return writeMeta(w, msg)
+	}
+
+	return nil
+}
+
+// writeVectors [uint32 개수][경로, 벡터]...
+func writeVectors(w io.Writer, vectors map[string]map[string]uint64) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(vectors))); err != nil {
+		return err
+	}
+
+	for path, vector := range vectors {
+		if err := writeString(w, path); err != nil {
+			return err
+		}
+
+		if err := writeClock(w, vector); err != nil {
 			return err
 		}
 	}
@@ -87,6 +241,110 @@ func WriteMessage(w io.Writer, msg Message) error {
 	return nil
 }
 
+func readVectors(r io.Reader) (map[string]map[string]uint64, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	if count > maxManifestEntries {
+		return nil, fmt.Errorf("too many vectors: %d", count)
+	}
+
+	vectors := make(map[string]map[string]uint64, count)
+	for range count {
+		path, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if vectors[path], err = readClock(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return vectors, nil
+}
+
+// writeMeta [uint32 mode][uint8 소유자 유무][uint32 uid][uint32 gid][uint32 개수][이름, 값]...
+func writeMeta(w io.Writer, msg Message) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(msg.Mode)); err != nil {
+		return err
+	}
+
+	var owner [9]byte
+	if msg.Owner != nil {
+		owner[0] = 1
+		binary.BigEndian.PutUint32(owner[1:5], uint32(msg.Owner.UID))
+		binary.BigEndian.PutUint32(owner[5:], uint32(msg.Owner.GID))
+	}
+	if _, err := w.Write(owner[:]); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(msg.Xattrs))); err != nil {
+		return err
+	}
+
+	for name, value := range msg.Xattrs {
+		if err := writeString(w, name); err != nil {
+			return err
+		}
+
+		if err := writeString(w, string(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readMeta(r io.Reader, msg *Message) error {
+	var mode uint32
+	if err := binary.Read(r, binary.BigEndian, &mode); err != nil {
+		return err
+	}
+	msg.Mode = os.FileMode(mode)
+
+	var owner [9]byte
+	if _, err := io.ReadFull(r, owner[:]); err != nil {
+		return err
+	}
+	if owner[0] != 0 {
+		msg.Owner = &util.Owner{
+			UID: int(binary.BigEndian.Uint32(owner[1:5])),
+			GID: int(binary.BigEndian.Uint32(owner[5:])),
+		}
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if count > maxXattrs {
+		return fmt.Errorf("too many xattrs: %d", count)
+	}
+
+	if count > 0 {
+		msg.Xattrs = make(map[string][]byte, count)
+	}
+
+	for range count {
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		value, err := readString(r)
+		if err != nil {
+			return err
+		}
+
+		msg.Xattrs[name] = []byte(value)
+	}
+
+	return nil
+}
+
 func ReadMessage(r io.Reader) (Message, error) {
 	var msg Message
 
@@ -94,7 +352,15 @@ func ReadMessage(r io.Reader) (Message, error) {
 	if _, err := io.ReadFull(r, typeBuf); err != nil {
 		return msg, err
 	}
-	msg.Type = MessageType(typeBuf[0])
+	msg.Type = MessageType(typeBuf[0]) &^ (metaFlag | vectorsFlag)
+	hasMeta := MessageType(typeBuf[0])&metaFlag != 0
+	if hasMeta && !msg.Type.hasContent() {
+		return msg, fmt.Errorf("unexpected metadata for message type: %d", msg.Type)
+	}
+	hasVectors := MessageType(typeBuf[0])&vectorsFlag != 0
+	if hasVectors && !msg.Type.isDirChange() {
+		return msg, fmt.Errorf("unexpected vectors for message type: %d", msg.Type)
+	}
 
 	originID, err := readString(r)
 	if err != nil {
@@ -102,31 +368,40 @@ func ReadMessage(r io.Reader) (Message, error) {
 	}
 	msg.OriginID = originID
 
-	var clockLen uint32
-	if err := binary.Read(r, binary.BigEndian, &clockLen); err != nil {
+	msg.VClock, err = readClock(r)
+	if err != nil {
 		return msg, err
 	}
-	msg.VClock = make(map[string]uint64, clockLen)
-	for range clockLen {
-		k, err := readString(r)
-		if err != nil {
+
+	msg.Path, err = readString(r)
+	if err != nil {
+		return msg, err
+	}
+
+	if msg.Type.hasOldPath() {
+		if msg.OldPath, err = readString(r); err != nil {
 			return msg, err
 		}
+	}
 
-		var v uint64
-		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+	if hasVectors {
+		if msg.Vectors, err = readVectors(r); err != nil {
 			return msg, err
 		}
-
-		msg.VClock[k] = v
 	}
 
-	msg.Path, err = readString(r)
-	if err != nil {
-		return msg, err
+	if msg.Type == MessageRename {
+		if msg.OldVClock, err = readClock(r); err != nil {
+			return msg, err
+		}
+
+		msg.Checksum = make([]byte, 32)
+		if _, err := io.ReadFull(r, msg.Checksum); err != nil {
+			return msg, err
+		}
 	}
 
-	if msg.Type == MessageSync {
+	if msg.Type.hasContent() {
 		var modTimeNano int64
 		if err := binary.Read(r, binary.BigEndian, &modTimeNano); err != nil {
 			return msg, err
@@ -138,12 +413,42 @@ func ReadMessage(r io.Reader) (Message, error) {
 			return msg, err
 		}
 
-		var dataLen uint64
-		if err := binary.Read(r, binary.BigEndian, &dataLen); err != nil {
+		if err := binary.Read(r, binary.BigEndian, &msg.Size); err != nil {
 			return msg, err
 		}
-		msg.Data = make([]byte, dataLen)
-		if _, err := io.ReadFull(r, msg.Data); err != nil {
+		if msg.Size < 0 {
+			return msg, fmt.Errorf("invalid size: %d", msg.Size)
+		}
+
+		if err := binary.Read(r, binary.BigEndian, &msg.Offset); err != nil {
+			return msg, err
+		}
+		if msg.Offset < 0 || msg.Offset > msg.Size {
+			return msg, fmt.Errorf("invalid offset: %d", msg.Offset)
+		}
+	}
+
+	if msg.Type == MessageSymlink {
+		if msg.Target, err = readString(r); err != nil {
+			return msg, err
+		}
+		if msg.Target == "" {
+			return msg, fmt.Errorf("empty symlink target")
+		}
+		if err := util.CheckLinkTarget(msg.Path, msg.Target); err != nil {
+			return msg, err
+		}
+
+		var modTimeNano int64
+		if err := binary.Read(r, binary.BigEndian, &modTimeNano); err != nil {
+			return msg, err
+		}
+		msg.ModTime = time.Unix(0, modTimeNano)
+		msg.Checksum = util.LinkChecksum(msg.Target)
+	}
+
+	if hasMeta {
+		if err := readMeta(r, &msg); err != nil {
 			return msg, err
 		}
 	}
@@ -152,28 +457,29 @@ func ReadMessage(r io.Reader) (Message, error) {
 }
 
 func WriteResponse(w io.Writer, resp Response) error {
-	if _, err := w.Write([]byte{byte(resp.Code)}); err != nil {
+	var buf bytes.Buffer
+	if err := writeResponse(&buf, resp); err != nil {
 		return err
 	}
 
-	if err := writeString(w, resp.Msg); err != nil {
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeResponse(w io.Writer, resp Response) error {
+	if _, err := w.Write([]byte{byte(resp.Code)}); err != nil {
 		return err
 	}
 
-	if err := binary.Write(w, binary.BigEndian, uint32(len(resp.VClock))); err != nil {
+	if err := writeString(w, resp.Msg); err != nil {
 		return err
 	}
-	for k, v := range resp.VClock {
-		if err := writeString(w, k); err != nil {
-			return err
-		}
 
-		if err := binary.Write(w, binary.BigEndian, v); err != nil {
-			return err
-		}
+	if err := writeClock(w, resp.VClock); err != nil {
+		return err
 	}
 
-	return nil
+	return binary.Write(w, binary.BigEndian, resp.Offset)
 }
 
 func ReadResponse(r io.Reader) (Response, error) {
@@ -191,26 +497,61 @@ func ReadResponse(r io.Reader) (Response, error) {
 	}
 	resp.Msg = msg
 
+	resp.VClock, err = readClock(r)
+	if err != nil {
+		return resp, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &resp.Offset); err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+func writeClock(w io.Writer, clock map[string]uint64) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(clock))); err != nil {
+		return err
+	}
+
+	for k, v := range clock {
+		if err := writeString(w, k); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readClock(r io.Reader) (map[string]uint64, error) {
 	var clockLen uint32
 	if err := binary.Read(r, binary.BigEndian, &clockLen); err != nil {
-		return resp, err
+		return nil, err
 	}
-	resp.VClock = make(map[string]uint64, clockLen)
+	if clockLen > maxClockLen {
+		return nil, fmt.Errorf("vector clock too large: %d entries", clockLen)
+	}
+
+	clock := make(map[string]uint64, clockLen)
 	for range clockLen {
 		k, err := readString(r)
 		if err != nil {
-			return resp, err
+			return nil, err
 		}
 
 		var v uint64
 		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
-			return resp, err
+			return nil, err
 		}
 
-		resp.VClock[k] = v
+		clock[k] = v
 	}
 
-	return resp, nil
+	return clock, nil
 }
 
 func writeString(w io.Writer, s string) error {
@@ -229,6 +570,10 @@ func readString(r io.Reader) (string, error) {
 		return "", err
 	}
 
+	if length > maxStringLen {
+		return "", fmt.Errorf("string too long: %d bytes", length)
+	}
+
 	b := make([]byte, length)
 	if _, err := io.ReadFull(r, b); err != nil {
 		return "", err
@@ -237,6 +582,172 @@ func readString(r io.Reader) (string, error) {
 	return string(b), nil
 }
 
+// WriteChunks r의 내용을 [uint32 길이][데이터] 청크로 나눠 전송하고,
+// 길이 0 청크 뒤에 전체 내용의 SHA-256을 붙임
+func WriteChunks(w io.Writer, r io.Reader) ([]byte, error) {
+	return writeChunks(w, r, sha256.New(), nil)
+}
+
+// 이어받기 시에는 이미 전송된 앞부분을 h에 먼저 넣어 트레일러가 파일 전체의 체크섬이 되도록 함.
+// comp가 있으면 줄어드는 청크만 압축하여 길이에 compressedFlag를 붙임
+func writeChunks(w io.Writer, r io.Reader, h hash.Hash, comp *compressor) ([]byte, error) {
+	buf := make([]byte, ChunkSize)
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			data, length := buf[:n], uint32(n)
+			if comp != nil {
+				if compressed, ok := comp.compress(data); ok {
+					data, length = compressed, uint32(len(compressed))|compressedFlag
+				}
+			}
+
+			if err := binary.Write(w, binary.BigEndian, length); err != nil {
+				return nil, err
+			}
+
+			if _, err := w.Write(data); err != nil {
+				return nil, err
+			}
+
+			h.Write(buf[:n])
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint32(0)); err != nil {
+		return nil, err
+	}
+
+	sum := h.Sum(nil)
+	if _, err := w.Write(sum); err != nil {
+		return nil, err
+	}
+
+	return sum, nil
+}
+
+type chunkReader struct {
+	r         io.Reader
+	h         hash.Hash
+	size      int64
+	read      int64
+	remaining uint32
+	pending   []byte
+	done      bool
+}
+
+// NewChunkReader WriteChunks로 전송된 스트림을 읽는 io.Reader를 반환.
+// 마지막 청크까지 읽은 후 크기와 체크섬이 맞지 않으면 EOF 대신 에러를 반환함
+func NewChunkReader(r io.Reader, size int64) io.Reader {
+	return newChunkReader(r, sha256.New(), size)
+}
+
+func newChunkReader(r io.Reader, h hash.Hash, size int64) io.Reader {
+	return &chunkReader{
+		r:    r,
+		h:    h,
+		size: size,
+	}
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	if c.remaining == 0 {
+		var length uint32
+		if err := binary.Read(c.r, binary.BigEndian, &length); err != nil {
+			return 0, err
+		}
+
+		if length == 0 {
+			return 0, c.finish()
+		}
+
+		if length&compressedFlag != 0 {
+			return c.readCompressed(p, length&^compressedFlag)
+		}
+
+		if length > MaxChunkSize {
+			return 0, fmt.Errorf("chunk too large: %d bytes", length)
+		}
+
+		if c.read+int64(length) > c.size {
+			return 0, ErrSizeMismatch
+		}
+
+		c.remaining = length
+	}
+
+	if uint32(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	c.read += int64(n)
+	c.remaining -= uint32(n)
+
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// readCompressed 압축된 청크를 풀어 체크섬에 반영하고, p에 들어가지 않는 나머지는 다음 Read에서 반환
+func (c *chunkReader) readCompressed(p []byte, length uint32) (int, error) {
+	data, err := readCompressed(c.r, length)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.read+int64(len(data)) > c.size {
+		return 0, ErrSizeMismatch
+	}
+
+	c.h.Write(data)
+	c.read += int64(len(data))
+
+	n := copy(p, data)
+	c.pending = data[n:]
+	return n, nil
+}
+
+func (c *chunkReader) finish() error {
+	c.done = true
+
+	expected := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(c.r, expected); err != nil {
+		return err
+	}
+
+	if c.read != c.size {
+		return ErrSizeMismatch
+	}
+
+	if !ChecksumEqual(c.h.Sum(nil), expected) {
+		return ErrChecksumMismatch
+	}
+
+	return io.EOF
+}
+
 func FileChecksum(path string) ([]byte, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -278,12 +789,3 @@ func IsRemote(dst string) bool {
 
 	return false
 }
-
-func ValidateChecksum(data, expected []byte) error {
-	h := sha256.Sum256(data)
-	if !ChecksumEqual(h[:], expected) {
-		return fmt.Errorf("checksum mismatch")
-	}
-
-	return nil
-}
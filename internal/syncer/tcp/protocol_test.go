@@ -0,0 +1,109 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunksRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, ChunkSize, 3*ChunkSize + 123} {
+		data := randomBytes(t, size)
+
+		var stream bytes.Buffer
+		if _, err := WriteChunks(&stream, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := io.ReadAll(NewChunkReader(&stream, int64(size)))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: content differs after the round trip", size)
+		}
+	}
+}
+
+func TestChunkReaderRejectsInvalidStream(t *testing.T) {
+	data := randomBytes(t, 2*ChunkSize)
+
+	var valid bytes.Buffer
+	if _, err := WriteChunks(&valid, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := bytes.Clone(valid.Bytes())
+	corrupted[10] ^= 0xff
+
+	var oversized bytes.Buffer
+	_ = binary.Write(&oversized, binary.BigEndian, uint32(MaxChunkSize+1))
+
+	tests := []struct {
+		name   string
+		stream []byte
+		size   int64
+		want   error
+	}{
+		{"corrupted content", corrupted, int64(len(data)), ErrChecksumMismatch},
+		{"more content than announced", valid.Bytes(), int64(len(data)) - 1, ErrSizeMismatch},
+		{"less content than announced", valid.Bytes(), int64(len(data)) + 1, ErrSizeMismatch},
+		{"truncated stream", valid.Bytes()[:ChunkSize], int64(len(data)), io.ErrUnexpectedEOF},
+		{"chunk larger than the limit", oversized.Bytes(), MaxChunkSize + 1, nil},
+	}
+
+	for _, tt := range tests {
+		_, err := io.ReadAll(NewChunkReader(bytes.NewReader(tt.stream), tt.size))
+		if err == nil {
+			t.Errorf("%s: stream was accepted", tt.name)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReadMessageRejectsInvalidHeader(t *testing.T) {
+	write := func(msg Message) []byte {
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	content := func(size int64) Message {
+		return Message{Type: MessageSync, Path: "a.txt", ModTime: time.Now(), Checksum: make([]byte, 32), Size: size}
+	}
+
+	var longString bytes.Buffer
+	longString.WriteByte(byte(MessageDelete))
+	_ = binary.Write(&longString, binary.BigEndian, uint32(maxStringLen+1))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"negative size", write(content(-1))},
+		{"string longer than the limit", longString.Bytes()},
+		{"truncated path", write(Message{Type: MessageDelete, Path: strings.Repeat("a", 100)})[:50]},
+	}
+
+	for _, tt := range tests {
+		if _, err := ReadMessage(bytes.NewReader(tt.data)); err == nil {
+			t.Errorf("%s: message was accepted", tt.name)
+		}
+	}
+
+	msg, err := ReadMessage(bytes.NewReader(write(content(10))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Size != 10 || msg.Path != "a.txt" {
+		t.Errorf("got %+v", msg)
+	}
+}
@@ -2,15 +2,23 @@ package tcp
 
 import (
 	"bufio"
-	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"synco/internal/ignore"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/peer"
 	"synco/internal/syncer/conflict"
 	"synco/internal/util"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -18,14 +26,19 @@ import (
 type Server struct {
 	dst      string
 	addr     string
-	nodeID   string
-	vc       *Vclock
+	id       *peer.Identity
+	versions *versions
 	resolver *conflict.Resolver
+	applied  func(path string, checksum []byte)
+	owner    bool
 	listener net.Listener
 	doneCh   chan struct{}
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
 }
 
-func NewServer(dst, addr, nodeID string, strategy model.ConflictStrategy) (*Server, error) {
+func NewServer(dst, addr string, id *peer.Identity, strategy model.ConflictStrategy) (*Server, error) {
 	absDst, err := filepath.Abs(dst)
 	if err != nil {
 		return nil, fmt.Errorf("invalid dst path: %w", err)
@@ -38,10 +51,11 @@ func NewServer(dst, addr, nodeID string, strategy model.ConflictStrategy) (*Serv
 	return &Server{
 		dst:      absDst,
 		addr:     addr,
-		nodeID:   nodeID,
-		vc:       NewVclock(),
+		id:       id,
+		versions: newVersions(),
 		resolver: conflict.NewResolver(strategy),
 		doneCh:   make(chan struct{}),
+		sessions: make(map[*session]struct{}),
 	}, nil
 }
 
@@ -51,7 +65,7 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
 	}
 
-	s.listener = ln
+	s.listener = tls.NewListener(ln, s.id.ServerTLSConfig())
 
 	logger.Log.Info("tcp server started",
 		zap.String("addr", s.addr),
@@ -66,6 +80,23 @@ func (s *Server) Stop() {
 	if s.listener != nil {
 		_ = s.listener.Close()
 	}
+
+	// 세션은 job이 멈춰도 계속 열려 있으므로 함께 닫음
+	s.mu.Lock()
+	for sess := range s.sessions {
+		_ = sess.Close()
+	}
+	s.mu.Unlock()
+}
+
+// OnApplied 받은 내용을 기록하거나 삭제한 뒤 호출할 함수. 삭제한 경우와 디렉터리는 checksum이 nil
+func (s *Server) OnApplied(fn func(path string, checksum []byte)) {
+	s.applied = fn
+}
+
+// PreserveOwner 켜면 받은 소유자, setuid/setgid 비트와 user 확장 속성을 적용. Start 전에 호출
+func (s *Server) PreserveOwner(on bool) {
+	s.owner = on
 }
 
 func (s *Server) Port() int {
@@ -94,115 +125,1100 @@ func (s *Server) handleConn(conn net.Conn) {
 		_ = conn.Close()
 	}(conn)
 
+	// 핸드셰이크에서 trust store 검증이 끝나야 메시지를 읽음
+	tlsConn := conn.(*tls.Conn)
+	_ = tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		logger.Log.Warn("tls handshake failed",
+			zap.String("remote", conn.RemoteAddr().String()),
+			zap.Error(err))
+		return
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	peerID, _ := peer.NodeIDFromState(tlsConn.ConnectionState())
+
 	reader := bufio.NewReader(conn)
 	msg, err := ReadMessage(reader)
 	if err != nil {
 		logger.Log.Error("failed to read message", zap.Error(err))
-		_ = WriteResponse(conn, Response{
-			Code: ResponseErr,
-			Msg:  err.Error(),
-		})
+		s.replyErr(conn, err)
+		return
+	}
+
+	if msg.Type != MessageSession {
+		// 세션을 열지 않은 클라이언트는 연결마다 메시지 하나를 보냄
+		s.serve(conn, reader, msg, peerID)
+		return
+	}
+
+	// Hello를 보내지 않는 클라이언트가 연결을 붙잡고 있지 않도록 함
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	hello, err := s.acceptHello(reader, msg, peerID)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		logger.Log.Warn("session rejected",
+			zap.String("remote", conn.RemoteAddr().String()),
+			zap.Error(err))
+
+		code := ResponseErr
+		if errors.Is(err, ErrIncompatibleProtocol) {
+			code = ResponseIncompatible
+		}
+
+		_ = WriteResponse(conn, Response{Code: code, Msg: err.Error()})
+		return
+	}
+
+	w := bufio.NewWriter(conn)
+	if err := WriteResponse(w, Response{Code: ResponseOK}); err != nil {
+		return
+	}
+	if err := WriteHello(w, localHello(s.id.NodeID)); err != nil {
+		return
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	logger.Log.Debug("session opened",
+		zap.String("peer", peerID),
+		zap.Uint16("version", hello.Version),
+		zap.Stringer("features", hello.Features))
+
+	s.serveSession(newSession(conn, reader, false), peerID)
+}
+
+// acceptHello 클라이언트의 Hello를 읽고 두 노드가 함께 쓸 버전과 기능을 정함
+func (s *Server) acceptHello(reader *bufio.Reader, msg Message, peerID string) (Hello, error) {
+	hello, err := ReadHello(reader)
+	if err != nil {
+		return Hello{}, fmt.Errorf("failed to read hello: %w", err)
+	}
+
+	if msg.OriginID != peerID || hello.NodeID != peerID {
+		return Hello{}, fmt.Errorf("origin %s does not match peer %s", hello.NodeID, peerID)
+	}
+
+	return negotiate(localHello(s.id.NodeID), hello)
+}
+
+// serveSession 스트림마다 메시지 하나를 받아 연결 단위 처리와 같은 방식으로 처리
+func (s *Server) serveSession(sess *session, peerID string) {
+	s.mu.Lock()
+	s.sessions[sess] = struct{}{}
+	s.mu.Unlock()
+
+	defer func(sess *session) {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+
+		_ = sess.Close()
+	}(sess)
+
+	select {
+	case <-s.doneCh:
+		return
+	default:
+	}
+
+	for {
+		st, err := sess.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(st *stream) {
+			defer func(st *stream) {
+				_ = st.Close()
+			}(st)
+
+			reader := bufio.NewReader(st)
+			msg, err := ReadMessage(reader)
+			if err != nil {
+				s.replyErr(st, err)
+				return
+			}
+
+			s.serve(st, reader, msg, peerID)
+		}(st)
+	}
+}
+
+func (s *Server) serve(w io.Writer, reader *bufio.Reader, msg Message, peerID string) {
+	// 다른 노드를 사칭하여 vector clock을 조작하지 못하도록 인증서의 노드 ID와 비교
+	if msg.OriginID != "" && msg.OriginID != peerID {
+		s.replyErr(w, fmt.Errorf("origin %s does not match peer %s", msg.OriginID, peerID))
 		return
 	}
 
+	// 소유자 보존을 켜지 않았으면 상대가 보낸 소유자와 확장 속성을 버림. 그러면 setuid/setgid 비트도 적용되지 않음
+	if !s.owner {
+		msg.Owner, msg.Xattrs = nil, nil
+	}
+
 	switch msg.Type {
-	case MessageSync:
-		s.handleSync(conn, msg)
+	case MessageSync, MessageDelta, MessageSymlink:
+		s.handleSync(w, reader, msg)
+	case MessageOffset:
+		s.handleOffset(w, msg)
 	case MessageDelete:
-		s.handleDelete(conn, msg)
+		s.handleDelete(w, msg)
+	case MessageRename:
+		s.handleRename(w, msg)
+	case MessageMkdir:
+		s.handleMkdir(w, msg)
+	case MessageRemoveDir:
+		s.handleRemoveDir(w, msg)
+	case MessageRenameDir:
+		s.handleRenameDir(w, msg)
+	case MessageManifest:
+		s.handleManifest(w, reader, msg)
 	case MessagePing:
-		_ = WriteResponse(conn, Response{Code: ResponseOK})
+		_ = WriteResponse(w, Response{Code: ResponseOK})
 	default:
-		_ = WriteResponse(conn, Response{
-			Code: ResponseErr,
-			Msg:  fmt.Sprintf("unknown message type: %d", msg.Type),
-		})
+		s.replyErr(w, fmt.Errorf("unknown message type: %d", msg.Type))
 	}
 }
 
-func (s *Server) handleSync(conn net.Conn, msg Message) {
-	dstPath := filepath.Join(s.dst, filepath.FromSlash(msg.Path))
+func (s *Server) handleSync(w io.Writer, reader *bufio.Reader, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
 
-	if existing, err := FileChecksum(dstPath); err == nil {
-		if ChecksumEqual(existing, msg.Checksum) {
-			_ = WriteResponse(conn, Response{Code: ResponseSkip})
+	// 상대가 정한 target으로 dst 밖을 가리키는 링크를 만들면 follow로 감시하는 쪽이 그 파일을 읽어 되돌려 보냄
+	if msg.Type == MessageSymlink {
+		if err := util.SafeLinkTarget(s.dst, dstPath, msg.Target); err != nil {
+			s.reject(w, msg, err)
 			return
 		}
 	}
 
-	localVC := s.vc.Snapshot()
-	relation := Compare(msg.VClock, localVC)
+	unlock := s.versions.lock(s.dst, msg.Path)
+	defer unlock()
+
+	existing, err := localChecksum(dstPath)
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	local, err := s.versions.observe(s.dst, msg.Path, existing, s.id.NodeID)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to load version: %w", err))
+		return
+	}
+
+	// 내용이 같으면 두 벡터 모두 이 내용을 가리키므로 전송 없이 합쳐서 기록하고, 파일 속성만 맞춤
+	if existing != nil && ChecksumEqual(existing, msg.Checksum) {
+		// 링크의 속성을 바꾸면 가리키는 파일이 바뀌므로 링크는 맞추지 않음
+		if msg.Type != MessageSymlink {
+			if err := util.ApplyMeta(dstPath, msg.meta()); err != nil {
+				logger.Log.Warn("failed to apply file metadata",
+					zap.String("path", dstPath),
+					zap.Error(err))
+			}
+		}
+
+		merged, err := s.versions.record(local, msg.VClock, existing)
+		if err != nil {
+			s.replyErr(w, fmt.Errorf("failed to save version: %w", err))
+			return
+		}
+
+		_ = WriteResponse(w, Response{Code: ResponseOK, VClock: merged.Vector})
+		return
+	}
 
-	switch relation {
+	switch Compare(msg.VClock, local.Vector) {
 	case Before:
 		logger.Log.Debug("skipping outdated message",
 			zap.String("path", msg.Path))
 
-		_ = WriteResponse(conn, Response{Code: ResponseSkip})
+		_ = WriteResponse(w, Response{Code: ResponseSkip})
 		return
 
 	case Concurrent:
-		if dstInfo, err := os.Stat(dstPath); err == nil {
-			conflictInfo := &model.ConflictInfo{
-				Path:       msg.Path,
-				SrcModTime: msg.ModTime,
-				DstModTime: dstInfo.ModTime(),
-				Strategy:   s.resolver.Strategy(),
-			}
-			proceed, err := s.resolver.Resolve(conflictInfo, "", dstPath)
-			if err != nil || !proceed {
-				_ = WriteResponse(conn, Response{
-					Code: ResponseSkip,
-					Msg:  "conflict: resolved as skip",
-				})
+		if !s.resolveConflict(dstPath, msg) {
+			if err := s.keepLocal(local, msg, existing); err != nil {
+				s.replyErr(w, err)
 				return
 			}
+
+			_ = WriteResponse(w, Response{
+				Code: ResponseSkip,
+				Msg:  "conflict: resolved as skip",
+			})
+			return
 		}
 
 	case After:
 	}
 
-	s.vc.Merge(msg.VClock)
-	s.vc.Tick(s.nodeID)
+	switch msg.Type {
+	case MessageDelta:
+		err = s.receiveDelta(w, reader, dstPath, msg)
+	case MessageSymlink:
+		err = util.WriteSymlink(dstPath, msg.Target)
+	default:
+		err = s.receiveChunks(w, reader, dstPath, msg)
+	}
 
-	if err := ValidateChecksum(msg.Data, msg.Checksum); err != nil {
-		_ = WriteResponse(conn, Response{
-			Code: ResponseErr,
-			Msg:  "checksum validation failed",
-		})
+	if err != nil {
+		s.replyErr(w, err)
 		return
 	}
 
-	if err := util.AtomicWrite(dstPath, bytes.NewReader(msg.Data)); err != nil {
-		_ = WriteResponse(conn, Response{
-			Code: ResponseErr,
-			Msg:  err.Error(),
-		})
+	if s.applied != nil {
+		s.applied(dstPath, msg.Checksum)
+	}
+
+	merged, err := s.versions.record(local, msg.VClock, msg.Checksum)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to save version: %w", err))
 		return
 	}
 
 	logger.Log.Info("file synced",
 		zap.String("path", dstPath),
-		zap.Int("size", len(msg.Data)),
+		zap.Int64("size", msg.Size),
 		zap.String("origin", msg.OriginID))
 
-	_ = WriteResponse(conn, Response{Code: ResponseOK})
+	_ = WriteResponse(w, Response{
+		Code:   ResponseOK,
+		VClock: merged.Vector,
+	})
 }
 
-func (s *Server) handleDelete(conn net.Conn, msg Message) {
-	dstPath := filepath.Join(s.dst, msg.Path)
+// resolveConflict 동시에 수정된 경우 설정된 전략으로 받은 내용을 적용할지 결정
+func (s *Server) resolveConflict(dstPath string, msg Message) bool {
+	dstInfo, err := os.Lstat(dstPath)
+	if err != nil {
+		return true
+	}
 
-	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
-		_ = WriteResponse(conn, Response{
-			Code: ResponseErr,
-			Msg:  err.Error(),
+	conflictInfo := &model.ConflictInfo{
+		Path:       msg.Path,
+		SrcModTime: msg.ModTime,
+		DstModTime: dstInfo.ModTime(),
+		Strategy:   s.resolver.Strategy(),
+	}
+
+	proceed, err := s.resolver.Resolve(conflictInfo, msg.Path, dstPath)
+	return err == nil && proceed
+}
+
+// keepLocal 충돌에서 로컬 내용을 유지하면 두 벡터를 합친 뒤 tick하여 로컬 버전이 양쪽 모두를 앞서도록 함
+func (s *Server) keepLocal(local model.FileVersion, msg Message, existing []byte) error {
+	vc := FromMap(local.Vector)
+	vc.Merge(msg.VClock)
+	vc.Tick(s.id.NodeID)
+
+	if _, err := s.versions.record(local, vc.Snapshot(), existing); err != nil {
+		return fmt.Errorf("failed to save version: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) replyErr(w io.Writer, err error) {
+	// 안전하지 않은 경로는 다시 보내도 거부되므로 재시도하지 않도록 거부로 응답
+	code := ResponseErr
+	if errors.Is(err, util.ErrUnsafePath) {
+		code = ResponseRejected
+	}
+
+	_ = WriteResponse(w, Response{
+		Code: code,
+		Msg:  err.Error(),
+	})
+}
+
+func (s *Server) receiveChunks(w io.Writer, reader *bufio.Reader, dstPath string, msg Message) error {
+	if err := WriteResponse(w, Response{Code: ResponseReady}); err != nil {
+		return fmt.Errorf("failed to send ready: %w", err)
+	}
+
+	// 청크를 메모리에 모으지 않고 부분 파일에 바로 기록
+	return receivePartial(dstPath, msg, func(h hash.Hash) io.Reader {
+		return newChunkReader(reader, h, msg.Size-msg.Offset)
+	})
+}
+
+func (s *Server) receiveDelta(w io.Writer, reader *bufio.Reader, dstPath string, msg Message) error {
+	base, sig, err := openBase(dstPath)
+	if err != nil {
+		return err
+	}
+
+	if err := writeReadyWithSignature(w, sig); err != nil {
+		if base != nil {
+			_ = base.Close()
+		}
+		return fmt.Errorf("failed to send signature: %w", err)
+	}
+
+	// 기존 파일이 없으면 내용 전체가 literal로 오므로, 끊겨도 이어받을 수 있게 부분 파일에 기록
+	if base == nil {
+		return receivePartial(dstPath, msg, func(hash.Hash) io.Reader {
+			return NewPatchReader(reader, nil, sig, msg.Size)
 		})
+	}
+
+	defer func(base *os.File) {
+		_ = base.Close()
+	}(base)
+
+	// 체크섬 불일치 시 AtomicWrite가 임시 파일을 정리함
+	return util.AtomicWrite(dstPath, NewPatchReader(reader, base, sig, msg.Size), msg.meta())
+}
+
+func (s *Server) handleOffset(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	if existing, err := localChecksum(dstPath); err == nil && ChecksumEqual(existing, msg.Checksum) {
+		_ = WriteResponse(w, Response{Code: ResponseSkip})
+		return
+	}
+
+	_ = WriteResponse(w, Response{
+		Code:   ResponseOK,
+		Offset: committedOffset(dstPath, msg.Checksum, msg.Size),
+	})
+}
+
+func (s *Server) handleDelete(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	unlock := s.versions.lock(s.dst, msg.Path)
+	defer unlock()
+
+	existing, err := localChecksum(dstPath)
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	local, err := s.versions.observe(s.dst, msg.Path, existing, s.id.NodeID)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to load version: %w", err))
+		return
+	}
+
+	switch Compare(msg.VClock, local.Vector) {
+	case Before:
+		_ = WriteResponse(w, Response{Code: ResponseSkip})
+		return
+
+	case Concurrent:
+		// 삭제와 동시에 로컬에서 수정된 파일은 지우지 않고 유지
+		if existing != nil {
+			logger.Log.Warn("delete conflicts with local change, keeping file",
+				zap.String("path", dstPath),
+				zap.String("origin", msg.OriginID))
+
+			if err := s.keepLocal(local, msg, existing); err != nil {
+				s.replyErr(w, err)
+				return
+			}
+
+			_ = WriteResponse(w, Response{
+				Code: ResponseSkip,
+				Msg:  "conflict: kept local change",
+			})
+			return
+		}
+
+	case After:
+	}
+
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		s.replyErr(w, err)
+		return
+	}
+
+	if s.applied != nil && existing != nil {
+		s.applied(dstPath, nil)
+	}
 
+	merged, err := s.versions.record(local, msg.VClock, nil)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to save version: %w", err))
 		return
 	}
 
 	logger.Log.Info("file deleted",
 		zap.String("path", dstPath))
 
-	_ = WriteResponse(conn, Response{Code: ResponseOK})
+	_ = WriteResponse(w, Response{Code: ResponseOK, VClock: merged.Vector})
+}
+
+// handleRename 이전 경로에 보낸 쪽과 같은 내용이 있으면 옮기기만 함. 그렇지 않거나 새 경로가 로컬에서
+// 따로 바뀌었으면 충돌을 판단할 수 있도록 내용을 요청함
+func (s *Server) handleRename(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	oldPath, ok := s.resolve(w, Message{OriginID: msg.OriginID, Path: msg.OldPath})
+	if !ok {
+		return
+	}
+
+	unlock := s.versions.lockPair(s.dst, msg.OldPath, msg.Path)
+	defer unlock()
+
+	existing, err := localChecksum(oldPath)
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	if existing == nil || !ChecksumEqual(existing, msg.Checksum) {
+		_ = WriteResponse(w, Response{Code: ResponseNeedContent})
+		return
+	}
+
+	current, err := localChecksum(dstPath)
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	localNew, err := s.versions.observe(s.dst, msg.Path, current, s.id.NodeID)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to load version: %w", err))
+		return
+	}
+
+	if current != nil && !ChecksumEqual(current, msg.Checksum) && Compare(msg.VClock, localNew.Vector) != After {
+		_ = WriteResponse(w, Response{Code: ResponseNeedContent})
+		return
+	}
+
+	localOld, err := s.versions.observe(s.dst, msg.OldPath, existing, s.id.NodeID)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to load version: %w", err))
+		return
+	}
+
+	if _, err := util.MoveIfExists(oldPath, dstPath); err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	if s.applied != nil {
+		s.applied(oldPath, nil)
+		s.applied(dstPath, msg.Checksum)
+	}
+
+	if _, err := s.versions.record(localOld, msg.OldVClock, nil); err != nil {
+		s.replyErr(w, fmt.Errorf("failed to save version: %w", err))
+		return
+	}
+
+	merged, err := s.versions.record(localNew, msg.VClock, msg.Checksum)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to save version: %w", err))
+		return
+	}
+
+	logger.Log.Info("file moved",
+		zap.String("from", oldPath),
+		zap.String("to", dstPath),
+		zap.String("origin", msg.OriginID))
+
+	_ = WriteResponse(w, Response{Code: ResponseOK, VClock: merged.Vector})
+}
+
+func (s *Server) handleMkdir(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	_, statErr := os.Stat(dstPath)
+	if err := os.MkdirAll(dstPath, 0755); err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	// 이미 있던 디렉터리는 이벤트가 생기지 않으므로 기록하지 않음
+	if s.applied != nil && os.IsNotExist(statErr) {
+		s.applied(dstPath, nil)
+	}
+
+	_ = WriteResponse(w, Response{Code: ResponseOK})
+}
+
+// handleRemoveDir 그 아래의 파일마다 handleDelete처럼 벡터를 비교해 지움. 보낸 쪽이 모르는 로컬 변경이 있는
+// 파일은 남기고, 남긴 파일이 있으면 그 상위 디렉터리도 남김
+func (s *Server) handleRemoveDir(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	if _, err := os.Lstat(dstPath); os.IsNotExist(err) {
+		_ = WriteResponse(w, Response{Code: ResponseOK})
+		return
+	}
+
+	kept := 0
+	err := filepath.WalkDir(dstPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !isEntry(d) {
+			return err
+		}
+
+		sub, err := filepath.Rel(dstPath, path)
+		if err != nil {
+			return err
+		}
+
+		removed, err := s.settleDirFile(msg, msg.Path, filepath.ToSlash(sub), func(local model.FileVersion, other map[string]uint64) error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if s.applied != nil {
+				s.applied(path, nil)
+			}
+
+			if _, err := s.versions.record(local, other, nil); err != nil {
+				return fmt.Errorf("failed to save version: %w", err)
+			}
+
+			return nil
+		})
+		if !removed {
+			kept++
+		}
+
+		return err
+	})
+	if err == nil && kept == 0 {
+		err = util.RemoveAllIfExists(dstPath)
+	}
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	if kept > 0 {
+		removeEmptyDirs(dstPath)
+
+		logger.Log.Warn("directory delete conflicts with local changes, keeping files",
+			zap.String("path", dstPath),
+			zap.Int("kept", kept),
+			zap.String("origin", msg.OriginID))
+
+		_ = WriteResponse(w, Response{
+			Code: ResponseOK,
+			Msg:  fmt.Sprintf("conflict: kept %d local changes", kept),
+		})
+		return
+	}
+
+	if s.applied != nil {
+		s.applied(dstPath, nil)
+	}
+
+	logger.Log.Info("directory deleted",
+		zap.String("path", dstPath))
+
+	_ = WriteResponse(w, Response{Code: ResponseOK})
+}
+
+// handleRenameDir 이전 디렉터리가 없거나 새 경로에 비어 있지 않은 디렉터리가 있으면 내용을 요청함.
+// 보낸 쪽이 모르는 로컬 변경이 있는 파일은 이전 경로에 남기고 나머지만 옮김
+func (s *Server) handleRenameDir(w io.Writer, msg Message) {
+	dstPath, ok := s.resolve(w, msg)
+	if !ok {
+		return
+	}
+
+	oldPath, ok := s.resolve(w, Message{OriginID: msg.OriginID, Path: msg.OldPath})
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(oldPath)
+	if err != nil || !info.IsDir() {
+		_ = WriteResponse(w, Response{Code: ResponseNeedContent})
+		return
+	}
+
+	if _, err := os.Lstat(dstPath); err == nil && !util.IsEmptyDir(dstPath) {
+		_ = WriteResponse(w, Response{Code: ResponseNeedContent})
+		return
+	}
+
+	var files []string
+	err = filepath.WalkDir(oldPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !isEntry(d) {
+			return err
+		}
+
+		rel, err := filepath.Rel(oldPath, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to list directory: %w", err))
+		return
+	}
+
+	var moved, kept []string
+	for _, rel := range files {
+		ok, err := s.settleDirFile(msg, msg.OldPath, rel, nil)
+		if err != nil {
+			s.replyErr(w, err)
+			return
+		}
+
+		if ok {
+			moved = append(moved, rel)
+		} else {
+			kept = append(kept, rel)
+		}
+	}
+
+	if len(kept) == 0 {
+		err = s.moveDir(oldPath, dstPath)
+	} else {
+		err = s.moveDirFiles(oldPath, dstPath, moved)
+	}
+	if err != nil {
+		s.replyErr(w, err)
+		return
+	}
+
+	if s.applied != nil {
+		s.applied(oldPath, nil)
+		s.applied(dstPath, nil)
+	}
+
+	for _, rel := range moved {
+		if err := s.versions.move(s.dst, msg.OldPath+"/"+rel, msg.Path+"/"+rel, s.id.NodeID); err != nil {
+			logger.Log.Warn("failed to move version",
+				zap.String("path", rel),
+				zap.Error(err))
+		}
+	}
+
+	if len(kept) > 0 {
+		logger.Log.Warn("directory move conflicts with local changes, keeping files",
+			zap.String("from", oldPath),
+			zap.String("to", dstPath),
+			zap.Strings("kept", kept),
+			zap.String("origin", msg.OriginID))
+	}
+
+	logger.Log.Info("directory moved",
+		zap.String("from", oldPath),
+		zap.String("to", dstPath),
+		zap.Int("files", len(moved)),
+		zap.String("origin", msg.OriginID))
+
+	resp := Response{Code: ResponseOK}
+	if len(kept) > 0 {
+		resp.Msg = fmt.Sprintf("conflict: kept %d local changes", len(kept))
+	}
+	_ = WriteResponse(w, resp)
+}
+
+// settleDirFile 디렉터리 dir 아래의 파일 sub를 보낸 쪽이 본 상태이면 apply를 부르고 true를 반환.
+// 보낸 쪽이 모르는 로컬 변경이 있으면 handleDelete의 충돌처럼 로컬 내용을 새 버전으로 남기고 false
+func (s *Server) settleDirFile(msg Message, dir, sub string, apply func(local model.FileVersion, other map[string]uint64) error) (bool, error) {
+	rel := dir + "/" + sub
+
+	unlock := s.versions.lock(s.dst, rel)
+	defer unlock()
+
+	existing, err := localChecksum(filepath.Join(s.dst, filepath.FromSlash(rel)))
+	if err != nil {
+		return false, err
+	}
+
+	recorded, err := s.versions.get(s.dst, rel)
+	if err != nil {
+		return false, fmt.Errorf("failed to load version: %w", err)
+	}
+
+	local, err := s.versions.observe(s.dst, rel, existing, s.id.NodeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load version: %w", err)
+	}
+
+	// 벡터를 보내지 않는 이전 버전은 마지막으로 주고받은 상태를 보고 지우거나 옮긴 것으로 봄
+	other := recorded.Vector
+	if msg.Vectors != nil {
+		other = msg.Vectors[sub]
+	}
+
+	if existing != nil && Compare(local.Vector, other) != Before {
+		if err := s.keepLocal(local, Message{VClock: other}, existing); err != nil {
+			return false, err
+		}
+
+		return false, nil
+	}
+
+	if apply == nil {
+		return true, nil
+	}
+
+	return true, apply(local, other)
+}
+
+// moveDir 새 경로에 빈 디렉터리가 있으면 지우고 디렉터리를 통째로 옮김
+func (s *Server) moveDir(oldPath, dstPath string) error {
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	_, err := util.MoveIfExists(oldPath, dstPath)
+	return err
+}
+
+// moveDirFiles files와 빈 디렉터리만 새 경로로 옮기고, 남은 파일이 없는 이전 경로의 디렉터리는 지움
+func (s *Server) moveDirFiles(oldPath, dstPath string, files []string) error {
+	if err := os.MkdirAll(dstPath, 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	for _, rel := range files {
+		if _, err := util.MoveIfExists(filepath.Join(oldPath, filepath.FromSlash(rel)), filepath.Join(dstPath, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+
+	err := filepath.WalkDir(oldPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || !util.IsEmptyDir(path) {
+			return err
+		}
+
+		rel, err := filepath.Rel(oldPath, path)
+		if err != nil {
+			return err
+		}
+
+		return os.MkdirAll(filepath.Join(dstPath, rel), 0755)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	removeEmptyDirs(oldPath)
+	return nil
+}
+
+// removeEmptyDirs dir과 그 아래에서 비어 있는 디렉터리만 안쪽부터 지움
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
+
+func (s *Server) handleManifest(w io.Writer, reader *bufio.Reader, msg Message) {
+	manifest, err := ReadManifest(reader)
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to read manifest: %w", err))
+		return
+	}
+
+	diff := ManifestDiff{Merged: make(map[string]map[string]uint64)}
+	listed := make(map[string]struct{}, len(manifest.Entries))
+
+	for _, e := range manifest.Entries {
+		listed[e.Path] = struct{}{}
+
+		need, merged, err := s.compareEntry(e)
+		if err != nil {
+			s.replyErr(w, err)
+			return
+		}
+
+		if need {
+			diff.Need = append(diff.Need, e.Path)
+		} else if merged != nil {
+			diff.Merged[e.Path] = merged
+		}
+	}
+
+	extras, err := s.extraFiles(listed, manifest.Skipped, ignore.FromRules(s.dst, manifest.Ignore))
+	if err != nil {
+		s.replyErr(w, fmt.Errorf("failed to list destination: %w", err))
+		return
+	}
+
+	if !manifest.Mirror {
+		diff.Extra = extras
+	} else {
+		for _, rel := range extras {
+			if err := s.removeExtra(rel); err != nil {
+				logger.Log.Warn("failed to remove extra file",
+					zap.String("path", rel),
+					zap.Error(err))
+				continue
+			}
+
+			diff.Extra = append(diff.Extra, rel)
+		}
+	}
+
+	logger.Log.Info("manifest compared",
+		zap.String("origin", msg.OriginID),
+		zap.Int("entries", len(manifest.Entries)),
+		zap.Int("need", len(diff.Need)),
+		zap.Int("extra", len(extras)),
+		zap.Bool("mirror", manifest.Mirror))
+
+	bw := bufio.NewWriter(w)
+	if err := WriteResponse(bw, Response{Code: ResponseOK}); err != nil {
+		return
+	}
+	if err := WriteManifestDiff(bw, diff); err != nil {
+		return
+	}
+	_ = bw.Flush()
+}
+
+// compareEntry 내용이 같으면 전송 없이 벡터만 합치고, 클라이언트보다 앞선 벡터를 반환.
+// 안전하지 않은 경로는 필요하다고 응답하여 전송 시 거부되고 history에 남도록 함
+func (s *Server) compareEntry(e ManifestEntry) (bool, map[string]uint64, error) {
+	dstPath, err := util.SafeJoin(s.dst, e.Path)
+	if err != nil {
+		return true, nil, nil
+	}
+
+	// 링크는 따라가지 않고 링크끼리 비교. 크기는 가리키는 경로의 길이
+	info, err := os.Lstat(dstPath)
+	if err != nil || !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+		return true, nil, nil
+	}
+
+	unlock := s.versions.lock(s.dst, e.Path)
+	defer unlock()
+
+	local, err := s.versions.get(s.dst, e.Path)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to load version: %w", err)
+	}
+
+	if info.Size() != e.Size {
+		return !s.isNewer(local, e, info), nil, nil
+	}
+
+	existing, err := localChecksum(dstPath)
+	if err != nil || existing == nil {
+		return true, nil, nil
+	}
+
+	if !ChecksumEqual(existing, e.Checksum) {
+		return !s.isNewer(local, e, info), nil, nil
+	}
+
+	merged, err := s.versions.record(local, e.Vector, existing)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to save version: %w", err)
+	}
+
+	if Compare(merged.Vector, e.Vector) == Before {
+		return false, nil, nil
+	}
+
+	return false, merged.Vector, nil
+}
+
+// isNewer 기록된 뒤 바뀌지 않은 로컬 파일의 버전이 받은 목록보다 앞서면 보내도 건너뛰게 되므로 요청하지 않음
+func (s *Server) isNewer(local model.FileVersion, e ManifestEntry, info os.FileInfo) bool {
+	if local.ID == 0 || local.Deleted || !info.ModTime().Before(local.UpdatedAt) {
+		return false
+	}
+
+	return Compare(e.Vector, local.Vector) == Before
+}
+
+// extraFiles 목록에 없는 dst의 파일. 전송 중인 임시 파일과, src가 무시하거나 건너뛰어
+// 목록에 없어도 src에서 지운 것이 아닌 경로는 뺌
+func (s *Server) extraFiles(listed map[string]struct{}, skipped []string, ig *ignore.Matcher) ([]string, error) {
+	var extras []string
+
+	keep := make(map[string]struct{}, len(skipped))
+	for _, rel := range skipped {
+		keep[rel] = struct{}{}
+	}
+
+	err := filepath.WalkDir(s.dst, ig.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dst, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if _, ok := keep[rel]; ok {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !isEntry(d) {
+			return nil
+		}
+
+		if _, ok := listed[rel]; !ok {
+			extras = append(extras, rel)
+		}
+
+		return nil
+	}))
+
+	return extras, err
+}
+
+func (s *Server) removeExtra(rel string) error {
+	if err := s.removeFile(rel); err != nil {
+		return err
+	}
+
+	logger.Log.Info("extra file removed (mirror)",
+		zap.String("path", filepath.Join(s.dst, filepath.FromSlash(rel))))
+
+	return nil
+}
+
+// removeFile 파일을 지우고 이 노드가 지운 것으로 tombstone을 남김
+func (s *Server) removeFile(rel string) error {
+	unlock := s.versions.lock(s.dst, rel)
+	defer unlock()
+
+	dstPath := filepath.Join(s.dst, filepath.FromSlash(rel))
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if s.applied != nil {
+		s.applied(dstPath, nil)
+	}
+
+	if _, err := s.versions.observe(s.dst, rel, nil, s.id.NodeID); err != nil {
+		return fmt.Errorf("failed to save version: %w", err)
+	}
+
+	return nil
+}
+
+// resolve 메시지의 경로를 dst 아래의 경로로 변환. 안전하지 않으면 거부 응답을 보내고 false 반환
+func (s *Server) resolve(w io.Writer, msg Message) (string, bool) {
+	dstPath, err := util.SafeJoin(s.dst, msg.Path)
+	if err != nil {
+		s.reject(w, msg, err)
+		return "", false
+	}
+
+	return dstPath, true
+}
+
+// reject 안전하지 않은 메시지에 거부 응답을 보냄
+func (s *Server) reject(w io.Writer, msg Message, err error) {
+	logger.Log.Warn("rejected unsafe path",
+		zap.String("path", msg.Path),
+		zap.String("origin", msg.OriginID),
+		zap.Error(err))
+
+	_ = WriteResponse(w, Response{
+		Code: ResponseRejected,
+		Msg:  err.Error(),
+	})
+}
+
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, ".synco.tmp") || strings.HasSuffix(name, partialSuffix)
+}
+
+// isEntry 동기화 대상인 파일이나 링크. 전송 중인 임시 파일은 제외
+func isEntry(d os.DirEntry) bool {
+	return (d.Type().IsRegular() || d.Type()&os.ModeSymlink != 0) && !isTempFile(d.Name())
+}
+
+// localChecksum 로컬 파일이 없으면 nil. 링크는 따라가지 않고 가리키는 경로로 계산
+func localChecksum(path string) ([]byte, error) {
+	if target, err := os.Readlink(path); err == nil {
+		return util.LinkChecksum(target), nil
+	}
+
+	checksum, err := FileChecksum(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute checksum: %w", err)
+	}
+
+	return checksum, nil
+}
+
+// 기존 파일이 없거나 링크이면 빈 시그니처를 반환하고, 클라이언트는 전체 내용을 literal로 보냄
+func openBase(dstPath string) (*os.File, Signature, error) {
+	if util.IsSymlink(dstPath) {
+		return nil, Signature{BlockSize: blockSizeFor(0)}, nil
+	}
+
+	f, err := os.Open(dstPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Signature{BlockSize: blockSizeFor(0)}, nil
+	}
+	if err != nil {
+		return nil, Signature{}, fmt.Errorf("failed to open existing file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, Signature{}, fmt.Errorf("failed to stat existing file: %w", err)
+	}
+
+	sig, err := ComputeSignature(f, info.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, Signature{}, fmt.Errorf("failed to compute signature: %w", err)
+	}
+
+	return f, sig, nil
+}
+
+func writeReadyWithSignature(w io.Writer, sig Signature) error {
+	bw := bufio.NewWriter(w)
+	if err := WriteResponse(bw, Response{Code: ResponseReady}); err != nil {
+		return err
+	}
+
+	if err := WriteSignature(bw, sig); err != nil {
+		return err
+	}
+
+	return bw.Flush()
 }
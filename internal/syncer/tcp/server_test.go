@@ -0,0 +1,208 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"synco/internal/db"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"synco/internal/peer"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// trustStore 노드 ID별로 허용하는 fingerprint
+type trustStore map[string]string
+
+func (ts trustStore) IsTrusted(nodeID, fingerprint string) bool {
+	return ts[nodeID] == fingerprint
+}
+
+func (ts trustStore) Secret(string) ([]byte, error) {
+	return nil, nil
+}
+
+func initDB(t *testing.T) {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	if err := db.Init(filepath.Join(t.TempDir(), "synco.db")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newIdentity 새 홈 디렉터리에 노드 키를 만들고 trust에 등록
+func newIdentity(t *testing.T, trust trustStore) *peer.Identity {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// 노드 ID는 .synco가 이미 있어야 저장됨
+	if err := os.Mkdir(filepath.Join(home, ".synco"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := peer.LoadOrCreateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trust[id.NodeID] = id.Fingerprint
+	id.Trust = trust
+
+	return id
+}
+
+// startSync dst를 받는 서버를 띄우고 src를 보내는 Syncer를 만듦. 두 노드는 서로를 신뢰함
+func startSync(t *testing.T, src, dst string, opts Options) (*Server, *Syncer) {
+	t.Helper()
+	initDB(t)
+
+	trust := trustStore{}
+	srv, err := NewServer(dst, "127.0.0.1:0", newIdentity(t, trust), model.StrategyNewerWins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+
+	s, err := NewSyncer(src, srv.listener.Addr().String(), newIdentity(t, trust), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	return srv, s
+}
+
+// fullSync 결과 중 하나라도 실패하면 테스트를 멈춤
+func fullSync(t *testing.T, s *Syncer) []model.SyncResult {
+	t.Helper()
+
+	results, err := s.FullSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s: %v", result.Event.Path, result.Err)
+		}
+	}
+
+	return results
+}
+
+func TestHandleSyncRejectsEscapingSymlink(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	root := t.TempDir()
+	dst := filepath.Join(root, "dst")
+	if err := os.MkdirAll(filepath.Join(dst, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// dst 안에 이미 있는 링크를 거쳐 밖으로 나가는 경우
+	if err := os.Symlink(root, filepath.Join(dst, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{dst: dst}
+
+	tests := []struct {
+		path   string
+		target string
+	}{
+		{"link", "/etc/shadow"},
+		{"link", "../secret"},
+		{"sub/link", "../../.ssh/id_rsa"},
+		{"link", "sub/../../secret"},
+		{"link", "out/secret"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		s.handleSync(&buf, nil, Message{
+			Type:    MessageSymlink,
+			Path:    tt.path,
+			Target:  tt.target,
+			ModTime: time.Now(),
+		})
+
+		resp, err := ReadResponse(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s -> %s: %v", tt.path, tt.target, err)
+		}
+		if resp.Code != ResponseRejected {
+			t.Errorf("%s -> %s: got response %d, want rejected", tt.path, tt.target, resp.Code)
+		}
+
+		if _, err := os.Lstat(filepath.Join(dst, tt.path)); err == nil {
+			t.Errorf("%s -> %s: link was created", tt.path, tt.target)
+		}
+	}
+}
+
+func TestReadMessageRejectsEscapingSymlink(t *testing.T) {
+	for _, target := range []string{"/etc/shadow", "../../../.ssh/id_rsa", `C:\Windows`} {
+		var buf bytes.Buffer
+		err := WriteMessage(&buf, Message{
+			Type:    MessageSymlink,
+			Path:    "a/link",
+			Target:  target,
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReadMessage(&buf); err == nil {
+			t.Errorf("target %q was accepted", target)
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = WriteMessage(&buf, Message{Type: MessageSymlink, Path: "a/b/link", Target: "../c", ModTime: time.Now()})
+	if _, err := ReadMessage(&buf); err != nil {
+		t.Errorf("target inside destination rejected: %v", err)
+	}
+}
+
+func TestServerRejectsUntrustedPeer(t *testing.T) {
+	initDB(t)
+
+	// 클라이언트는 서버를 신뢰하지만 서버는 클라이언트를 모름
+	serverTrust, clientTrust := trustStore{}, trustStore{}
+	serverID := newIdentity(t, serverTrust)
+	clientTrust[serverID.NodeID] = serverID.Fingerprint
+
+	srv, err := NewServer(t.TempDir(), "127.0.0.1:0", serverID, model.StrategyNewerWins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+
+	s, err := NewSyncer(t.TempDir(), srv.listener.Addr().String(), newIdentity(t, clientTrust), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// TLS 1.3에서는 클라이언트 인증서를 거부한 것이 첫 읽기에서 드러남
+	if err := WriteMessage(conn, Message{Type: MessagePing, OriginID: s.id.NodeID}); err == nil {
+		if resp, err := ReadResponse(bufio.NewReader(conn)); err == nil {
+			t.Errorf("untrusted peer got response %d", resp.Code)
+		}
+	}
+}
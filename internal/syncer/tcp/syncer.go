@@ -3,7 +3,10 @@ package tcp
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,40 +14,92 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"synco/internal/bandwidth"
+	"synco/internal/ignore"
+	"synco/internal/index"
 	"synco/internal/logger"
 	"synco/internal/model"
+	"synco/internal/peer"
 	"synco/internal/retry"
 	"synco/internal/syncer"
+	"synco/internal/util"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+const (
+	keepaliveInterval = 30 * time.Second
+	keepaliveTimeout  = 20 * time.Second
+)
+
+var (
+	// errNoSession 세션을 지원하지 않는 이전 버전 서버
+	errNoSession = errors.New("server does not support sessions")
+	// errNoManifest 목록 비교를 지원하지 않는 서버
+	errNoManifest = errors.New("server does not support manifests")
+)
+
+// Options job마다 다른 전송 설정
+type Options struct {
+	// Mirror 전체 동기화 시 src에 없는 파일을 대상에서 삭제
+	Mirror bool
+	// Compress 서버가 지원하면 이미 압축된 형식이 아닌 파일의 내용을 압축하여 전송
+	Compress bool
+	// Limiter job의 전송 속도 제한. nil이면 제한 없음
+	Limiter *bandwidth.Limiter
+	// Workers Run과 전체 동기화에서 세션의 스트림으로 동시에 보내는 이벤트 수
+	Workers int
+	// Symlinks src의 심볼릭 링크를 따라갈지, 링크로 보낼지, 건너뛸지
+	Symlinks model.SymlinkPolicy
+	// Index 보낸 파일의 기록. 전체 동기화에서 그 뒤로 바뀌지 않은 파일은 다시 해시하지 않음
+	Index *index.Index
+	// Ignore 무시하는 경로는 전체 동기화와 디렉터리 전송에서 뺌
+	Ignore *ignore.Matcher
+	// PreserveOwner 소유자, setuid/setgid 비트와 user 확장 속성도 보냄. 받는 쪽도 켜야 적용됨
+	PreserveOwner bool
+}
+
+// transfer 파일 하나를 보내며 실제로 연결에 쓴 내용의 크기
+type transfer struct {
+	size int64
+	wire int64
+}
+
 type Syncer struct {
 	src      string
 	addr     string
 	dst      string
-	nodeID   string
-	vc       *Vclock
+	id       *peer.Identity
+	opts     Options
+	versions *versions
 	strategy model.ConflictStrategy
 	pull     bool
+
+	// job 동안 유지하는 연결. 끊기면 다음 요청 시 다시 연결함
+	mu       sync.Mutex
+	sess     *session
+	legacy   bool
+	features Feature
 }
 
-func NewSyncer(src, addr, nodeID string, vc *Vclock) (*Syncer, error) {
+func NewSyncer(src, addr string, id *peer.Identity, opts Options) (*Syncer, error) {
 	absSrc, err := filepath.Abs(src)
 	if err != nil {
 		return nil, fmt.Errorf("invalid src path: %w", err)
 	}
 
 	return &Syncer{
-		src:    absSrc,
-		addr:   addr,
-		nodeID: nodeID,
-		vc:     vc,
+		src:      absSrc,
+		addr:     addr,
+		id:       id,
+		opts:     opts,
+		versions: newVersions(),
 	}, nil
 }
 
-func NewPullSyncer(src, addr, dst, nodeID string, strategy model.ConflictStrategy) (*Syncer, error) {
+func NewPullSyncer(src, addr, dst string, id *peer.Identity, strategy model.ConflictStrategy, opts Options) (*Syncer, error) {
 	absDst, err := filepath.Abs(dst)
 	if err != nil {
 		return nil, fmt.Errorf("invalid dst path: %w", err)
@@ -54,8 +109,8 @@ func NewPullSyncer(src, addr, dst, nodeID string, strategy model.ConflictStrateg
 		src:      src,
 		addr:     addr,
 		dst:      absDst,
-		nodeID:   nodeID,
-		vc:       NewVclock(),
+		id:       id,
+		opts:     opts,
 		pull:     true,
 		strategy: strategy,
 	}, nil
@@ -68,15 +123,45 @@ func (s *Syncer) Run(inCh <-chan model.FileEvent) <-chan model.SyncResult {
 		return out
 	}
 
-	return syncer.RunLoop(inCh, s.handle)
+	outCh := make(chan model.SyncResult, cap(inCh))
+
+	go func() {
+		defer close(outCh)
+
+		// 입력이 끝나면 job이 멈춘 것이므로 세션도 닫음
+		defer func(s *Syncer) {
+			_ = s.Close()
+		}(s)
+
+		for result := range syncer.RunLoop(inCh, s.opts.Workers, s.handle) {
+			outCh <- result
+		}
+	}()
+
+	return outCh
+}
+
+// Close 세션을 닫음. 이후 요청이 오면 다시 연결함
+func (s *Syncer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sess == nil {
+		return nil
+	}
+
+	err := s.sess.Close()
+	s.sess = nil
+	return err
 }
 
 func (s *Syncer) FullSync() ([]model.SyncResult, error) {
 	if s.pull {
-		srv, err := NewServer(s.dst, ":0", s.nodeID, s.strategy)
+		srv, err := NewServer(s.dst, ":0", s.id, s.strategy)
 		if err != nil {
 			return nil, err
 		}
+		srv.PreserveOwner(s.opts.PreserveOwner)
 
 		if err := srv.Start(); err != nil {
 			return nil, err
@@ -90,26 +175,265 @@ func (s *Syncer) FullSync() ([]model.SyncResult, error) {
 
 		pushTo := fmt.Sprintf("%s:%d", ip, srv.Port())
 
-		return requestPushOnce(s.addr, s.src, pushTo, s.nodeID)
+		return requestPushOnce(s.addr, s.src, pushTo, s.id, s.opts)
 	}
 
-	var results []model.SyncResult
+	manifest, err := s.buildManifest()
+	if err != nil {
+		return nil, err
+	}
 
-	err := filepath.WalkDir(s.src, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return err
+	s.protect(&manifest)
+
+	diff, err := s.exchangeManifest(manifest)
+	if errors.Is(err, errNoManifest) {
+		// 이전 버전 서버에는 모든 파일을 보내고, 같은 내용인지는 서버가 판단
+		logger.Log.Info("tcp: server does not support manifests, sending all files",
+			zap.String("addr", s.addr),
+			zap.Int("files", len(manifest.Entries)))
+
+		paths := make([]string, 0, len(manifest.Entries))
+		for _, e := range manifest.Entries {
+			paths = append(paths, e.Path)
+		}
+
+		return append(s.sendAll(paths), s.sendEmptyDirs()...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mergeVersions(manifest, diff.Merged)
+
+	results := append(s.sendAll(diff.Need), s.sendEmptyDirs()...)
+
+	if !manifest.Mirror {
+		if len(diff.Extra) > 0 {
+			logger.Log.Info("tcp: destination has files not in source",
+				zap.String("addr", s.addr),
+				zap.Int("count", len(diff.Extra)))
+		}
+
+		return results, nil
+	}
+
+	// mirror인 경우 서버가 이미 삭제한 파일
+	for _, rel := range diff.Extra {
+		results = append(results, model.SyncResult{
+			Event: model.FileEvent{
+				Type:      model.EventRemove,
+				Path:      filepath.Join(s.src, filepath.FromSlash(rel)),
+				Timestamp: time.Now(),
+			},
+			SrcPath: filepath.Join(s.src, filepath.FromSlash(rel)),
+			DstPath: s.addr,
+		})
+	}
+
+	return results, nil
+}
+
+// sendAll 필요한 파일을 세션의 여러 스트림으로 동시에 보냄. 결과는 paths 순서를 유지
+func (s *Syncer) sendAll(paths []string) []model.SyncResult {
+	results := make([]model.SyncResult, len(paths))
+	sem := make(chan struct{}, max(s.opts.Workers, 1))
+
+	var wg sync.WaitGroup
+	for i, rel := range paths {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, rel string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = s.handle(model.FileEvent{
+				Type:      model.EventWrite,
+				Path:      filepath.Join(s.src, filepath.FromSlash(rel)),
+				Timestamp: time.Now(),
+			})
+		}(i, rel)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// sendEmptyDirs 목록에는 파일만 있으므로 빈 디렉터리는 따로 만듦
+func (s *Syncer) sendEmptyDirs() []model.SyncResult {
+	if features, err := s.peerFeatures(); err != nil || !features.Has(FeatureDirs) {
+		return nil
+	}
+
+	var results []model.SyncResult
+	_ = syncer.Walk(s.src, s.opts.Symlinks, s.opts.Ignore.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == s.src || !util.IsEmptyDir(path) {
+			return nil
 		}
 
 		results = append(results, s.handle(model.FileEvent{
-			Type:      model.EventWrite,
+			Type:      model.EventCreate,
 			Path:      path,
+			IsDir:     true,
 			Timestamp: time.Now(),
 		}))
 
+		return nil
+	}))
+
+	return results
+}
+
+// buildManifest src의 모든 파일에 대해 크기, 수정 시각, 체크섬과 version vector를 모음
+func (s *Syncer) buildManifest() (Manifest, error) {
+	manifest := Manifest{Mirror: s.opts.Mirror}
+
+	// 건너뛰는 링크도 서버가 지우지 않도록 목록에 남겨야 하므로 링크 자체를 받아서 거름
+	policy := s.opts.Symlinks
+	if policy == model.SymlinkSkip {
+		policy = model.SymlinkCopyAsLink
+	}
+
+	err := syncer.Walk(s.src, policy, s.opts.Ignore.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() && d.Type()&os.ModeSymlink == 0 {
+			return err
+		}
+
+		if d.Type()&os.ModeSymlink != 0 && s.opts.Symlinks == model.SymlinkSkip {
+			manifest.Skipped = append(manifest.Skipped, s.relPath(path))
+			return nil
+		}
+
+		// 링크로 보내는 항목의 크기는 서버의 Lstat과 같도록 가리키는 경로의 길이
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		checksum, ok := s.indexedChecksum(path, d, info)
+		if !ok {
+			if checksum, err = s.checksum(path); err != nil {
+				return fmt.Errorf("failed to compute checksum of %s: %w", path, err)
+			}
+		}
+
+		relPath := s.relPath(path)
+		version, err := s.versions.observe(s.src, relPath, checksum, s.id.NodeID)
+		if err != nil {
+			return fmt.Errorf("failed to load version: %w", err)
+		}
+
+		manifest.Entries = append(manifest.Entries, ManifestEntry{
+			Path:     relPath,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			Checksum: checksum,
+			Vector:   version.Vector,
+		})
+
+		return nil
+	}))
+
+	return manifest, err
+}
+
+// protect 목록에서 빠진 무시하거나 건너뛴 경로를 서버가 mirror에서 지우지 않도록 함께 보냄.
+// 이를 모르는 서버에는 목록에 없는 파일을 지우지 않도록 mirror를 끔
+func (s *Syncer) protect(manifest *Manifest) {
+	manifest.Ignore = s.opts.Ignore.Rules()
+	if !manifest.hasKeep() {
+		return
+	}
+
+	if features, err := s.peerFeatures(); err == nil && features.Has(FeatureKeep) {
+		return
+	}
+
+	manifest.Ignore, manifest.Skipped = ignore.Rules{}, nil
+	if manifest.Mirror {
+		logger.Log.Warn("tcp: server cannot keep ignored files, not deleting extra files",
+			zap.String("addr", s.addr))
+		manifest.Mirror = false
+	}
+}
+
+func (s *Syncer) exchangeManifest(manifest Manifest) (ManifestDiff, error) {
+	var diff ManifestDiff
+
+	err := retry.Do(context.Background(), retry.Default, func(attempt int) error {
+		features, err := s.peerFeatures()
+		if err != nil {
+			return err
+		}
+
+		if !features.Has(FeatureManifest) {
+			return retry.Permanent(errNoManifest)
+		}
+
+		conn, err := s.openStream()
+		if err != nil {
+			return err
+		}
+
+		defer func(conn io.ReadWriteCloser) {
+			_ = conn.Close()
+		}(conn)
+
+		w := bufio.NewWriter(conn)
+		if err := WriteMessage(w, Message{Type: MessageManifest, OriginID: s.id.NodeID}); err != nil {
+			return fmt.Errorf("failed to send manifest: %w", err)
+		}
+		if err := WriteManifest(w, manifest); err != nil {
+			return fmt.Errorf("failed to send manifest: %w", err)
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to send manifest: %w", err)
+		}
+
+		reader := bufio.NewReader(conn)
+		resp, err := ReadResponse(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.Code != ResponseOK {
+			return retry.Permanent(fmt.Errorf("server error: %s", resp.Msg))
+		}
+
+		diff, err = ReadManifestDiff(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest diff: %w", err)
+		}
+
 		return nil
 	})
 
-	return results, err
+	return diff, err
+}
+
+// mergeVersions 내용이 같아 전송하지 않은 파일의 벡터를 서버와 맞춤
+func (s *Syncer) mergeVersions(manifest Manifest, merged map[string]map[string]uint64) {
+	if len(merged) == 0 {
+		return
+	}
+
+	for _, e := range manifest.Entries {
+		vector, ok := merged[e.Path]
+		if !ok {
+			continue
+		}
+
+		version, err := s.versions.get(s.src, e.Path)
+		if err == nil {
+			_, err = s.versions.record(version, vector, e.Checksum)
+		}
+
+		if err != nil {
+			logger.Log.Warn("failed to save version",
+				zap.String("path", e.Path),
+				zap.Error(err))
+		}
+	}
 }
 
 func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
@@ -126,7 +450,9 @@ func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
 				zap.Int("attempt", attempt))
 		}
 
-		return s.send(event)
+		t, err := s.send(event)
+		result.Size, result.WireBytes = t.size, t.wire
+		return err
 	})
 
 	if err != nil {
@@ -138,106 +464,882 @@ func (s *Syncer) handle(event model.FileEvent) model.SyncResult {
 	} else {
 		logger.Log.Info("tcp: synced",
 			zap.String("type", string(event.Type)),
-			zap.String("path", event.Path))
+			zap.String("path", event.Path),
+			zap.Int64("size", result.Size),
+			zap.Int64("wire", result.WireBytes))
 	}
 
 	return result
 }
 
-func (s *Syncer) send(event model.FileEvent) error {
-	conn, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+func (s *Syncer) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", s.addr, s.id.ClientTLSConfig(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+
+	return conn, nil
+}
+
+// openStream 세션에서 요청 하나를 위한 스트림을 엶. 세션이 없거나 끊겼으면 다시 연결하고,
+// 세션을 지원하지 않는 서버에는 요청마다 연결함
+func (s *Syncer) openStream() (io.ReadWriteCloser, error) {
+	sess, err := s.currentSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if sess == nil {
+		return s.dial()
+	}
+
+	return sess.Open()
+}
+
+// currentSession 세션이 없거나 끊겼으면 다시 연결. 세션을 지원하지 않는 서버이면 nil
+func (s *Syncer) currentSession() (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.legacy {
+		return nil, nil
+	}
+
+	if s.sess != nil && !s.sess.isClosed() {
+		return s.sess, nil
+	}
+
+	sess, hello, err := s.connect()
+	if errors.Is(err, errNoSession) {
+		logger.Log.Warn("tcp: server does not support sessions, connecting per message",
+			zap.String("addr", s.addr))
+
+		s.legacy = true
+		s.features = legacyFeatures
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.sess = sess
+	s.features = hello.Features
+	go s.keepalive(sess)
+
+	return sess, nil
+}
+
+// peerFeatures 서버와 함께 쓸 수 있는 기능. 아직 연결하지 않았으면 연결하여 확인
+func (s *Syncer) peerFeatures() (Feature, error) {
+	if _, err := s.currentSession(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.features, nil
+}
+
+// connect 연결 후 Hello를 교환하여 버전과 기능을 정함. 버전이 맞지 않으면 재시도하지 않음
+func (s *Syncer) connect() (*session, Hello, error) {
+	conn, err := s.dial()
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+		return nil, Hello{}, err
 	}
 
-	defer func(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	w := bufio.NewWriter(conn)
+	if err := WriteMessage(w, Message{Type: MessageSession, OriginID: s.id.NodeID}); err != nil {
 		_ = conn.Close()
-	}(conn)
+		return nil, Hello{}, fmt.Errorf("failed to open session: %w", err)
+	}
+	if err := WriteHello(w, localHello(s.id.NodeID)); err != nil {
+		_ = conn.Close()
+		return nil, Hello{}, fmt.Errorf("failed to open session: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, Hello{}, fmt.Errorf("failed to open session: %w", err)
+	}
 
 	reader := bufio.NewReader(conn)
+	resp, err := ReadResponse(reader)
+	if err != nil {
+		_ = conn.Close()
+		return nil, Hello{}, fmt.Errorf("failed to open session: %w", err)
+	}
+
+	switch resp.Code {
+	case ResponseOK:
+	case ResponseIncompatible:
+		_ = conn.Close()
+		return nil, Hello{}, retry.Permanent(fmt.Errorf("%w: rejected by %s: %s", ErrIncompatibleProtocol, s.addr, resp.Msg))
+	default:
+		_ = conn.Close()
+		return nil, Hello{}, fmt.Errorf("%w: %s", errNoSession, resp.Msg)
+	}
+
+	remote, err := ReadHello(reader)
+	if err == nil {
+		remote, err = negotiate(localHello(s.id.NodeID), remote)
+	}
+	if err != nil {
+		_ = conn.Close()
+
+		err = fmt.Errorf("failed to open session: %w", err)
+		if errors.Is(err, ErrIncompatibleProtocol) {
+			return nil, Hello{}, retry.Permanent(err)
+		}
+		return nil, Hello{}, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	logger.Log.Info("tcp: session opened",
+		zap.String("addr", s.addr),
+		zap.String("peer", remote.NodeID),
+		zap.Uint16("version", remote.Version),
+		zap.Stringer("features", remote.Features))
+
+	return newSession(conn, reader, true), remote, nil
+}
+
+// keepalive 주기적으로 ping을 보내고, 응답이 없으면 세션을 닫아 다음 요청이 다시 연결하도록 함
+func (s *Syncer) keepalive(sess *session) {
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sess.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.ping(sess); err != nil {
+			logger.Log.Warn("tcp: session keepalive failed",
+				zap.String("addr", s.addr),
+				zap.Error(err))
+
+			_ = sess.Close()
+			return
+		}
+	}
+}
+
+func (s *Syncer) ping(sess *session) error {
+	st, err := sess.Open()
+	if err != nil {
+		return err
+	}
+
+	defer func(st *stream) {
+		_ = st.Close()
+	}(st)
+
+	// 응답을 기다리는 동안 세션이 닫히면 읽기도 끝남
+	timer := time.AfterFunc(keepaliveTimeout, func() {
+		_ = sess.Close()
+	})
+	defer timer.Stop()
+
+	if err := WriteMessage(st, Message{Type: MessagePing, OriginID: s.id.NodeID}); err != nil {
+		return err
+	}
+
+	resp, err := ReadResponse(bufio.NewReader(st))
+	if err != nil {
+		return err
+	}
+
+	if resp.Code != ResponseOK {
+		return fmt.Errorf("unexpected ping response: %d", resp.Code)
+	}
+
+	return nil
+}
+
+func (s *Syncer) send(event model.FileEvent) (transfer, error) {
+	var t transfer
+
+	switch {
+	case event.Type == model.EventRename && event.IsDir:
+		return s.sendRenameDir(event)
+	case event.Type == model.EventRename:
+		return s.sendRename(event)
+	case event.IsDir:
+		return t, s.sendDir(event)
+	}
 
 	switch event.Type {
 	case model.EventCreate, model.EventWrite:
-		return s.sendFile(conn, reader, event.Path)
-	case model.EventRemove, model.EventRename:
-		return s.sendDelete(conn, reader, event.Path)
+		return s.sendPath(event.Path)
+
+	case model.EventRemove:
+		return t, s.request(func(w *bufio.Writer, reader *bufio.Reader) error {
+			return s.sendDelete(w, reader, event.Path)
+		})
 	}
 
-	return nil
+	return t, nil
 }
 
-func (s *Syncer) sendFile(conn net.Conn, reader *bufio.Reader, path string) error {
-	info, err := os.Stat(path)
+// sendPath 파일 하나를 보냄. 링크는 정책에 따라 가리키는 내용이나 링크 자체를 보내거나 건너뜀
+func (s *Syncer) sendPath(path string) (transfer, error) {
+	var t transfer
+
+	if util.IsSymlink(path) {
+		switch s.opts.Symlinks {
+		case model.SymlinkSkip:
+			return t, nil
+		case model.SymlinkCopyAsLink:
+			return t, s.request(func(w *bufio.Writer, reader *bufio.Reader) error {
+				return s.sendSymlink(w, reader, path)
+			})
+		}
+	}
+
+	err := s.request(func(w *bufio.Writer, reader *bufio.Reader) (err error) {
+		t, err = s.sendFile(w, reader, path)
+		return err
+	})
+	return t, err
+}
+
+// request 스트림 하나를 열어 메시지 하나를 주고받음
+func (s *Syncer) request(fn func(w *bufio.Writer, reader *bufio.Reader) error) error {
+	conn, err := s.openStream()
 	if err != nil {
-		return fmt.Errorf("failed to stat file: %w", err)
+		return err
+	}
+
+	defer func(conn io.ReadWriteCloser) {
+		_ = conn.Close()
+	}(conn)
+
+	return fn(bufio.NewWriter(conn), bufio.NewReader(conn))
+}
+
+// sendRename 서버가 옮길 수 있으면 내용을 보내지 않음. 옮기지 못하면 새 경로를 보내고 이전 경로를 지움
+func (s *Syncer) sendRename(event model.FileEvent) (transfer, error) {
+	var t transfer
+
+	features, err := s.peerFeatures()
+	if err != nil {
+		return t, err
+	}
+
+	if features.Has(FeatureRename) {
+		var moved bool
+		err := s.request(func(w *bufio.Writer, reader *bufio.Reader) (err error) {
+			moved, err = s.sendMove(w, reader, event)
+			return err
+		})
+		if err != nil || moved {
+			return t, err
+		}
+	}
+
+	t, err = s.sendPath(event.Path)
+	if err != nil {
+		return t, err
+	}
+
+	return t, s.request(func(w *bufio.Writer, reader *bufio.Reader) error {
+		return s.sendDelete(w, reader, event.OldPath)
+	})
+}
+
+// sendDir 디렉터리를 만들거나 지움. 디렉터리 메시지를 모르는 서버에는 보내지 않음
+func (s *Syncer) sendDir(event model.FileEvent) error {
+	features, err := s.peerFeatures()
+	if err != nil {
+		return err
+	}
+
+	if !features.Has(FeatureDirs) {
+		logger.Log.Debug("server does not support directories, skipping",
+			zap.String("path", event.Path))
+		return nil
+	}
+
+	msgType := MessageMkdir
+	if event.Type == model.EventRemove {
+		msgType = MessageRemoveDir
+	}
+
+	msg := Message{
+		Type:     msgType,
+		OriginID: s.id.NodeID,
+		Path:     s.relPath(event.Path),
+	}
+	if msgType == MessageRemoveDir && features.Has(FeatureDirVersions) {
+		msg.Vectors = s.dirVersions(msg.Path, true)
+	}
+
+	_, err = s.sendDirMessage(msg)
+	if err == nil && msgType == MessageRemoveDir {
+		s.opts.Index.Forget(event.Path)
+	}
+
+	return err
+}
+
+// sendRenameDir 서버가 옮기지 못하면 새 디렉터리 아래를 모두 보내고 이전 디렉터리를 지움
+func (s *Syncer) sendRenameDir(event model.FileEvent) (transfer, error) {
+	var t transfer
+
+	features, err := s.peerFeatures()
+	if err != nil {
+		return t, err
+	}
+
+	oldRel, newRel := s.relPath(event.OldPath), s.relPath(event.Path)
+
+	if features.Has(FeatureDirs) {
+		msg := Message{
+			Type:     MessageRenameDir,
+			OriginID: s.id.NodeID,
+			Path:     newRel,
+			OldPath:  oldRel,
+		}
+		if features.Has(FeatureDirVersions) {
+			msg.Vectors = s.dirVersions(oldRel, false)
+		}
+
+		moved, err := s.sendDirMessage(msg)
+		if err != nil {
+			return t, err
+		}
+
+		if moved {
+			s.moveVersions(event.Path, oldRel, newRel)
+			s.opts.Index.Move(event.OldPath, event.Path)
+			return t, nil
+		}
+	}
+
+	t, err = s.sendTree(event.Path)
+	if err != nil {
+		return t, err
+	}
+
+	return t, s.sendDir(model.FileEvent{Type: model.EventRemove, Path: event.OldPath, IsDir: true})
+}
+
+// sendDirMessage 서버가 적용했으면 true, 내용을 보내야 하면 false
+func (s *Syncer) sendDirMessage(msg Message) (bool, error) {
+	var applied bool
+
+	err := s.request(func(w *bufio.Writer, reader *bufio.Reader) error {
+		if err := WriteMessage(w, msg); err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+
+		resp, err := ReadResponse(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
+		switch resp.Code {
+		case ResponseOK:
+			if resp.Msg != "" {
+				logger.Log.Warn("server kept files changed on its side",
+					zap.String("path", msg.Path),
+					zap.String("reason", resp.Msg))
+			}
+			applied = true
+			return nil
+		case ResponseNeedContent:
+			return nil
+		case ResponseErr:
+			return fmt.Errorf("server error: %s", resp.Msg)
+		case ResponseRejected:
+			return rejectedError(resp)
+		default:
+			return fmt.Errorf("unknown response code: %d", resp.Code)
+		}
+	})
+
+	return applied, err
+}
+
+// dirVersions 디렉터리 rel 아래 파일의 벡터. 키는 rel 기준 상대 경로이고, removed이면 지운 것으로 기록한 벡터.
+// 읽지 못하면 빈 목록을 보내 서버가 아무 파일도 지우거나 옮기지 않게 함
+func (s *Syncer) dirVersions(rel string, removed bool) map[string]map[string]uint64 {
+	vectors := make(map[string]map[string]uint64)
+
+	list, err := s.versions.tree(s.src, rel)
+	if err != nil {
+		logger.Log.Warn("failed to load versions",
+			zap.String("path", rel),
+			zap.Error(err))
+		return vectors
+	}
+
+	for _, version := range list {
+		// 옮길 때는 이미 지운 파일의 tombstone을 보내지 않음
+		if version.Deleted && !removed {
+			continue
+		}
+
+		if removed && !version.Deleted {
+			unlock := s.versions.lock(s.src, version.Path)
+			version, err = s.versions.observe(s.src, version.Path, nil, s.id.NodeID)
+			unlock()
+			if err != nil {
+				logger.Log.Warn("failed to save version",
+					zap.String("path", version.Path),
+					zap.Error(err))
+				continue
+			}
+		}
+
+		vectors[strings.TrimPrefix(version.Path, rel+"/")] = version.Vector
+	}
+
+	return vectors
+}
+
+// moveVersions 서버가 옮긴 디렉터리 아래 파일의 벡터를 서버와 같은 방식으로 새 경로로 옮김
+func (s *Syncer) moveVersions(dir, oldRel, newRel string) {
+	_ = syncer.Walk(dir, s.opts.Symlinks, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() && d.Type()&os.ModeSymlink == 0 {
+			return err
+		}
+
+		sub := strings.TrimPrefix(s.relPath(path), newRel)
+		if err := s.versions.move(s.src, oldRel+sub, newRel+sub, s.id.NodeID); err != nil {
+			logger.Log.Warn("failed to move version",
+				zap.String("path", path),
+				zap.Error(err))
+		}
+
+		return nil
+	})
+}
+
+// sendTree 디렉터리 아래의 파일과 빈 디렉터리를 모두 보냄
+func (s *Syncer) sendTree(dir string) (transfer, error) {
+	var total transfer
+
+	err := syncer.Walk(dir, s.opts.Symlinks, s.opts.Ignore.WalkFunc(func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if !util.IsEmptyDir(path) {
+				return nil
+			}
+
+			return s.sendDir(model.FileEvent{Type: model.EventCreate, Path: path, IsDir: true})
+		}
+
+		if !d.Type().IsRegular() && d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		t, err := s.sendPath(path)
+
+		total.size += t.size
+		total.wire += t.wire
+		return err
+	}))
+
+	return total, err
+}
+
+// sendMove 서버가 옮겼으면 true
+func (s *Syncer) sendMove(w *bufio.Writer, reader *bufio.Reader, event model.FileEvent) (bool, error) {
+	checksum, err := s.checksum(event.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to compute checksum: %w", err)
+	}
+
+	oldRel, newRel := s.relPath(event.OldPath), s.relPath(event.Path)
+
+	oldVersion, err := s.versions.observe(s.src, oldRel, nil, s.id.NodeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load version: %w", err)
+	}
+
+	newVersion, err := s.versions.observe(s.src, newRel, checksum, s.id.NodeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load version: %w", err)
+	}
+
+	msg := Message{
+		Type:      MessageRename,
+		OriginID:  s.id.NodeID,
+		VClock:    newVersion.Vector,
+		Path:      newRel,
+		OldPath:   oldRel,
+		OldVClock: oldVersion.Vector,
+		Checksum:  checksum,
+	}
+
+	if err := WriteMessage(w, msg); err != nil {
+		return false, fmt.Errorf("failed to send rename: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return false, fmt.Errorf("failed to send rename: %w", err)
+	}
+
+	resp, err := ReadResponse(reader)
+	if err != nil {
+		return false, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch resp.Code {
+	case ResponseOK:
+		s.opts.Index.Move(event.OldPath, event.Path)
+		return true, s.merge(newVersion, resp, checksum)
+	case ResponseNeedContent:
+		logger.Log.Debug("server cannot move, sending content",
+			zap.String("from", oldRel),
+			zap.String("to", newRel))
+		return false, nil
+	case ResponseErr:
+		return false, fmt.Errorf("server error: %s", resp.Msg)
+	case ResponseRejected:
+		return false, rejectedError(resp)
+	default:
+		return false, fmt.Errorf("unknown response code: %d", resp.Code)
+	}
+}
+
+func (s *Syncer) sendFile(w *bufio.Writer, reader *bufio.Reader, path string) (transfer, error) {
+	var t transfer
+
+	f, err := os.Open(path)
+	if err != nil {
+		return t, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return t, fmt.Errorf("failed to stat file: %w", err)
 	}
 
 	checksum, err := FileChecksum(path)
 	if err != nil {
-		return fmt.Errorf("failed to compute checksum: %w", err)
+		return t, fmt.Errorf("failed to compute checksum: %w", err)
 	}
 
-	data, err := os.ReadFile(path)
+	relPath := s.relPath(path)
+
+	// 마지막으로 동기화한 뒤 바뀐 내용이면 이 노드의 카운터를 올림
+	version, err := s.versions.observe(s.src, relPath, checksum, s.id.NodeID)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return t, fmt.Errorf("failed to load version: %w", err)
 	}
 
-	relPath, err := filepath.Rel(s.src, path)
-	if err != nil || strings.HasPrefix(relPath, "..") {
-		relPath = filepath.Base(path)
+	features, err := s.peerFeatures()
+	if err != nil {
+		return t, err
 	}
 
-	s.vc.Tick(s.nodeID)
+	msgType := MessageSync
+	if info.Size() >= DeltaThreshold && features.Has(FeatureDelta) {
+		msgType = MessageDelta
+	}
+
+	var offset int64
+	if info.Size() >= ResumeThreshold && features.Has(FeatureResume) {
+		// 내용이 같아도 벡터를 합치기 위해 메시지는 보냄
+		resp, err := s.queryOffset(relPath, checksum, info.Size())
+		if err != nil {
+			logger.Log.Debug("failed to query resume offset",
+				zap.String("path", path),
+				zap.Error(err))
+		} else if resp.Code == ResponseOK && resp.Offset > 0 {
+			// 이전에 끊긴 전송이 남아있으면 delta 대신 이어서 전송
+			msgType = MessageSync
+			offset = resp.Offset
+
+			logger.Log.Info("tcp: resuming transfer",
+				zap.String("path", path),
+				zap.Int64("offset", offset),
+				zap.Int64("size", info.Size()))
+		}
+	}
 
 	msg := Message{
-		Type:     MessageSync,
-		OriginID: s.nodeID,
-		VClock:   s.vc.Snapshot(),
-		Path:     filepath.ToSlash(relPath),
+		Type:     msgType,
+		OriginID: s.id.NodeID,
+		VClock:   version.Vector,
+		Path:     relPath,
 		ModTime:  info.ModTime(),
 		Checksum: checksum,
-		Data:     data,
+		Size:     info.Size(),
+		Offset:   offset,
 	}
 
-	if err := WriteMessage(conn, msg); err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+	if features.Has(FeatureMeta) {
+		meta, err := util.StatMeta(path, s.opts.PreserveOwner)
+		if err != nil {
+			return t, fmt.Errorf("failed to read file metadata: %w", err)
+		}
+
+		msg.Mode, msg.Owner, msg.Xattrs = meta.Mode, meta.Owner, meta.Xattrs
+	}
+
+	if err := WriteMessage(w, msg); err != nil {
+		return t, fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return t, fmt.Errorf("failed to send message: %w", err)
 	}
 
 	resp, err := ReadResponse(reader)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return t, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.Code == ResponseOK {
-		s.vc.Merge(resp.VClock)
+	if resp.Code == ResponseReady {
+		compress := s.opts.Compress && features.Has(FeatureCompression) && shouldCompress(f, info.Size())
+
+		t.size = info.Size()
+		t.wire, err = s.sendContent(w, reader, msg, f, compress)
+		if err != nil {
+			return t, err
+		}
+		if err := w.Flush(); err != nil {
+			return t, fmt.Errorf("failed to send file content: %w", err)
+		}
+
+		resp, err = ReadResponse(reader)
+		if err != nil {
+			return t, fmt.Errorf("failed to read response: %w", err)
+		}
 	}
 
 	switch resp.Code {
 	case ResponseOK:
-		return nil
+		s.opts.Index.Record(path, info, checksum, "", "")
+		return t, s.merge(version, resp, checksum)
 	case ResponseSkip:
-		logger.Log.Debug("server skipped (checksum match)",
+		logger.Log.Debug("server skipped",
+			zap.String("path", path),
+			zap.String("reason", resp.Msg))
+		return transfer{}, nil
+	case ResponseErr:
+		return t, fmt.Errorf("server error :%s", resp.Msg)
+	case ResponseRejected:
+		return t, rejectedError(resp)
+	default:
+		return t, fmt.Errorf("unknown response code: %d", resp.Code)
+	}
+}
+
+// sendSymlink 링크가 가리키는 경로를 보내 서버에서 링크로 만듦. 링크를 모르는 서버에는 보내지 않음
+func (s *Syncer) sendSymlink(w *bufio.Writer, reader *bufio.Reader, path string) error {
+	features, err := s.peerFeatures()
+	if err != nil {
+		return err
+	}
+
+	if !features.Has(FeatureSymlinks) {
+		logger.Log.Warn("server does not support symlinks, skipping",
 			zap.String("path", path))
 		return nil
+	}
+
+	target, err := os.Readlink(path)
+	if err != nil {
+		return fmt.Errorf("failed to read link: %w", err)
+	}
+
+	relPath := s.relPath(path)
+
+	// 받는 쪽이 거부하므로 동기화하는 디렉터리 밖을 가리키는 링크는 보내지 않음
+	if err := util.CheckLinkTarget(relPath, target); err != nil {
+		logger.Log.Warn("symlink points outside the synced directory, skipping",
+			zap.String("path", path),
+			zap.String("target", target))
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat link: %w", err)
+	}
+
+	checksum := util.LinkChecksum(target)
+
+	version, err := s.versions.observe(s.src, relPath, checksum, s.id.NodeID)
+	if err != nil {
+		return fmt.Errorf("failed to load version: %w", err)
+	}
+
+	msg := Message{
+		Type:     MessageSymlink,
+		OriginID: s.id.NodeID,
+		VClock:   version.Vector,
+		Path:     relPath,
+		Target:   target,
+		ModTime:  info.ModTime(),
+	}
+
+	if err := WriteMessage(w, msg); err != nil {
+		return fmt.Errorf("failed to send symlink: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to send symlink: %w", err)
+	}
+
+	resp, err := ReadResponse(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch resp.Code {
+	case ResponseOK:
+		s.opts.Index.Record(path, info, checksum, "", "")
+		return s.merge(version, resp, checksum)
+	case ResponseSkip:
+		logger.Log.Debug("server skipped",
+			zap.String("path", path),
+			zap.String("reason", resp.Msg))
+		return nil
 	case ResponseErr:
-		return fmt.Errorf("server error :%s", resp.Msg)
+		return fmt.Errorf("server error: %s", resp.Msg)
+	case ResponseRejected:
+		return rejectedError(resp)
 	default:
 		return fmt.Errorf("unknown response code: %d", resp.Code)
 	}
 }
 
-func (s *Syncer) sendDelete(conn net.Conn, reader *bufio.Reader, path string) error {
-	relPath, err := filepath.Rel(s.src, path)
-	if err != nil || strings.HasPrefix(relPath, "..") {
-		relPath = filepath.Base(path)
+// indexedChecksum 마지막으로 보낸 뒤 바뀌지 않은 파일이면 기록된 해시
+func (s *Syncer) indexedChecksum(path string, d os.DirEntry, info os.FileInfo) ([]byte, bool) {
+	if !d.Type().IsRegular() {
+		return nil, false
+	}
+
+	return s.opts.Index.Hash(path, info)
+}
+
+// checksum 링크로 보내는 항목은 가리키는 경로로, 나머지는 내용으로 계산
+func (s *Syncer) checksum(path string) ([]byte, error) {
+	if s.opts.Symlinks == model.SymlinkCopyAsLink {
+		if target, err := os.Readlink(path); err == nil {
+			return util.LinkChecksum(target), nil
+		}
+	}
+
+	return FileChecksum(path)
+}
+
+// sendContent 파일 내용을 보내고 연결에 쓴 바이트 수를 반환
+func (s *Syncer) sendContent(w io.Writer, reader *bufio.Reader, msg Message, f *os.File, compress bool) (int64, error) {
+	// 압축 후 실제로 나가는 바이트에 속도 제한을 적용
+	cw := &countingWriter{w: s.opts.Limiter.Writer(w)}
+	r := io.LimitReader(f, msg.Size)
+
+	var comp *compressor
+	if compress {
+		comp = newCompressor()
+	}
+
+	if msg.Type != MessageDelta {
+		// 서버에 이미 있는 앞부분은 체크섬 계산에만 사용하고 나머지만 전송
+		h := sha256.New()
+		if _, err := io.CopyN(h, f, msg.Offset); err != nil {
+			return cw.n, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		if _, err := writeChunks(cw, io.LimitReader(f, msg.Size-msg.Offset), h, comp); err != nil {
+			return cw.n, fmt.Errorf("failed to send file content: %w", err)
+		}
+
+		return cw.n, nil
+	}
+
+	sig, err := ReadSignature(reader)
+	if err != nil {
+		return cw.n, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	if _, err := writeDelta(cw, r, sig, comp); err != nil {
+		return cw.n, fmt.Errorf("failed to send delta: %w", err)
+	}
+
+	return cw.n, nil
+}
+
+func (s *Syncer) queryOffset(relPath string, checksum []byte, size int64) (Response, error) {
+	conn, err := s.openStream()
+	if err != nil {
+		return Response{}, err
 	}
 
+	defer func(conn io.ReadWriteCloser) {
+		_ = conn.Close()
+	}(conn)
+
+	w := bufio.NewWriter(conn)
 	msg := Message{
-		Type: MessageDelete,
-		Path: filepath.ToSlash(relPath),
+		Type:     MessageOffset,
+		OriginID: s.id.NodeID,
+		Path:     relPath,
+		Checksum: checksum,
+		Size:     size,
+	}
+
+	if err := WriteMessage(w, msg); err != nil {
+		return Response{}, err
+	}
+	if err := w.Flush(); err != nil {
+		return Response{}, err
+	}
+
+	resp, err := ReadResponse(bufio.NewReader(conn))
+	if err != nil {
+		return Response{}, err
+	}
+
+	switch resp.Code {
+	case ResponseErr:
+		return resp, fmt.Errorf("server error: %s", resp.Msg)
+	case ResponseRejected:
+		return resp, rejectedError(resp)
+	}
+
+	return resp, nil
+}
+
+func (s *Syncer) sendDelete(w *bufio.Writer, reader *bufio.Reader, path string) error {
+	relPath := s.relPath(path)
+
+	// 파일이 이미 사라졌으므로 기록이 있으면 tick된 tombstone이 됨
+	version, err := s.versions.observe(s.src, relPath, nil, s.id.NodeID)
+	if err != nil {
+		return fmt.Errorf("failed to load version: %w", err)
 	}
 
-	if err := WriteMessage(conn, msg); err != nil {
+	msg := Message{
+		Type:     MessageDelete,
+		OriginID: s.id.NodeID,
+		VClock:   version.Vector,
+		Path:     relPath,
+	}
+
+	if err := WriteMessage(w, msg); err != nil {
+		return fmt.Errorf("failed to send delete: %w", err)
+	}
+	if err := w.Flush(); err != nil {
 		return fmt.Errorf("failed to send delete: %w", err)
 	}
 
@@ -246,16 +1348,73 @@ func (s *Syncer) sendDelete(conn net.Conn, reader *bufio.Reader, path string) er
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if resp.Code == ResponseErr {
+	switch resp.Code {
+	case ResponseOK:
+		s.opts.Index.Forget(path)
+		return s.merge(version, resp, nil)
+	case ResponseErr:
 		return fmt.Errorf("server error: %s", resp.Msg)
+	case ResponseRejected:
+		return rejectedError(resp)
+	}
+
+	return nil
+}
+
+// merge 서버가 적용한 버전의 벡터를 합쳐 양쪽이 같은 버전을 가리키도록 함
+func (s *Syncer) merge(version model.FileVersion, resp Response, checksum []byte) error {
+	if version.ID == 0 && len(resp.VClock) == 0 {
+		return nil
+	}
+
+	if _, err := s.versions.record(version, resp.VClock, checksum); err != nil {
+		return fmt.Errorf("failed to save version: %w", err)
 	}
 
 	return nil
 }
 
-func requestPushOnce(addr, src, pushTo, nodeID string) ([]model.SyncResult, error) {
-	body := fmt.Sprintf(`{"src":"%s","push_to":"%s","node_id":"%s"}`, src, pushTo, nodeID)
-	resp, err := PostRemoteDaemon(addr, "/jobs/push-once", nodeID, body)
+func (s *Syncer) relPath(path string) string {
+	relPath, err := filepath.Rel(s.src, path)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		relPath = filepath.Base(path)
+	}
+
+	return filepath.ToSlash(relPath)
+}
+
+// 서버가 경로를 거부한 경우 history에서 구분할 수 있도록 util.ErrUnsafePath로 감싸고, 재시도하지 않음
+func rejectedError(resp Response) error {
+	return retry.Permanent(fmt.Errorf("%w: rejected by server: %s", util.ErrUnsafePath, resp.Msg))
+}
+
+// pushOnceRequest 원격 데몬의 /jobs/push-once 요청 본문
+type pushOnceRequest struct {
+	Src      string `json:"src"`
+	PushTo   string `json:"push_to"`
+	NodeID   string `json:"node_id"`
+	Mirror   bool   `json:"mirror"`
+	Compress bool   `json:"compress"`
+	Symlinks string `json:"symlinks"`
+	// PreserveOwner 이 노드가 소유자를 적용할 때만 상대가 보냄
+	PreserveOwner bool `json:"preserve_owner"`
+}
+
+func requestPushOnce(addr, src, pushTo string, id *peer.Identity, opts Options) ([]model.SyncResult, error) {
+	body, err := json.Marshal(pushOnceRequest{
+		Src:           src,
+		PushTo:        pushTo,
+		NodeID:        id.NodeID,
+		Mirror:        opts.Mirror,
+		Compress:      opts.Compress,
+		Symlinks:      string(opts.Symlinks),
+		PreserveOwner: opts.PreserveOwner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode push-once request: %w", err)
+	}
+
+	resp, err := PostRemoteDaemon(addr, "/jobs/push-once", id, string(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to reach remote daemon at %s: %w", addr, err)
 	}
@@ -1,12 +1,14 @@
 package tcp
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync/atomic"
+	"synco/internal/peer"
 	"time"
 )
 
@@ -23,22 +25,47 @@ func GetOutboundIP() (string, error) {
 	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
 }
 
-func PostRemoteDaemon(host, path, nodeID, body string) (*http.Response, error) {
+// PostRemoteDaemon 원격 데몬에 서명된 요청을 보냄.
+// 서명에 쓸 secret은 상대 노드마다 다르므로, 먼저 연결하여 인증서로 상대를 확인한 뒤 그 연결로 요청
+func PostRemoteDaemon(host, path string, id *peer.Identity, body string) (*http.Response, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, id.ClientTLSConfig(""))
+	if err != nil {
+		return nil, err
+	}
+
+	remoteID, _ := peer.NodeIDFromState(conn.ConnectionState())
+	secret, err := id.Trust.Secret(remoteID)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	var used atomic.Bool
 	client := &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if used.Swap(true) {
+					return nil, fmt.Errorf("connection to %s already used", host)
+				}
+				return conn, nil
+			},
 		},
 	}
 
 	url := fmt.Sprintf("https://%s%s", host, path)
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Synco-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
-	req.Header.Set("X-Synco-Node-Id", nodeID)
+	if err := peer.SignRequest(req, secret, id.NodeID, []byte(body)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
 
 	return client.Do(req)
 }
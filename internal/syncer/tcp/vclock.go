@@ -58,6 +58,7 @@ const (
 	After      Relation = 1
 )
 
+// Compare a가 b보다 앞선 버전이면 Before, 뒤선 버전이면 After. 같으면 Before
 func Compare(a, b map[string]uint64) Relation {
 	aBeforeB := true
 	bBeforeA := true
@@ -73,10 +74,10 @@ func Compare(a, b map[string]uint64) Relation {
 	for k := range keys {
 		av, bv := a[k], b[k]
 		if av > bv {
-			bBeforeA = false
+			aBeforeB = false
 		}
 		if av < bv {
-			aBeforeB = false
+			bBeforeA = false
 		}
 	}
 
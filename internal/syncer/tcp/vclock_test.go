@@ -0,0 +1,26 @@
+package tcp
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b map[string]uint64
+		want Relation
+	}{
+		{"a behind b", map[string]uint64{"n1": 1}, map[string]uint64{"n1": 2}, Before},
+		{"a ahead of b", map[string]uint64{"n1": 2}, map[string]uint64{"n1": 1}, After},
+		{"a missing node", map[string]uint64{"n1": 1}, map[string]uint64{"n1": 1, "n2": 1}, Before},
+		{"b missing node", map[string]uint64{"n1": 1, "n2": 1}, map[string]uint64{"n1": 1}, After},
+		{"equal", map[string]uint64{"n1": 1}, map[string]uint64{"n1": 1}, Before},
+		{"concurrent", map[string]uint64{"n1": 2, "n2": 1}, map[string]uint64{"n1": 1, "n2": 2}, Concurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.a, tt.b); got != tt.want {
+				t.Errorf("Compare(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
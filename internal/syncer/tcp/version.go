@@ -0,0 +1,140 @@
+package tcp
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"sync"
+	"synco/internal/model"
+	"synco/internal/repository"
+)
+
+const versionLockStripes = 64
+
+// versions 경로별 version vector 저장소. 같은 경로의 비교와 갱신이 겹치지 않도록 경로 단위로 잠금
+type versions struct {
+	repo  *repository.VersionRepository
+	locks [versionLockStripes]sync.Mutex
+}
+
+func newVersions() *versions {
+	return &versions{repo: repository.NewVersionRepository()}
+}
+
+func (v *versions) lock(root, path string) func() {
+	mu := &v.locks[stripe(root, path)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockPair 두 경로를 함께 잠금. 교착을 피하려고 항상 낮은 번호의 잠금부터 잡음
+func (v *versions) lockPair(root, a, b string) func() {
+	i, j := stripe(root, a), stripe(root, b)
+	if i == j {
+		return v.lock(root, a)
+	}
+
+	if i > j {
+		i, j = j, i
+	}
+
+	v.locks[i].Lock()
+	v.locks[j].Lock()
+	return func() {
+		v.locks[j].Unlock()
+		v.locks[i].Unlock()
+	}
+}
+
+func stripe(root, path string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(root + "\x00" + path))
+
+	return h.Sum32() % versionLockStripes
+}
+
+// observe 저장된 버전을 불러오고, 기록과 다른 로컬 상태는 동기화 밖에서 바뀐 것이므로
+// nodeID로 tick하여 새 버전으로 기록. checksum이 nil이면 로컬에 파일이 없는 상태
+func (v *versions) observe(root, path string, checksum []byte, nodeID string) (model.FileVersion, error) {
+	version, err := v.get(root, path)
+	if err != nil {
+		return version, err
+	}
+
+	deleted := checksum == nil
+	sum := hex.EncodeToString(checksum)
+
+	// 처음 보는 경로인데 파일도 없으면 기록할 것이 없음
+	if version.ID == 0 && deleted {
+		return version, nil
+	}
+
+	if version.ID != 0 && version.Deleted == deleted && version.Checksum == sum {
+		return version, nil
+	}
+
+	vc := FromMap(version.Vector)
+	vc.Tick(nodeID)
+
+	version.Vector = vc.Snapshot()
+	version.Checksum = sum
+	version.Deleted = deleted
+
+	return version, v.repo.Save(&version)
+}
+
+// get 기록이 없으면 root와 path만 채운 빈 버전을 반환
+func (v *versions) get(root, path string) (model.FileVersion, error) {
+	version, err := v.repo.Get(root, path)
+	if err != nil {
+		return version, err
+	}
+
+	version.Root = root
+	version.Path = path
+	return version, nil
+}
+
+// tree dir 아래 경로의 기록
+func (v *versions) tree(root, dir string) ([]model.FileVersion, error) {
+	return v.repo.GetTree(root, dir)
+}
+
+// move 옮긴 파일의 벡터와 내용을 새 경로로 가져가고, 이전 경로는 nodeID로 tick한 tombstone으로 남김
+func (v *versions) move(root, oldPath, newPath, nodeID string) error {
+	unlock := v.lockPair(root, oldPath, newPath)
+	defer unlock()
+
+	old, err := v.get(root, oldPath)
+	if err != nil || old.ID == 0 || old.Deleted {
+		return err
+	}
+
+	checksum, err := hex.DecodeString(old.Checksum)
+	if err != nil {
+		return err
+	}
+
+	moved, err := v.get(root, newPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := v.record(moved, old.Vector, checksum); err != nil {
+		return err
+	}
+
+	_, err = v.observe(root, oldPath, nil, nodeID)
+	return err
+}
+
+// record 다른 노드의 벡터를 합쳐 현재 내용과 함께 저장. 받은 내용을 적용한 경우에는 tick하지 않음
+func (v *versions) record(version model.FileVersion, other map[string]uint64, checksum []byte) (model.FileVersion, error) {
+	vc := FromMap(version.Vector)
+	vc.Merge(other)
+
+	version.Vector = vc.Snapshot()
+	version.Checksum = hex.EncodeToString(checksum)
+	version.Deleted = checksum == nil
+
+	return version, v.repo.Save(&version)
+}
@@ -0,0 +1,118 @@
+package syncer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"synco/internal/logger"
+	"synco/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Walk filepath.WalkDir와 같지만 심볼릭 링크를 policy에 따라 다룸.
+// SymlinkSkip이면 링크를 넘기지 않고, SymlinkCopyAsLink이면 링크 자체를 넘김.
+// SymlinkFollow이면 가리키는 파일이나 디렉터리의 정보로 넘기고 디렉터리는 링크 경로 아래로 순회하며,
+// 이미 지나온 디렉터리를 다시 가리키는 링크는 순환으로 보고 건너뜀. 깨진 링크도 건너뜀.
+// root가 디렉터리를 가리키는 링크이면 policy와 관계없이 따라감
+func Walk(root string, policy model.SymlinkPolicy, fn fs.WalkDirFunc) error {
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		if info, err := os.Stat(real); err == nil && info.IsDir() {
+			if err := fn(root, fs.FileInfoToDirEntry(info), nil); err != nil {
+				if err == filepath.SkipDir || err == filepath.SkipAll {
+					return nil
+				}
+				return err
+			}
+
+			return walk(root, real, policy, []string{real}, fn)
+		}
+	}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	return visit(root, fs.FileInfoToDirEntry(info), policy, nil, fn)
+}
+
+// walk physical 아래를 순회하며 fn에는 logical 아래의 경로로 넘김. chain은 지나온 디렉터리의 실제 경로
+func walk(logical, physical string, policy model.SymlinkPolicy, chain []string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(physical, func(path string, d fs.DirEntry, err error) error {
+		// physical 자신은 호출한 쪽에서 이미 넘겼음
+		if path == physical && err == nil {
+			return nil
+		}
+
+		path = logical + strings.TrimPrefix(path, physical)
+		if err != nil {
+			return fn(path, d, err)
+		}
+
+		return visit(path, d, policy, chain, fn)
+	})
+}
+
+func visit(path string, d fs.DirEntry, policy model.SymlinkPolicy, chain []string, fn fs.WalkDirFunc) error {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return fn(path, d, nil)
+	}
+
+	switch policy {
+	case model.SymlinkSkip:
+		return nil
+	case model.SymlinkCopyAsLink:
+		return fn(path, d, nil)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		logger.Log.Debug("skipping broken symlink",
+			zap.String("path", path),
+			zap.Error(err))
+		return nil
+	}
+
+	if !info.IsDir() {
+		return fn(path, fs.FileInfoToDirEntry(info), nil)
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil
+	}
+
+	// 링크가 있는 디렉터리의 실제 경로도 지나온 것으로 봄
+	if parent, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		chain = append(chain[:len(chain):len(chain)], parent)
+	}
+
+	if isLoop(real, chain) {
+		logger.Log.Warn("skipping symlink loop",
+			zap.String("path", path),
+			zap.String("target", real))
+		return nil
+	}
+
+	if err := fn(path, fs.FileInfoToDirEntry(info), nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	return walk(path, real, policy, append(chain[:len(chain):len(chain)], real), fn)
+}
+
+// isLoop real이 지나온 디렉터리 중 하나이거나 그 상위이면 다시 들어갔을 때 끝나지 않음
+func isLoop(real string, chain []string) bool {
+	for _, dir := range chain {
+		if dir == real || strings.HasPrefix(dir, real+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package syncer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"synco/internal/logger"
+	"synco/internal/model"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// linkTree d/f.txt와 그것을 가리키는 링크, d/sub에서 src를 가리키는 순환 링크, 깨진 링크를 만듦
+func linkTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "d", "f.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"rel":        "d/f.txt",
+		"dirlink":    "d",
+		"broken":     "missing",
+		"d/sub/loop": "../..",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	return root
+}
+
+func TestWalkSymlinkPolicies(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	tests := []struct {
+		policy model.SymlinkPolicy
+		want   []string
+	}{
+		{model.SymlinkSkip, []string{".", "d", "d/f.txt", "d/sub"}},
+		{model.SymlinkCopyAsLink, []string{".", "broken@", "d", "d/f.txt", "d/sub", "d/sub/loop@", "dirlink@", "rel@"}},
+		// 순환 링크와 깨진 링크는 건너뛰고, 디렉터리 링크는 링크 경로 아래로 순회함
+		{model.SymlinkFollow, []string{".", "d", "d/f.txt", "d/sub", "dirlink", "dirlink/f.txt", "dirlink/sub", "rel"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			root := linkTree(t)
+
+			var got []string
+			err := Walk(root, tt.policy, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				rel, _ := filepath.Rel(root, path)
+				rel = filepath.ToSlash(rel)
+				if d.Type()&fs.ModeSymlink != 0 {
+					rel += "@"
+				}
+				got = append(got, rel)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkFollowsLinkedRoot(t *testing.T) {
+	logger.Log = zap.NewNop()
+
+	real := linkTree(t)
+	root := filepath.Join(t.TempDir(), "root")
+	if err := os.Symlink(real, root); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err := Walk(root, model.SymlinkSkip, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(got, filepath.Join(root, "d", "f.txt")) {
+		t.Errorf("files under a linked root were not walked: %v", got)
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"path/filepath"
 )
 
-func AtomicWrite(dst string, r io.Reader) error {
+// AtomicWrite 임시 파일에 모두 쓴 뒤 ReplaceFile로 dst를 바꿈
+func AtomicWrite(dst string, r io.Reader, meta FileMeta) error {
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return fmt.Errorf("failed to create parent dir: %w", err)
 	}
@@ -29,8 +30,27 @@ func AtomicWrite(dst string, r io.Reader) error {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
 
-	if err := os.Rename(tmp, dst); err != nil {
+	if err := ReplaceFile(tmp, dst, meta); err != nil {
 		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceFile 다 쓴 tmp에 meta를 적용하고 dst로 rename. meta에 권한이 없으면 덮어쓰는 파일의 권한을 유지
+func ReplaceFile(tmp, dst string, meta FileMeta) error {
+	if meta.Mode == 0 {
+		if info, err := os.Stat(dst); err == nil {
+			meta.Mode = info.Mode()
+		}
+	}
+
+	if err := ApplyMeta(tmp, meta); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
 		return fmt.Errorf("failed to rename: %w", err)
 	}
 
@@ -44,3 +64,44 @@ func RemoveIfExists(path string) error {
 
 	return nil
 }
+
+// MoveIfExists src를 dst로 옮김. dst에 있던 파일은 덮어씀. src가 없으면 false
+func MoveIfExists(src, dst string) (bool, error) {
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("failed to create parent dir: %w", err)
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return false, fmt.Errorf("failed to move %s: %w", src, err)
+	}
+
+	return true, nil
+}
+
+// RemoveAllIfExists 디렉터리이면 그 아래의 항목까지 모두 지움
+func RemoveAllIfExists(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// IsEmptyDir 항목이 하나도 없는 디렉터리이면 true
+func IsEmptyDir(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
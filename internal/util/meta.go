@@ -0,0 +1,89 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// 권한으로 옮기는 모드 비트
+const metaModeMask = os.ModePerm | os.ModeSticky
+
+// ownerModeMask 소유자를 함께 옮길 때만 적용하는 모드 비트. 다른 노드가 보낸 setuid 파일이 이 노드의 사용자로 실행되지 않게 함
+const ownerModeMask = os.ModeSetuid | os.ModeSetgid
+
+// FileMeta 내용과 함께 옮기는 파일 속성. 0인 값은 적용하지 않음
+type FileMeta struct {
+	ModTime time.Time
+	Mode    os.FileMode
+	// Owner, Xattrs job에서 소유자 보존을 켰을 때만 읽고, root로 실행할 때만 적용함.
+	// Owner가 nil이면 setuid/setgid 비트도 적용하지 않음
+	Owner  *Owner
+	Xattrs map[string][]byte
+}
+
+type Owner struct {
+	UID int
+	GID int
+}
+
+// StatMeta path의 수정 시각과 권한. owner이면 소유자, setuid/setgid 비트와 user 확장 속성도 읽음
+func StatMeta(path string, owner bool) (FileMeta, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	meta := FileMeta{
+		ModTime: info.ModTime(),
+		Mode:    info.Mode() & metaModeMask,
+	}
+
+	if !owner {
+		return meta, nil
+	}
+
+	meta.Mode = info.Mode() & (metaModeMask | ownerModeMask)
+
+	meta.Owner = fileOwner(info)
+	if meta.Xattrs, err = readXattrs(path); err != nil {
+		return FileMeta{}, fmt.Errorf("failed to read xattrs: %w", err)
+	}
+
+	return meta, nil
+}
+
+// ApplyMeta 소유자를 바꾸면 setuid 비트가 지워지므로 권한보다 먼저 바꾸고,
+// 다른 변경이 수정 시각을 건드리지 않도록 수정 시각은 마지막에 바꿈. 링크는 따라가지 않음
+func ApplyMeta(path string, meta FileMeta) error {
+	if meta.Owner != nil && isRoot() {
+		if err := os.Lchown(path, meta.Owner.UID, meta.Owner.GID); err != nil {
+			return fmt.Errorf("failed to change owner: %w", err)
+		}
+	}
+
+	if meta.Mode != 0 {
+		mask := metaModeMask
+		if meta.Owner != nil {
+			mask |= ownerModeMask
+		}
+
+		if err := chmodNoFollow(path, meta.Mode&mask); err != nil {
+			return fmt.Errorf("failed to change mode: %w", err)
+		}
+	}
+
+	if len(meta.Xattrs) > 0 && isRoot() {
+		if err := writeXattrs(path, meta.Xattrs); err != nil {
+			return fmt.Errorf("failed to write xattrs: %w", err)
+		}
+	}
+
+	if !meta.ModTime.IsZero() {
+		if err := os.Chtimes(path, time.Time{}, meta.ModTime); err != nil {
+			return fmt.Errorf("failed to change mtime: %w", err)
+		}
+	}
+
+	return nil
+}
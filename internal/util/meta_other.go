@@ -0,0 +1,18 @@
+//go:build !unix
+
+package util
+
+import "os"
+
+// 소유자를 uid/gid로 나타내지 않는 플랫폼에서는 권한과 수정 시각만 옮김
+func isRoot() bool {
+	return false
+}
+
+func fileOwner(_ os.FileInfo) *Owner {
+	return nil
+}
+
+func chmodNoFollow(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func isRoot() bool {
+	return os.Geteuid() == 0
+}
+
+func fileOwner(info os.FileInfo) *Owner {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	return &Owner{UID: int(st.Uid), GID: int(st.Gid)}
+}
+
+// chmodNoFollow fchmodat2가 없는 커널에서는 링크가 아닐 때만 바꿈. 링크 자신의 권한은 바꿀 수 없으므로 건너뜀
+func chmodNoFollow(path string, mode os.FileMode) error {
+	err := unix.Fchmodat(unix.AT_FDCWD, path, unixMode(mode), unix.AT_SYMLINK_NOFOLLOW)
+	if !errors.Is(err, unix.EOPNOTSUPP) && !errors.Is(err, unix.ENOTSUP) {
+		return err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink != 0 {
+		return err
+	}
+
+	return os.Chmod(path, mode)
+}
+
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= unix.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= unix.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= unix.S_ISVTX
+	}
+
+	return m
+}
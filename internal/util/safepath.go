@@ -0,0 +1,171 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrUnsafePath 원격에서 받은 경로가 대상 디렉터리를 벗어나거나 사용할 수 없는 이름인 경우
+var ErrUnsafePath = errors.New("unsafe path")
+
+// Windows에서 확장자와 관계없이 장치로 해석되는 이름
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeJoin 신뢰할 수 없는 상대 경로 rel을 root 아래의 로컬 경로로 변환.
+// 상위 디렉터리 참조, 절대 경로, 예약된 장치 이름, root 밖을 가리키는 심볼릭 링크를 거부
+func SafeJoin(root, rel string) (string, error) {
+	parts, err := splitRelPath(rel)
+	if err != nil {
+		return "", err
+	}
+
+	joined := filepath.Join(append([]string{root}, parts...)...)
+	if err := checkSymlinks(root, joined); err != nil {
+		return "", err
+	}
+
+	return joined, nil
+}
+
+func splitRelPath(rel string) ([]string, error) {
+	if rel == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrUnsafePath)
+	}
+
+	if strings.ContainsRune(rel, 0) {
+		return nil, fmt.Errorf("%w: %q contains NUL", ErrUnsafePath, rel)
+	}
+
+	// 송신 측 OS와 관계없이 두 구분자를 모두 경로 구분자로 취급
+	if strings.HasPrefix(rel, "/") || strings.HasPrefix(rel, `\`) ||
+		filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || hasDriveLetter(rel) {
+		return nil, fmt.Errorf("%w: %q is absolute", ErrUnsafePath, rel)
+	}
+
+	var parts []string
+	for _, part := range strings.FieldsFunc(rel, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch {
+		case part == ".":
+			continue
+		case part == "..":
+			return nil, fmt.Errorf("%w: %q escapes the destination", ErrUnsafePath, rel)
+		case isReservedName(part):
+			return nil, fmt.Errorf("%w: %q uses a reserved name", ErrUnsafePath, rel)
+		}
+
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: %q has no file name", ErrUnsafePath, rel)
+	}
+
+	return parts, nil
+}
+
+func hasDriveLetter(rel string) bool {
+	return len(rel) >= 2 && rel[1] == ':' &&
+		(rel[0] >= 'a' && rel[0] <= 'z' || rel[0] >= 'A' && rel[0] <= 'Z')
+}
+
+func isReservedName(part string) bool {
+	// Windows는 이름 끝의 점과 공백을 무시하므로 "a." 와 "a"가 같은 파일이 됨. 다른 OS에서는 올바른 이름
+	if runtime.GOOS == "windows" && (strings.HasSuffix(part, ".") || strings.HasSuffix(part, " ")) {
+		return true
+	}
+
+	base, _, _ := strings.Cut(part, ".")
+	return reservedNames[strings.ToUpper(strings.TrimSpace(base))]
+}
+
+// CheckLinkTarget 원격에서 받은 링크의 target이 절대 경로이거나, 링크가 있는 디렉터리 기준으로 풀었을 때
+// 대상 디렉터리를 벗어나면 거부. rel은 대상 디렉터리 기준 링크의 상대 경로
+func CheckLinkTarget(rel, target string) error {
+	if strings.ContainsRune(target, 0) {
+		return fmt.Errorf("%w: link target %q contains NUL", ErrUnsafePath, target)
+	}
+
+	if strings.HasPrefix(target, "/") || strings.HasPrefix(target, `\`) ||
+		filepath.IsAbs(target) || filepath.VolumeName(target) != "" || hasDriveLetter(target) {
+		return fmt.Errorf("%w: link target %q is absolute", ErrUnsafePath, target)
+	}
+
+	// 송신 측 OS와 관계없이 두 구분자를 모두 경로 구분자로 취급
+	dir := path.Dir(strings.ReplaceAll(rel, `\`, "/"))
+	resolved := path.Join(dir, strings.ReplaceAll(target, `\`, "/"))
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("%w: link target %q escapes the destination", ErrUnsafePath, target)
+	}
+
+	return nil
+}
+
+// SafeLinkTarget root 아래의 link를 target을 가리키도록 만들어도 되는지 확인.
+// CheckLinkTarget에 더해 이미 있는 링크를 거쳐 root 밖으로 나가는 target도 거부
+func SafeLinkTarget(root, link, target string) error {
+	rel, err := filepath.Rel(root, link)
+	if err != nil {
+		return fmt.Errorf("%w: %s is outside the destination", ErrUnsafePath, link)
+	}
+
+	if err := CheckLinkTarget(filepath.ToSlash(rel), target); err != nil {
+		return err
+	}
+
+	return resolveInside(root, filepath.Join(filepath.Dir(link), filepath.FromSlash(target)), true)
+}
+
+// checkSymlinks 이미 존재하는 경로 중 가장 깊은 곳을 실제 경로로 풀어 root 안에 있는지 확인.
+// target 자체가 링크이면 따라가지 않고 옮기거나 지우므로 부모만 확인
+func checkSymlinks(root, target string) error {
+	return resolveInside(root, target, false)
+}
+
+// resolveInside followLast이면 target 자체가 링크일 때 가리키는 곳까지 확인
+func resolveInside(root, target string, followLast bool) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+
+	existing := target
+	if !followLast && IsSymlink(target) {
+		existing = filepath.Dir(target)
+	}
+
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing || len(parent) < len(root) {
+			return nil
+		}
+		existing = parent
+	}
+
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		// 루트 밖을 가리키는 깨진 링크도 거부
+		return fmt.Errorf("%w: cannot resolve %s: %v", ErrUnsafePath, existing, err)
+	}
+
+	relToRoot, err := filepath.Rel(realRoot, real)
+	if err != nil || relToRoot == ".." || strings.HasPrefix(relToRoot, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s resolves outside the destination", ErrUnsafePath, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSafeJoinRejectsUnsafePaths(t *testing.T) {
+	root := t.TempDir()
+
+	for _, rel := range []string{
+		"",
+		".",
+		"..",
+		"../secret",
+		"a/../../secret",
+		`a\..\..\secret`,
+		"/etc/passwd",
+		`\Windows\System32`,
+		`C:\Windows`,
+		"c:secret",
+		"a\x00b",
+		"CON",
+		"sub/nul.txt",
+		"LPT1.log",
+	} {
+		if _, err := SafeJoin(root, rel); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("SafeJoin(%q) = %v, want ErrUnsafePath", rel, err)
+		}
+	}
+}
+
+func TestSafeJoinRejectsSymlinkOutsideRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "dst")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(root, "out")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if _, err := SafeJoin(root, "out/secret"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("path through a link leaving the root was accepted: %v", err)
+	}
+}
+
+func TestSafeJoinAcceptsRelativePaths(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"a.txt", "a.txt"},
+		{"dir/sub/a.txt", filepath.Join("dir", "sub", "a.txt")},
+		{`dir\a.txt`, filepath.Join("dir", "a.txt")},
+		{"./dir//a.txt", filepath.Join("dir", "a.txt")},
+		{"..hidden", "..hidden"},
+		{"CONFIG.txt", "CONFIG.txt"},
+	}
+
+	for _, tt := range tests {
+		got, err := SafeJoin(root, tt.rel)
+		if err != nil {
+			t.Errorf("SafeJoin(%q): %v", tt.rel, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("SafeJoin(%q) = %q, want %q", tt.rel, got, want)
+		}
+	}
+}
+
+func TestSafeJoinTrailingDotOrSpace(t *testing.T) {
+	root := t.TempDir()
+
+	for _, rel := range []string{"README.", "notes ", "dir./a.txt"} {
+		_, err := SafeJoin(root, rel)
+
+		// Windows에서만 끝의 점과 공백을 무시하므로 다른 OS에서는 그대로 동기화해야 함
+		if runtime.GOOS == "windows" {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("SafeJoin(%q) = %v, want ErrUnsafePath on windows", rel, err)
+			}
+		} else if err != nil {
+			t.Errorf("SafeJoin(%q): %v", rel, err)
+		}
+	}
+}
+
+func TestCheckLinkTarget(t *testing.T) {
+	tests := []struct {
+		rel, target string
+		ok          bool
+	}{
+		{"l", "a.txt", true},
+		{"d/l", "../a.txt", true},
+		{"d/e/l", "../../d/f.txt", true},
+		{"l", "../a.txt", false},
+		{"d/l", "../../a.txt", false},
+		{`d\l`, `..\..\a.txt`, false},
+		{"l", "/etc/passwd", false},
+		{"l", `C:\Windows`, false},
+		{"l", "a\x00b", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckLinkTarget(tt.rel, tt.target)
+		if tt.ok && err != nil {
+			t.Errorf("CheckLinkTarget(%q, %q): %v", tt.rel, tt.target, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("CheckLinkTarget(%q, %q) = %v, want ErrUnsafePath", tt.rel, tt.target, err)
+		}
+	}
+}
+
+func TestSafeLinkTargetRejectsExistingLinkOutsideRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "dst")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(root, "out")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	// target 문자열만 보면 root 안이지만 이미 있는 링크를 거쳐 밖으로 나감
+	if err := SafeLinkTarget(root, filepath.Join(root, "l"), "out/secret"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("target through a link leaving the root was accepted: %v", err)
+	}
+
+	if err := SafeLinkTarget(root, filepath.Join(root, "l"), "a.txt"); err != nil {
+		t.Errorf("target inside the root was rejected: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// IsSymlink path 자체가 심볼릭 링크이면 true
+func IsSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// LinkChecksum 같은 경로를 가리키는 링크는 같은 내용으로 봄. 파일 내용의 체크섬과 겹치지 않도록 접두어를 붙임
+func LinkChecksum(target string) []byte {
+	sum := sha256.Sum256([]byte("synco-symlink\x00" + target))
+	return sum[:]
+}
+
+// WriteSymlink dst를 target을 가리키는 링크로 바꿈. 임시 이름으로 만든 뒤 rename하여 dst가 비는 순간이 없음
+func WriteSymlink(dst, target string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create parent dir: %w", err)
+	}
+
+	tmp := dst + ".synco.tmp"
+	_ = os.Remove(tmp)
+
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to rename: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrPrefix 옮기는 확장 속성의 네임스페이스. security.*와 trusted.*는 권한이나 보안 정책을 바꾸므로 옮기지 않음
+const xattrPrefix = "user."
+
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := listXattrs(path)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, xattrPrefix) {
+			continue
+		}
+
+		value, err := getXattr(path, name)
+		if errors.Is(err, syscall.ENODATA) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		xattrs[name] = value
+	}
+
+	return xattrs, nil
+}
+
+func writeXattrs(path string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		if !strings.HasPrefix(name, xattrPrefix) {
+			continue
+		}
+
+		if err := unix.Lsetxattr(path, name, value, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range bytes.SplitSeq(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:size], nil
+}
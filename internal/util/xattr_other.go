@@ -0,0 +1,11 @@
+//go:build !linux
+
+package util
+
+func readXattrs(_ string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func writeXattrs(_ string, _ map[string][]byte) error {
+	return nil
+}